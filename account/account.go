@@ -37,20 +37,38 @@ func IsErrorNoOrg(err error) bool {
 	return ok && e.Code() == orgs.ErrCodeAWSOrganizationsNotInUseException
 }
 
+// Hidden is the alias of accounts that should be ignored.
+const Hidden = "-"
+
+// Alias contains account information from the alias file.
+type Alias struct {
+	Name       string // Account alias or Hidden
+	Role       string // Role path/name to assume instead of the default
+	ExternalID string // External ID required by Role
+}
+
+// Hidden returns true if the account should be ignored.
+func (a *Alias) Hidden() bool { return a.Name == Hidden }
+
 // LoadAliases loads account aliases from a file. The file should contain one
-// alias per line in the format "<partition> <account-id> <alias>". Empty lines
-// and lines beginning with '#' are ignored.
-func LoadAliases(file, partition string) (map[string]string, error) {
+// alias per line in the format:
+//
+//	<partition> <account-id> <alias> [<role> [<external-id>]]
+//
+// Alias "-" hides the account, even if it belongs to an organization. Role "-"
+// selects the default role, which is useful for specifying just the external
+// id. Empty lines and lines beginning with '#' are ignored.
+func LoadAliases(file, partition string) (map[string]Alias, error) {
 	f, err := os.Open(file)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 	s, ln := bufio.NewScanner(f), 0
-	m := make(map[string]string)
+	m := make(map[string]Alias)
 	for s.Scan() {
 		f := bytes.Fields(s.Bytes())
-		if ln++; len(f) != 3 {
+		if ln++; len(f) < 3 || 5 < len(f) {
 			if len(f) == 0 || f[0][0] == '#' {
 				continue
 			}
@@ -60,16 +78,22 @@ func LoadAliases(file, partition string) (map[string]string, error) {
 		if string(f[0]) != partition {
 			continue
 		}
-		id, alias := string(f[1]), string(f[2])
+		id, a := string(f[1]), Alias{Name: string(f[2])}
 		if !IsID(id) {
 			return nil, fmt.Errorf("account: invalid account id at %s:%d",
 				file, ln)
 		}
-		if alias == "" {
+		if a.Name == "" {
 			return nil, fmt.Errorf("account: invalid account alias at %s:%d",
 				file, ln)
 		}
-		m[id] = alias
+		if len(f) > 3 && string(f[3]) != "-" {
+			a.Role = string(f[3])
+		}
+		if len(f) > 4 {
+			a.ExternalID = string(f[4])
+		}
+		m[id] = a
 	}
 	if err = s.Err(); err != nil || len(m) == 0 {
 		m = nil
@@ -39,21 +39,32 @@ func TestLoadAliases(t *testing.T) {
 		"aws  000000000000  main",
 		"aws\t000000000001\ttest1",
 		"aws-us-gov 000000000002 test2",
+		"aws 000000000003 test3 OrganizationAccountAccessRole",
+		"aws 000000000004 test4 - secret",
+		"aws 000000000005 test5 /team/admin secret",
+		"aws 000000000006 -",
 		"",
 	}, "\n"))
 	require.NoError(t, tmp.Close())
 
-	have, err := LoadAliases(tmp.Name(), endpoints.AwsPartitionID)
+	std, err := LoadAliases(tmp.Name(), endpoints.AwsPartitionID)
 	assert.NoError(t, err)
-	want := map[string]string{
-		"000000000000": "main",
-		"000000000001": "test1",
+	want := map[string]Alias{
+		"000000000000": {Name: "main"},
+		"000000000001": {Name: "test1"},
+		"000000000003": {Name: "test3", Role: "OrganizationAccountAccessRole"},
+		"000000000004": {Name: "test4", ExternalID: "secret"},
+		"000000000005": {Name: "test5", Role: "/team/admin", ExternalID: "secret"},
+		"000000000006": {Name: Hidden},
 	}
-	assert.Equal(t, want, have)
+	assert.Equal(t, want, std)
+	hidden, visible := std["000000000006"], std["000000000001"]
+	assert.True(t, hidden.Hidden())
+	assert.False(t, visible.Hidden())
 
-	have, err = LoadAliases(tmp.Name(), endpoints.AwsUsGovPartitionID)
+	have, err := LoadAliases(tmp.Name(), endpoints.AwsUsGovPartitionID)
 	assert.NoError(t, err)
-	want = map[string]string{"000000000002": "test2"}
+	want = map[string]Alias{"000000000002": {Name: "test2"}}
 	assert.Equal(t, want, have)
 
 	have, err = LoadAliases(tmp.Name(), endpoints.AwsCnPartitionID)
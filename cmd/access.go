@@ -0,0 +1,526 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/mxk/go-cli"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/mxk/go-cloud/aws/iamx"
+	"github.com/mxk/go-fast"
+	"github.com/mxk/oktapus/account"
+	"github.com/mxk/oktapus/op"
+	"github.com/pkg/errors"
+)
+
+var accessCli = cli.Main.Add(&cli.Info{
+	Name:    "access",
+	Usage:   "[options] [account-spec]",
+	Summary: "Report who can assume which roles",
+	MaxArgs: 1,
+	New:     func() cli.Cmd { return &accessCmd{} },
+})
+
+type accessCmd struct {
+	OutFmt
+	All  bool `flag:"Include roles outside of the oktapus IAM path"`
+	CSV  bool `flag:"Write output in CSV format"`
+	Rows bool `flag:"Write one row per principal and role instead of a matrix"`
+	Spec string
+}
+
+func (*accessCmd) Info() *cli.Info { return accessCli }
+
+func (*accessCmd) Help(w *cli.Writer) {
+	w.Text(`
+	Report who can assume which roles.
+
+	This command lists IAM roles in each matching account and parses their
+	AssumeRole policies to produce a principal-by-account access matrix. Each
+	cell lists the roles that the principal can assume in that account and the
+	managed policies attached to them. By default, only roles under the
+	` + op.IAMPath + ` path (created by 'authz') are included. Use -all to
+	include all roles. Use -rows to get one row per principal and role instead.
+
+	Grants created with 'authz -expires' show when they expire. Expired grants
+	are not reported. Grants that depend on other conditions, such as MFA, an
+	external ID, a NotPrincipal element, or a conditional Deny statement, list
+	the condition keys. Principals that are denied by an unconditional Deny
+	statement are not reported. Principals are compared literally, so denying
+	an entire account does not remove grants to individual users in that
+	account.
+
+	Service principals, such as ec2.amazonaws.com, are reported by name
+	alongside users, roles, and identity providers.
+
+	Roles that trust an entire account or any principal ("*") are flagged in
+	the Warning column. Use -csv or -json for output that is suitable for
+	access reviews.
+	`)
+	accountSpecHelp(w)
+}
+
+func (cmd *accessCmd) Main(args []string) error {
+	cmd.Spec = get(args, 0)
+	if cmd.CSV && cmd.JSON {
+		return cli.Error("-csv and -json are mutually exclusive")
+	}
+	return op.RunAndPrint(cmd)
+}
+
+func (cmd *accessCmd) Run(ctx *op.Ctx) (interface{}, error) {
+	acs, err := ctx.Match(cmd.Spec)
+	if err != nil {
+		return nil, err
+	}
+	path := op.IAMPath
+	if cmd.All {
+		path = "/"
+	}
+	rows := make([][]*accessOutput, len(acs))
+	out := &accessReport{Accounts: make([]*accessAccount, len(acs))}
+	acs.EnsureCreds(minDur).Map(func(i int, ac *op.Account) error {
+		out.Accounts[i] = &accessAccount{Account: ac.ID, Name: ac.Name}
+		var err error
+		if !ac.CredsValid() {
+			err = ac.Err
+		} else if rows[i], err = roleAccess(ac.IAM, path); err == nil {
+			for _, r := range rows[i] {
+				r.Account, r.Name = ac.ID, ac.Name
+			}
+			return nil
+		}
+		out.Accounts[i].Error = explainError(err)
+		rows[i] = []*accessOutput{{
+			Account: ac.ID,
+			Name:    ac.Name,
+			Error:   out.Accounts[i].Error,
+		}}
+		return nil
+	})
+	for _, r := range rows {
+		out.Grants = append(out.Grants, r...)
+	}
+	sort.SliceStable(out.Grants, func(i, j int) bool {
+		return out.Grants[i].Principal < out.Grants[j].Principal
+	})
+	return out, nil
+}
+
+func (cmd *accessCmd) Print(v interface{}) error {
+	r := v.(*accessReport)
+	if cmd.Rows {
+		if !cmd.CSV {
+			return cmd.OutFmt.Print(r.Grants)
+		}
+		return writeCSV(os.Stdout, grantCSV(r.Grants))
+	}
+	m := r.matrix()
+	switch {
+	case cmd.JSON:
+		return cmd.OutFmt.Print(m)
+	case cmd.CSV:
+		return writeCSV(os.Stdout, m.cells(true))
+	}
+	return writeTable(os.Stdout, m.cells(false))
+}
+
+// accessReport is the output of the access command.
+type accessReport struct {
+	Accounts []*accessAccount
+	Grants   []*accessOutput
+}
+
+type accessAccount struct {
+	Account string
+	Name    string
+	Error   string `json:",omitempty"`
+}
+
+type accessOutput struct {
+	Principal  string
+	Account    string
+	Name       string
+	Role       string
+	Policies   string
+	Expires    expTime
+	Conditions string `json:",omitempty" printer:",omitempty"`
+	Warning    string `json:",omitempty" printer:",omitempty"`
+	Error      string `json:",omitempty" printer:",last"`
+}
+
+// accessMatrix is the principal-by-account view of an access report.
+type accessMatrix struct {
+	Accounts   []*accessAccount
+	Principals []*principalAccess
+}
+
+// principalAccess contains the grants of one principal, keyed by account ID.
+type principalAccess struct {
+	Principal string
+	Warning   string `json:",omitempty"`
+	Access    map[string][]*accessGrant
+}
+
+type accessGrant struct {
+	Role       string
+	Policies   string
+	Expires    expTime
+	Conditions string `json:",omitempty"`
+}
+
+// matrix converts report r into a principal-by-account matrix.
+func (r *accessReport) matrix() *accessMatrix {
+	m := &accessMatrix{Accounts: r.Accounts}
+	var pa *principalAccess
+	for _, g := range r.Grants {
+		if g.Error != "" {
+			continue
+		}
+		if pa == nil || pa.Principal != g.Principal {
+			pa = &principalAccess{
+				Principal: g.Principal,
+				Warning:   g.Warning,
+				Access:    make(map[string][]*accessGrant),
+			}
+			m.Principals = append(m.Principals, pa)
+		}
+		pa.Access[g.Account] = append(pa.Access[g.Account], &accessGrant{
+			Role:       g.Role,
+			Policies:   g.Policies,
+			Expires:    g.Expires,
+			Conditions: g.Conditions,
+		})
+	}
+	return m
+}
+
+// cells returns the table representation of matrix m, starting with the
+// header. Expiration times are absolute if abs is true or relative otherwise.
+// Account errors are reported in the last row.
+func (m *accessMatrix) cells(abs bool) [][]string {
+	hdr := []string{"Principal", "Warning"}
+	errs := []string{"ERROR", ""}
+	hasErr := false
+	for _, ac := range m.Accounts {
+		name := ac.Name
+		if name == "" {
+			name = ac.Account
+		}
+		hdr = append(hdr, name)
+		errs = append(errs, ac.Error)
+		hasErr = hasErr || ac.Error != ""
+	}
+	out := [][]string{hdr}
+	for _, pa := range m.Principals {
+		row := []string{pa.Principal, pa.Warning}
+		for _, ac := range m.Accounts {
+			grants := pa.Access[ac.Account]
+			cell := make([]string, len(grants))
+			for i, g := range grants {
+				cell[i] = g.cell(abs)
+			}
+			row = append(row, strings.Join(cell, "; "))
+		}
+		out = append(out, row)
+	}
+	if hasErr {
+		out = append(out, errs)
+	}
+	return out
+}
+
+// cell returns the matrix cell representation of grant g.
+func (g *accessGrant) cell(abs bool) string {
+	s := arn.ARN(g.Role).Name()
+	if g.Policies != "" {
+		s += " (" + g.Policies + ")"
+	}
+	if !g.Expires.IsZero() {
+		if abs {
+			s += " [expires " + g.Expires.UTC().Format(time.RFC3339) + "]"
+		} else {
+			s += " [expires in " + g.Expires.String() + "]"
+		}
+	}
+	if g.Conditions != "" {
+		s += " [if " + g.Conditions + "]"
+	}
+	return s
+}
+
+// grantCSV returns the CSV representation of individual grants.
+func grantCSV(grants []*accessOutput) [][]string {
+	out := [][]string{{"Principal", "Account", "Name", "Role", "Policies",
+		"Expires", "Conditions", "Warning", "Error"}}
+	for _, r := range grants {
+		exp := ""
+		if !r.Expires.IsZero() {
+			exp = r.Expires.UTC().Format(time.RFC3339)
+		}
+		out = append(out, []string{r.Principal, r.Account, r.Name, r.Role,
+			r.Policies, exp, r.Conditions, r.Warning, r.Error})
+	}
+	return out
+}
+
+// writeCSV writes records to w in CSV format.
+func writeCSV(w io.Writer, records [][]string) error {
+	cw := csv.NewWriter(w)
+	cw.WriteAll(records)
+	return errors.Wrap(cw.Error(), "failed to write CSV output")
+}
+
+// writeTable writes records to w as an aligned table. The first record is the
+// header, which is followed by a separator line.
+func writeTable(w io.Writer, records [][]string) error {
+	if len(records) == 0 {
+		return nil
+	}
+	width := make([]int, len(records[0]))
+	for _, r := range records {
+		for i, s := range r {
+			if width[i] < len(s) {
+				width[i] = len(s)
+			}
+		}
+	}
+	sep := make([]string, len(width))
+	for i, n := range width {
+		sep[i] = strings.Repeat("-", n)
+	}
+	records = append(records[:1:1], append([][]string{sep}, records[1:]...)...)
+	var b strings.Builder
+	for _, r := range records {
+		for i, s := range r {
+			b.WriteString(s)
+			if i < len(r)-1 {
+				b.WriteString(strings.Repeat(" ", width[i]-len(s)+2))
+			}
+		}
+		b.WriteByte('\n')
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// roleAccess returns one row for each principal that is allowed to assume each
+// role under the specified path.
+func roleAccess(c iamx.Client, path string) ([]*accessOutput, error) {
+	roles, err := listRoles(c, path)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([][]*accessOutput, len(roles))
+	err = fast.ForEachIO(len(roles), func(i int) error {
+		role := &roles[i]
+		pols, err := attachedPolicies(c, role.RoleName)
+		if err != nil {
+			return err
+		}
+		pol, err := iamx.ParsePolicy(role.AssumeRolePolicyDocument)
+		if err != nil {
+			return errors.Wrapf(err, "invalid AssumeRole policy for %s",
+				aws.StringValue(role.RoleName))
+		}
+		for _, g := range trustedPrincipals(pol) {
+			rows[i] = append(rows[i], &accessOutput{
+				Principal:  g.principal,
+				Role:       aws.StringValue(role.Arn),
+				Policies:   pols,
+				Expires:    expTime{g.expires},
+				Conditions: strings.Join(g.conds, ","),
+				Warning:    principalWarning(g.principal),
+			})
+		}
+		return nil
+	})
+	var out []*accessOutput
+	for _, r := range rows {
+		out = append(out, r...)
+	}
+	return out, err
+}
+
+// listRoles returns all roles under the specified path.
+func listRoles(c iamx.Client, path string) ([]iam.Role, error) {
+	in := iam.ListRolesInput{PathPrefix: aws.String(path)}
+	r := c.ListRolesRequest(&in)
+	p := r.Paginate()
+	var roles []iam.Role
+	for p.Next() {
+		roles = append(roles, p.CurrentPage().Roles...)
+	}
+	return roles, p.Err()
+}
+
+// attachedPolicies returns a sorted, comma-separated list of managed policy
+// names attached to the specified role.
+func attachedPolicies(c iamx.Client, role *string) (string, error) {
+	in := iam.ListAttachedRolePoliciesInput{RoleName: role}
+	r := c.ListAttachedRolePoliciesRequest(&in)
+	p := r.Paginate()
+	var names []string
+	for p.Next() {
+		for _, pol := range p.CurrentPage().AttachedPolicies {
+			names = append(names, aws.StringValue(pol.PolicyName))
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ","), p.Err()
+}
+
+// roleGrant is a principal that is allowed to assume a role until the
+// expiration time, if any, subject to the listed condition keys.
+type roleGrant struct {
+	principal string
+	expires   time.Time
+	conds     []string
+}
+
+// less returns true if grant g is more restricted than o. Unconditional grants
+// are less restricted than conditional ones, then later expiration wins.
+func (g *roleGrant) less(o *roleGrant) bool {
+	if (len(g.conds) == 0) != (len(o.conds) == 0) {
+		return len(g.conds) != 0
+	}
+	return !g.expires.IsZero() && (o.expires.IsZero() || o.expires.After(g.expires))
+}
+
+// trustedPrincipals returns all AWS, federated, and service principals that are
+// allowed to assume a role with the AssumeRole policy p. If a principal is listed in
+// multiple Allow statements, the least restricted grant is returned. Expired
+// Allow statements are ignored. An Allow statement with NotPrincipal is reported
+// as a conditional grant to "*". Principals that an unconditional Deny statement
+// applies to are removed, and the condition keys of a conditional Deny
+// statement are added to the grants that it may apply to. Principals are
+// compared literally.
+func trustedPrincipals(p *iamx.Policy) []roleGrant {
+	grants := make(map[string]*roleGrant)
+	for _, s := range p.Statement {
+		if s.Effect != iamx.Allow {
+			continue
+		}
+		g := roleGrant{expires: stmtExpiry(s), conds: stmtConds(s, "")}
+		if !g.expires.IsZero() && !fast.Time().Before(g.expires) {
+			continue
+		}
+		var ids []string
+		if s.NotPrincipal != nil {
+			ids = []string{"*"}
+			g.conds = append(g.conds, "NotPrincipal")
+		} else if s.Principal != nil {
+			ids = principalIDs(s.Principal)
+		}
+		for _, id := range ids {
+			if prev := grants[id]; prev == nil || prev.less(&g) {
+				cpy := g
+				cpy.principal = id
+				grants[id] = &cpy
+			}
+		}
+	}
+	for _, s := range p.Statement {
+		if s.Effect != iamx.Deny || (s.Principal == nil && s.NotPrincipal == nil) {
+			continue
+		}
+		conds := stmtConds(s, "deny ")
+		for id, g := range grants {
+			if !denies(s, id) {
+				continue
+			}
+			if len(s.Condition) == 0 {
+				delete(grants, id)
+			} else {
+				g.conds = append(g.conds, conds...)
+			}
+		}
+	}
+	all := make([]roleGrant, 0, len(grants))
+	for _, g := range grants {
+		sort.Strings(g.conds)
+		g.conds = dedupSorted(g.conds)
+		all = append(all, *g)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].principal < all[j].principal
+	})
+	return all
+}
+
+// principalIDs returns the AWS, federated, and service ids of principal p,
+// including "*" for the wildcard principal.
+func principalIDs(p *iamx.Principal) []string {
+	ids := append([]string(nil), p.AWS...)
+	ids = append(ids, p.Federated...)
+	ids = append(ids, p.Service...)
+	if p.Any {
+		ids = append(ids, "*")
+	}
+	return ids
+}
+
+// denies returns true if Deny statement s applies to principal id.
+func denies(s *iamx.Statement, id string) bool {
+	p, match := s.Principal, true
+	if p == nil {
+		p, match = s.NotPrincipal, false
+	}
+	for _, v := range principalIDs(p) {
+		if v == "*" || v == id {
+			return match
+		}
+	}
+	return !match
+}
+
+// stmtConds returns the sorted condition keys of statement s, each with the
+// specified prefix. The expiration condition set by 'authz -expires' is
+// excluded for Allow statements because it is reported separately.
+func stmtConds(s *iamx.Statement, prefix string) []string {
+	var conds []string
+	for typ, c := range s.Condition {
+		for key := range c {
+			if s.Effect == iamx.Allow && typ == expiryCondType &&
+				key == expiryCondKey {
+				continue
+			}
+			conds = append(conds, prefix+key)
+		}
+	}
+	sort.Strings(conds)
+	return conds
+}
+
+// dedupSorted removes adjacent duplicates from the sorted slice v.
+func dedupSorted(v []string) []string {
+	if len(v) < 2 {
+		return v
+	}
+	out := v[:1]
+	for _, s := range v[1:] {
+		if s != out[len(out)-1] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// principalWarning returns a warning if principal p grants access to an entire
+// account or to anyone.
+func principalWarning(p string) string {
+	if p == "*" {
+		return "ANY PRINCIPAL"
+	}
+	if r := arn.ARN(p); account.IsID(p) ||
+		(r.Valid() && r.Service() == "iam" && r.Resource() == "root") {
+		return "ENTIRE ACCOUNT"
+	}
+	return ""
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mxk/go-cloud/aws/iamx"
+	"github.com/mxk/oktapus/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccess(t *testing.T) {
+	ctx, _ := mockOrg(mock.Ctx, "test1", "test2")
+	authz := authzCli.New().(*authzCmd)
+	authz.Spec = "test1,test2"
+	authz.Policy = "ReadOnlyAccess"
+	authz.Principals = []string{"user/user1"}
+	_, err := authz.Run(ctx)
+	require.NoError(t, err)
+	authz = authzCli.New().(*authzCmd)
+	authz.Spec = "test1"
+	authz.Role = "shared"
+	authz.Principals = []string{"123456789012"}
+	_, err = authz.Run(ctx)
+	require.NoError(t, err)
+
+	cmd := accessCli.New().(*accessCmd)
+	cmd.Spec = "test1,test2"
+	out, err := cmd.Run(ctx)
+	require.NoError(t, err)
+	want := []*accessOutput{{
+		Principal: "123456789012",
+		Account:   "000000000001",
+		Name:      "test1",
+		Role:      "arn:aws:iam::000000000001:role/oktapus/shared",
+		Policies:  "AdministratorAccess",
+		Warning:   "ENTIRE ACCOUNT",
+	}, {
+		Principal: "arn:aws:iam::000000000000:user/user1",
+		Account:   "000000000001",
+		Name:      "test1",
+		Role:      "arn:aws:iam::000000000001:role/oktapus/user1",
+		Policies:  "ReadOnlyAccess",
+	}, {
+		Principal: "arn:aws:iam::000000000000:user/user1",
+		Account:   "000000000002",
+		Name:      "test2",
+		Role:      "arn:aws:iam::000000000002:role/oktapus/user1",
+		Policies:  "ReadOnlyAccess",
+	}}
+	r := out.(*accessReport)
+	assert.Equal(t, want, r.Grants)
+
+	assert.Equal(t, [][]string{
+		{"Principal", "Warning", "test1", "test2"},
+		{"123456789012", "ENTIRE ACCOUNT", "shared (AdministratorAccess)", ""},
+		{"arn:aws:iam::000000000000:user/user1", "",
+			"user1 (ReadOnlyAccess)", "user1 (ReadOnlyAccess)"},
+	}, r.matrix().cells(false))
+
+	var b bytes.Buffer
+	require.NoError(t, writeTable(&b, [][]string{{"A", "Bb"}, {"ccc", "d"}}))
+	assert.Equal(t, "A    Bb\n---  --\nccc  d\n", b.String())
+}
+
+func TestPrincipalWarning(t *testing.T) {
+	assert.Equal(t, "ANY PRINCIPAL", principalWarning("*"))
+	assert.Equal(t, "ENTIRE ACCOUNT", principalWarning("123456789012"))
+	assert.Equal(t, "ENTIRE ACCOUNT",
+		principalWarning("arn:aws:iam::123456789012:root"))
+	assert.Equal(t, "",
+		principalWarning("arn:aws:iam::123456789012:user/alice"))
+}
+
+func TestTrustedPrincipals(t *testing.T) {
+	exp := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	doc := `{"Statement":[
+		{"Effect":"Allow","Principal":{"AWS":["a","b","c","d"]}},
+		{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"}},
+		{"Effect":"Allow","Principal":{"AWS":"e"},
+			"Condition":{"Bool":{"aws:MultiFactorAuthPresent":"true"}}},
+		{"Effect":"Allow","Principal":{"AWS":"e"},
+			"Condition":{"DateLessThan":{"aws:CurrentTime":"2030-01-01T00:00:00Z"}}},
+		{"Effect":"Allow","Principal":{"AWS":"f"},
+			"Condition":{"StringEquals":{"sts:ExternalId":"x"}}},
+		{"Effect":"Allow","NotPrincipal":{"AWS":"g"}},
+		{"Effect":"Allow","Principal":{"AWS":"h"},
+			"Condition":{"DateLessThan":{"aws:CurrentTime":"2000-01-01T00:00:00Z"}}},
+		{"Effect":"Deny","Principal":{"AWS":"b"}},
+		{"Effect":"Deny","Principal":{"AWS":"c"},
+			"Condition":{"IpAddress":{"aws:SourceIp":"10.0.0.0/8"}}},
+		{"Effect":"Deny","NotPrincipal":{"AWS":["a","c","e","f"],
+			"Service":"ec2.amazonaws.com"}}
+	]}`
+	pol, err := iamx.ParsePolicy(&doc)
+	require.NoError(t, err)
+	want := []roleGrant{
+		{principal: "a"},
+		{principal: "c", conds: []string{"deny aws:SourceIp"}},
+		{principal: "e", expires: exp},
+		{principal: "ec2.amazonaws.com"},
+		{principal: "f", conds: []string{"sts:ExternalId"}},
+	}
+	assert.Equal(t, want, trustedPrincipals(pol))
+}
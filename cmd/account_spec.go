@@ -63,6 +63,10 @@ func (accountSpecCmd) Help(w *cli.Writer) {
 
 	  "all"
 	      List inaccessible and uninitialized accounts.
+
+	  "org=prod,org=sandbox"
+	      Matches accounts from the "prod" or "sandbox" gateways when multiple
+	      gateways are configured (see "gateways" config file key).
 	`)
 }
 
@@ -23,6 +23,7 @@ var allocCli = cli.Main.Add(&cli.Info{
 type allocCmd struct {
 	OutFmt
 	Owner string `flag:"Set owner <name>"`
+	Team  string `flag:"Set owner team <name>"`
 	Num   int
 	Spec  string
 }
@@ -45,6 +46,40 @@ func (*allocCmd) Help(w *cli.Writer) {
 	spec. One or the other may be omitted, but not both. If the number is not
 	specified, all free matching accounts are allocated. Otherwise, the
 	requested number of random accounts are allocated from the match pool.
+	Accounts in maintenance (see 'tag -maint') are never allocated.
+
+	Use -team to share ownership with other members of a team. Team membership
+	is defined in the config file:
+
+	  [teams]
+	  infra = ["alice", "bob"]
+
+	The 'owner=me' account spec matches accounts owned by you or by any of your
+	teams, and team members may free or transfer each other's accounts. You must
+	be a member of the team. Each user's own config file defines their teams, so
+	membership is a convention that the whole organization must share; it is
+	checked only by oktapus and not enforced by AWS.
+
+	Allocating accounts for someone else with -owner is limited to account
+	admins (see 'tag -admins'). Free accounts where you are not an admin are
+	reported with an error and are not allocated.
+
+	Hooks are external commands that run for accounts with matching tags. They
+	are defined in the config file as arrays containing the program name and
+	its arguments:
+
+	  [hooks.post_alloc]
+	  sandbox = ["/usr/local/bin/reset-baseline", "--quiet"]
+
+	  [hooks.pre_free]
+	  sandbox = ["/usr/local/bin/empty-buckets"]
+
+	post_alloc hooks run after account ownership is verified. pre_free hooks
+	run when the account is freed, before the owner is cleared. Hooks are
+	executed with account credentials, like the exec command, and
+	OKTAPUS_ACCOUNT_ID and OKTAPUS_ACCOUNT_NAME are set. Hook output is
+	discarded, except for the last line of a failed hook, which is reported in
+	the result. Accounts remain allocated if a hook fails.
 	`)
 	accountSpecHelp(w)
 }
@@ -66,20 +101,34 @@ func (cmd *allocCmd) Main(args []string) error {
 
 func (cmd *allocCmd) Run(ctx *op.Ctx) (interface{}, error) {
 	// Find free accounts and randomize their order
+	me := ctx.Role().Name()
+	if cmd.Team != "" && !hasTeam(ctx.UserTeams(me), cmd.Team) {
+		return nil, errors.Errorf("not a member of team %q", cmd.Team)
+	}
 	acs, err := ctx.Match(cmd.Spec)
 	if err != nil {
 		return nil, err
 	}
+	if cmd.Owner == "" {
+		cmd.Owner = me
+	}
+	var denied op.Accounts
 	acs = acs.Filter(func(ac *op.Account) bool {
-		return ac.CtlValid() && ac.Ctl.Owner == "" && ac.Err == nil
+		if !ac.CtlValid() || ac.Ctl.Owner != "" || ac.Ctl.InMaint() ||
+			ac.Err != nil {
+			return false
+		}
+		if cmd.Owner != me && !ac.Ctl.IsAdmin(me, ctx.Admins) {
+			ac.Err = op.ErrNotAdmin
+			denied = append(denied, ac)
+			return false
+		}
+		return true
 	})
 	rand.Seed(int64(fast.RandUint64()))
 	rand.Shuffle(len(acs), func(i, j int) { acs[i], acs[j] = acs[j], acs[i] })
 
 	// Allocate in batches
-	if cmd.Owner == "" {
-		cmd.Owner = ctx.Role().Name()
-	}
 	if cmd.Num == 0 {
 		cmd.Num = len(acs)
 	}
@@ -91,10 +140,14 @@ func (cmd *allocCmd) Run(ctx *op.Ctx) (interface{}, error) {
 				if ac.Err != nil {
 					return false
 				}
-				ac.Ctl.Owner = ""
+				ac.Ctl.Owner, ac.Ctl.Team = "", ""
 				return true
 			}).StoreCtl()
 			n -= len(acs)
+			if len(denied) > 0 {
+				return nil, errors.Wrapf(op.ErrNotAdmin,
+					"not enough accounts, need %d more", n)
+			}
 			return nil, errors.Errorf("not enough accounts, need %d more", n)
 		}
 
@@ -102,28 +155,75 @@ func (cmd *allocCmd) Run(ctx *op.Ctx) (interface{}, error) {
 		batch := acs[:n]
 		acs = acs[n:]
 		for _, ac := range batch {
-			ac.Ctl.Owner = cmd.Owner
+			ac.Ctl.Owner, ac.Ctl.Team = cmd.Owner, cmd.Team
 		}
 		batch.StoreCtl()
 
-		// Verify owner after a delay to allow changes to propagate. Delay was
-		// selected by running 1,100 mutex-test trials with 50 threads without
-		// seeing any inconsistencies.
-		fast.Sleep(10 * time.Second)
-		for _, ac := range batch.LoadCtl(true) {
-			if ac.Err == nil {
-				if ac.Ctl.Owner == cmd.Owner {
-					n--
-				} else {
-					ac.Err = op.ErrCtlUpdate
-				}
-			}
-		}
+		n -= verifyOwner(batch, cmd.Owner)
 		out = append(out, batch...)
 	}
+
+	// Run post-alloc hooks
+	out.Map(func(_ int, ac *op.Account) error {
+		if ac.Err != nil {
+			return nil
+		}
+		return runHooks(ctx, ac, "post_alloc", ctx.Hooks.PostAlloc)
+	})
+	out = append(out, denied...)
 	return listOwners(out.SortByName()), nil
 }
 
+// verifyOwner confirms that owner is set for all accounts after a delay to
+// allow changes to propagate. It returns the number of confirmed accounts. The
+// delay was selected by running 1,100 mutex-test trials with 50 threads
+// without seeing any inconsistencies.
+func verifyOwner(acs op.Accounts, owner string) int {
+	fast.Sleep(10 * time.Second)
+	n := 0
+	for _, ac := range acs.LoadCtl(true) {
+		if ac.Err == nil {
+			if ac.Ctl.Owner == owner {
+				n++
+			} else {
+				ac.Err = op.ErrCtlUpdate
+			}
+		}
+	}
+	return n
+}
+
+// ownedFilter returns a filter function that selects allocated accounts owned
+// by the current user or one of their teams. If force is set, accounts owned by
+// others are also selected, but ErrNotAdmin is set for accounts where the user
+// is not an admin.
+func ownedFilter(ctx *op.Ctx, force bool) func(ac *op.Account) bool {
+	me := ctx.Role().Name()
+	teams := ctx.UserTeams(me)
+	return func(ac *op.Account) bool {
+		if !ac.CtlValid() || ac.Ctl.Owner == "" {
+			return false
+		}
+		if ac.Ctl.OwnedBy(me, teams) {
+			return true
+		}
+		if force && !ac.Ctl.IsAdmin(me, ctx.Admins) {
+			ac.Err = op.ErrNotAdmin
+		}
+		return force
+	}
+}
+
+// hasTeam returns true if teams contains team.
+func hasTeam(teams []string, team string) bool {
+	for _, t := range teams {
+		if t == team {
+			return true
+		}
+	}
+	return false
+}
+
 type ownerOutput struct {
 	Account string
 	Name    string
@@ -1,8 +1,10 @@
 package cmd
 
 import (
+	"os"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/mxk/go-fast"
 	"github.com/mxk/oktapus/mock"
 	"github.com/mxk/oktapus/op"
@@ -44,3 +46,87 @@ func TestAlloc(t *testing.T) {
 	assert.EqualError(t, err, "not enough accounts, need 1 more")
 	assert.Nil(t, out)
 }
+
+func TestAllocHooks(t *testing.T) {
+	fast.MockSleep(-1)
+	defer fast.MockSleep(0)
+
+	ctx, w := mockOrg(mock.Ctx, "test1", "test2")
+	setCtl(w, op.Ctl{Tags: op.Tags{"test"}}, "1", "2")
+	ctx.Hooks.PostAlloc = map[string][]string{
+		"test": {os.Args[0], "-test.run=TestExec"},
+	}
+	os.Setenv(testEnv, "hook")
+	defer os.Unsetenv(testEnv)
+
+	cmd := allocCmd{Spec: "test"}
+	out, err := cmd.Run(ctx)
+	require.NoError(t, err)
+	want := []*ownerOutput{{
+		Account: "000000000001",
+		Name:    "test1",
+		Owner:   "alice",
+		Result:  "OK",
+	}, {
+		Account: "000000000002",
+		Name:    "test2",
+		Owner:   "alice",
+		Result: "ERROR: post_alloc hook failed: exit status 1 " +
+			"(AWS_SESSION_TOKEN=arn:aws:sts::000000000002:assumed-role/alice/alice)",
+	}}
+	assert.Equal(t, want, out)
+}
+
+func TestAllocTeam(t *testing.T) {
+	fast.MockSleep(-1)
+	defer fast.MockSleep(0)
+
+	ctx, w := mockOrg(mock.Ctx, "test1", "test2", "test3", "test4")
+	setCtl(w, op.Ctl{Tags: op.Tags{"test"}}, "1")
+	setCtl(w, op.Ctl{Tags: op.Tags{"test"}, Admins: []string{"bob"}}, "2")
+	setCtl(w, op.Ctl{Tags: op.Tags{"other"}}, "4")
+	ctx.Teams = map[string][]string{"infra": {"alice", "bob"}, "dev": {"bob"}}
+
+	cmd := allocCmd{Team: "dev", Spec: "test"}
+	_, err := cmd.Run(ctx)
+	assert.EqualError(t, err, `not a member of team "dev"`)
+
+	// Only admins may allocate for others, and everyone is an admin of
+	// accounts without an admins list if there are no organization admins
+	cmd = allocCmd{Owner: "bob", Team: "infra", Spec: "test"}
+	out, err := cmd.Run(ctx)
+	require.NoError(t, err)
+	want := []*ownerOutput{{
+		Account: "000000000001",
+		Name:    "test1",
+		Owner:   "bob",
+		Result:  "OK",
+	}, {
+		Account: "000000000002",
+		Name:    "test2",
+		Result:  "ERROR: " + op.ErrNotAdmin.Error(),
+	}}
+	assert.Equal(t, want, out)
+
+	// Organization admins administer accounts without an admins list
+	ctx.Admins = []string{"carol"}
+	cmd = allocCmd{Owner: "bob", Num: 1, Spec: "other"}
+	_, err = cmd.Run(ctx)
+	assert.EqualError(t, err, "not enough accounts, need 1 more: "+
+		op.ErrNotAdmin.Error())
+
+	var ctl op.Ctl
+	role := w.Account("1").RoleRouter()[op.CtlRole]
+	require.NoError(t, ctl.Decode(aws.StringValue(role.Description)))
+	assert.Equal(t, "infra", ctl.Team)
+
+	cmd = allocCmd{Owner: "alice", Num: 1, Spec: "test"}
+	_, err = cmd.Run(ctx)
+	assert.EqualError(t, err, "not enough accounts, need 1 more")
+
+	// Team accounts match owner=me
+	acs, err := ctx.Match("owner=me")
+	require.NoError(t, err)
+	require.Len(t, acs, 1)
+	assert.Equal(t, "test1", acs[0].Name)
+}
@@ -2,6 +2,13 @@ package cmd
 
 import (
 	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
@@ -16,18 +23,29 @@ import (
 
 var authzCli = cli.Main.Add(&cli.Info{
 	Name:    "authz",
-	Usage:   "[options] account-spec principal [principal ...]",
+	Usage:   "[options] account-spec [principal ...]",
 	Summary: "Authorize role-based account access",
-	MinArgs: 2,
+	MinArgs: 1,
 	New:     func() cli.Cmd { return &authzCmd{Policy: "AdministratorAccess"} },
 })
 
 type authzCmd struct {
 	OutFmt
-	Desc       *string `flag:"Role <description>"`
-	Policy     string  `flag:"Attach managed policy <name> or ARN"`
-	Role       string  `flag:"Role <name> with optional path"`
-	Tmp        bool    `flag:"Delete role(s) automatically when the account is freed"`
+	Boundary   string        `flag:"Set permissions boundary to managed policy <name> or ARN"`
+	CopyFrom   string        `flag:"copy-from,Copy role from <account:role> to all matching accounts"`
+	Desc       *string       `flag:"Role <description>"`
+	Expires    time.Duration `flag:"Remove principals after <duration> (see sweep)"`
+	ExternalID string        `flag:"external-id,Require external <id> to assume the role"`
+	MaxSession time.Duration `flag:"max-session,Maximum role session <duration> (1h to 12h)"`
+	OIDCAud    string        `flag:"oidc-aud,Require web identity token <audience>"`
+	OIDCSub    string        `flag:"oidc-sub,Require web identity token <subject> (may contain wildcards)"`
+	Policy     string        `flag:"Attach managed policy <name> or ARN"`
+	PolicyFile string        `flag:"policy-file,Put inline policy from JSON <file>"`
+	Prune      bool          `flag:"Remove policies and principals not in the -copy-from role"`
+	RequireMFA bool          `flag:"require-mfa,Require MFA to assume the role"`
+	Role       string        `flag:"Role <name> with optional path"`
+	SourceIP   string        `flag:"source-ip,Restrict AssumeRole to comma-separated IP <cidrs>"`
+	Tmp        bool          `flag:"Delete role(s) automatically when the account is freed"`
 	Spec       string
 	Principals []string
 }
@@ -44,7 +62,8 @@ func (*authzCmd) Help(w *cli.Writer) {
 	created or updated.
 
 	If a role with a matching name and path already exists, new principals are
-	added to its AssumeRole policy without any other changes.
+	added to its AssumeRole policy without any other changes. Use 'unauthz' to
+	remove principals.
 
 	Principal examples:
 
@@ -54,10 +73,44 @@ func (*authzCmd) Help(w *cli.Writer) {
 	  123456789012
 	  123456789012:user/path/user-name
 	  role/role-name
+	  Federated:arn:aws:iam::123456789012:oidc-provider/example.com
+	  Federated:accounts.google.com
+	  Service:lambda.amazonaws.com
 
-	The -role option is required if one of the principals is an account ID. The
-	ARN prefix up to the resource may be omitted. Account ID defaults to the
-	current gateway account if not specified.
+	The -role option is required if one of the principals is an account ID, a
+	federated principal, or a service principal. The ARN prefix up to the
+	resource may be omitted. Account ID defaults to the current gateway account
+	if not specified. Federated principals are allowed to call
+	AssumeRoleWithSAML or AssumeRoleWithWebIdentity, depending on the provider
+	type.
+
+	The -require-mfa, -external-id, and -source-ip options add trust policy
+	conditions for AWS principals. Web identity (OIDC) principals require
+	-oidc-aud, which limits the role to tokens issued for that audience
+	(client ID). Shared providers, such as accounts.google.com or
+	token.actions.githubusercontent.com, issue tokens to anyone, so they also
+	require -oidc-sub to limit the role to specific subjects (e.g.
+	"repo:org/repo:*"). The -expires option adds a condition that
+	prevents all principals from assuming the role after the specified
+	duration. Granting access to a principal again replaces any existing
+	time-bound grants for that principal. Use 'sweep' to remove expired
+	principals and delete roles that no longer have any. The -boundary,
+	-max-session, -policy, and -policy-file options only apply to new roles.
+	The -policy-file option puts an inline policy named after the file.
+	Customer-managed policies may be attached by specifying their ARN with
+	-policy.
+
+	The -copy-from option replicates an existing role from a reference account
+	to all matching accounts. The path, description, maximum session duration,
+	permissions boundary, trust policy, and all attached and inline policies
+	are copied. Customer-managed policies of the reference account are replaced
+	with policies of the same name in each target account, so they must already
+	exist there. Existing roles are updated to match the reference role, and
+	any differences are reported as drift. Attached and inline policies and
+	trusted principals that are not in the reference role are reported as EXTRA
+	and left in place, unless -prune is specified. Principals, if specified,
+	are added to the copied trust policy. Other role options, except -oidc-aud and -oidc-sub,
+	cannot be combined with -copy-from.
 	`)
 	accountSpecHelp(w)
 }
@@ -65,14 +118,51 @@ func (*authzCmd) Help(w *cli.Writer) {
 func (cmd *authzCmd) Main(args []string) error {
 	cmd.Spec = args[0]
 	cmd.Principals = args[1:]
+	if len(cmd.Principals) == 0 && cmd.CopyFrom == "" {
+		return cli.Error("at least one principal required")
+	}
 	return op.RunAndPrint(cmd)
 }
 
 func (cmd *authzCmd) Run(ctx *op.Ctx) (interface{}, error) {
+	if cmd.CopyFrom != "" {
+		return cmd.copyRole(ctx)
+	} else if cmd.Prune {
+		return nil, cli.Error("-prune requires -copy-from")
+	}
 	attachPolicy, err := getManagedPolicy(ctx.Ident().Partition(), cmd.Policy)
 	if err != nil {
 		return nil, err
-	} else if err := cmd.checkPrincipals(ctx.Ident().Ctx()); err != nil {
+	}
+	boundary, err := getManagedPolicy(ctx.Ident().Partition(), cmd.Boundary)
+	if err != nil {
+		return nil, err
+	}
+	put, err := cmd.inlinePolicy()
+	if err != nil {
+		return nil, err
+	}
+	tc, err := cmd.trustConditions()
+	if err != nil {
+		return nil, err
+	}
+	var maxSession *int64
+	if cmd.MaxSession != 0 {
+		if cmd.MaxSession < time.Hour || 12*time.Hour < cmd.MaxSession {
+			return nil, cli.Error("-max-session must be between 1h and 12h")
+		}
+		maxSession = aws.Int64(int64(cmd.MaxSession / time.Second))
+	}
+	var exp time.Time
+	if cmd.Expires < 0 {
+		return nil, cli.Error("-expires must be positive")
+	} else if cmd.Expires > 0 {
+		exp = fast.Time().Add(cmd.Expires)
+	}
+	if err := cmd.checkPrincipals(ctx.Ident().Ctx()); err != nil {
+		return nil, err
+	}
+	if err := checkWebIdentity(cmd.Principals, tc); err != nil {
 		return nil, err
 	}
 
@@ -88,7 +178,8 @@ func (cmd *authzCmd) Run(ctx *op.Ctx) (interface{}, error) {
 				return nil, fmt.Errorf("duplicate role name %q", name)
 			}
 			dup[name] = true
-			roles[i] = newRoleAuthz(path, name, attachPolicy, p)
+			roles[i] = newRoleAuthz(path, name, attachPolicy,
+				trustStatements([]string{p}, tc, exp))
 		}
 	} else {
 		path, name, err := splitPathName(cmd.Role, cmd.Tmp)
@@ -96,11 +187,18 @@ func (cmd *authzCmd) Run(ctx *op.Ctx) (interface{}, error) {
 			return nil, err
 		}
 		roles = []*roleAuthz{newRoleAuthz(path, name, attachPolicy,
-			cmd.Principals...)}
+			trustStatements(cmd.Principals, tc, exp))}
 	}
-	if cmd.Desc != nil {
-		for _, r := range roles {
-			r.create.Description = cmd.Desc
+	for _, r := range roles {
+		r.create.Description = cmd.Desc
+		r.create.MaxSessionDuration = maxSession
+		if boundary != "" {
+			r.create.PermissionsBoundary = arn.String(boundary)
+		}
+		if put != nil {
+			in := *put
+			in.RoleName = r.create.RoleName
+			r.put = &in
 		}
 	}
 
@@ -162,14 +260,125 @@ func (cmd *authzCmd) Run(ctx *op.Ctx) (interface{}, error) {
 type roleOutput struct{ Account, Name, Role, Result string }
 
 func (cmd *authzCmd) checkPrincipals(ctx arn.Ctx) error {
+	return checkPrincipals(ctx, cmd.Principals, cmd.Role != "")
+}
+
+// inlinePolicyName matches valid IAM inline policy names.
+var inlinePolicyName = regexp.MustCompile(`^[\w+=,.@-]{1,128}$`)
+
+// inlinePolicy returns the PutRolePolicy input for -policy-file, if any. The
+// policy is named after the file without its extension.
+func (cmd *authzCmd) inlinePolicy() (*iam.PutRolePolicyInput, error) {
+	if cmd.PolicyFile == "" {
+		return nil, nil
+	}
+	name := filepath.Base(cmd.PolicyFile)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	if !inlinePolicyName.MatchString(name) {
+		return nil, fmt.Errorf("invalid inline policy name %q", name)
+	}
+	b, err := ioutil.ReadFile(cmd.PolicyFile)
+	if err != nil {
+		return nil, err
+	}
+	pol, err := iamx.ParsePolicy(aws.String(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy in %q (%v)", cmd.PolicyFile, err)
+	}
+	return &iam.PutRolePolicyInput{
+		PolicyDocument: pol.Doc(),
+		PolicyName:     aws.String(name),
+	}, nil
+}
+
+// trustConds are AssumeRole policy conditions for new trust statements.
+type trustConds struct {
+	aws iamx.ConditionMap // Conditions for AWS principals
+	aud string            // Web identity token audience
+	sub string            // Web identity token subject pattern
+}
+
+// trustConditions returns AssumeRole policy conditions set by command options.
+func (cmd *authzCmd) trustConditions() (*trustConds, error) {
+	return newTrustConds(cmd.RequireMFA, cmd.ExternalID, cmd.SourceIP,
+		cmd.OIDCAud, cmd.OIDCSub)
+}
+
+// newTrustConds returns AssumeRole policy conditions that require MFA, an
+// external ID, and/or a source IP from comma-separated CIDRs for AWS
+// principals, and a token audience and subject for web identity principals.
+func newTrustConds(requireMFA bool, externalID, sourceIP, aud, sub string) (*trustConds, error) {
+	c := make(iamx.ConditionMap)
+	if requireMFA {
+		c["Bool"] = iamx.Conditions{
+			"aws:MultiFactorAuthPresent": {"true"},
+		}
+	}
+	if externalID != "" {
+		c["StringEquals"] = iamx.Conditions{
+			"sts:ExternalId": {externalID},
+		}
+	}
+	if sourceIP != "" {
+		ips := strings.Split(sourceIP, ",")
+		for i, ip := range ips {
+			ip = strings.TrimSpace(ip)
+			if _, _, err := net.ParseCIDR(ip); err != nil && net.ParseIP(ip) == nil {
+				return nil, fmt.Errorf("invalid source IP %q", ip)
+			}
+			ips[i] = ip
+		}
+		c["IpAddress"] = iamx.Conditions{"aws:SourceIp": ips}
+	}
+	tc := &trustConds{aud: aud, sub: sub}
+	if len(c) > 0 {
+		tc.aws = c
+	}
+	return tc, nil
+}
+
+// Federated and service principal prefixes.
+const (
+	federatedPrefix = "Federated:"
+	servicePrefix   = "Service:"
+)
+
+// checkPrincipals validates principals and converts them to ARNs in place.
+// Federated and service principals keep their type prefix, and identity
+// provider ARNs get the federated prefix added. Account ID, federated, and
+// service principals are only allowed if haveRole is true.
+func checkPrincipals(ctx arn.Ctx, principals []string, haveRole bool) error {
 	identAccount := ctx.Account
-	for i, p := range cmd.Principals {
+	for i, p := range principals {
 		if account.IsID(p) {
-			if cmd.Role == "" {
+			if !haveRole {
 				return cli.Error("-role required for account ID principal")
 			}
 			continue
 		}
+		if strings.HasPrefix(p, servicePrefix) {
+			if !haveRole {
+				return cli.Error("-role required for service principal")
+			} else if svc := p[len(servicePrefix):]; svc == "" ||
+				strings.ContainsAny(svc, ":/") {
+				return fmt.Errorf("invalid service principal %q", p)
+			}
+			continue
+		}
+		fed := strings.HasPrefix(p, federatedPrefix)
+		if fed {
+			p = p[len(federatedPrefix):]
+			if strings.IndexByte(p, ':') == -1 {
+				// Provider name, such as accounts.google.com
+				if !haveRole {
+					return cli.Error("-role required for federated principal")
+				} else if p == "" || strings.IndexByte(p, '/') != -1 {
+					return fmt.Errorf("invalid federated principal %q",
+						principals[i])
+				}
+				continue
+			}
+		}
 		r := arn.ARN(p)
 		if !r.Valid() {
 			if len(r) > 12 && r[12] == ':' && account.IsID(p[:12]) {
@@ -181,7 +390,11 @@ func (cmd *authzCmd) checkPrincipals(ctx arn.Ctx) error {
 		if ctx.Account = r.Account(); ctx.Account == "" {
 			ctx.Account = identAccount
 		}
-		switch t := r.Type(); t {
+		t := r.Type()
+		if fed && t != "oidc-provider" && t != "saml-provider" {
+			return fmt.Errorf("invalid federated principal %q", principals[i])
+		}
+		switch t {
 		case "user", "role":
 			r = ctx.New("iam", t, r.Path(), r.Name())
 		case "assumed-role":
@@ -190,25 +403,209 @@ func (cmd *authzCmd) checkPrincipals(ctx arn.Ctx) error {
 				return fmt.Errorf("invalid role name %q in %q", path, p)
 			}
 			r = ctx.New("sts", t, path, r.Name())
+		case "oidc-provider", "saml-provider":
+			if !haveRole {
+				return cli.Error("-role required for federated principal")
+			}
+			principals[i] = federatedPrefix + string(ctx.New("iam", r.Resource()))
+			continue
 		default:
 			return fmt.Errorf("invalid principal type %q in %q", t, p)
 		}
-		cmd.Principals[i] = string(r)
+		principals[i] = string(r)
 	}
 	return nil
 }
 
+// trustStatements returns AssumeRole policy statements for principals
+// normalized by checkPrincipals. AWS principals get the AWS conditions of tc and
+// each web identity provider gets its own statement with token audience and
+// subject conditions. If exp is not zero, all statements expire at that time.
+func trustStatements(principals []string, tc *trustConds, exp time.Time) []*iamx.Statement {
+	if tc == nil {
+		tc = new(trustConds)
+	}
+	var ids, svc, web, saml iamx.PolicyMultiVal
+	for _, p := range principals {
+		if strings.HasPrefix(p, servicePrefix) {
+			svc = append(svc, p[len(servicePrefix):])
+		} else if strings.HasPrefix(p, federatedPrefix) {
+			p = p[len(federatedPrefix):]
+			if arn.ARN(p).Valid() && arn.ARN(p).Type() == "saml-provider" {
+				saml = append(saml, p)
+			} else {
+				web = append(web, p)
+			}
+		} else {
+			ids = append(ids, p)
+		}
+	}
+	var stmts []*iamx.Statement
+	add := func(action string, m iamx.PrincipalMap, cond iamx.ConditionMap) {
+		stmts = append(stmts, &iamx.Statement{
+			Effect:    iamx.Allow,
+			Principal: &iamx.Principal{PrincipalMap: m},
+			Action:    iamx.PolicyMultiVal{action},
+			Condition: cond,
+		})
+	}
+	if len(ids) > 0 {
+		add("sts:AssumeRole", iamx.PrincipalMap{AWS: ids}, tc.aws)
+	}
+	if len(svc) > 0 {
+		add("sts:AssumeRole", iamx.PrincipalMap{Service: svc}, nil)
+	}
+	for _, p := range web {
+		add("sts:AssumeRoleWithWebIdentity",
+			iamx.PrincipalMap{Federated: iamx.PolicyMultiVal{p}},
+			webIdentityConditions(p, tc.aud, tc.sub))
+	}
+	if len(saml) > 0 {
+		add("sts:AssumeRoleWithSAML", iamx.PrincipalMap{Federated: saml}, nil)
+	}
+	if !exp.IsZero() {
+		setExpiry(stmts, exp)
+	}
+	return stmts
+}
+
+// sharedWebIdentity contains web identity providers that issue tokens to
+// anyone, so an audience condition alone does not limit who can get one.
+var sharedWebIdentity = map[string]bool{
+	"accounts.google.com":                 true,
+	"gitlab.com":                          true,
+	"graph.facebook.com":                  true,
+	"token.actions.githubusercontent.com": true,
+	"www.amazon.com":                      true,
+}
+
+// webIdentityClaims contains the audience and subject condition key names of
+// providers that do not use "aud" and "sub".
+var webIdentityClaims = map[string][2]string{
+	"graph.facebook.com": {"app_id", "id"},
+	"www.amazon.com":     {"app_id", "user_id"},
+}
+
+// webIdentityProvider returns the condition key prefix of web identity
+// principal p, which is either a provider name or an OIDC provider ARN.
+func webIdentityProvider(p string) string {
+	if r := arn.ARN(p); r.Valid() {
+		return strings.TrimPrefix(r.Resource(), "oidc-provider/")
+	}
+	return p
+}
+
+// webIdentityConditions returns AssumeRoleWithWebIdentity conditions that
+// require token audience aud and, if not empty, a subject matching sub.
+func webIdentityConditions(p, aud, sub string) iamx.ConditionMap {
+	prov := webIdentityProvider(p)
+	claims, ok := webIdentityClaims[prov]
+	if !ok {
+		claims = [2]string{"aud", "sub"}
+	}
+	c := make(iamx.ConditionMap)
+	if aud != "" {
+		c["StringEquals"] = iamx.Conditions{prov + ":" + claims[0]: {aud}}
+	}
+	if sub != "" {
+		c["StringLike"] = iamx.Conditions{prov + ":" + claims[1]: {sub}}
+	}
+	if len(c) == 0 {
+		return nil
+	}
+	return c
+}
+
+// checkWebIdentity verifies that web identity principals normalized by
+// checkPrincipals will get the conditions that they require.
+func checkWebIdentity(principals []string, tc *trustConds) error {
+	if tc == nil {
+		tc = new(trustConds)
+	}
+	for _, p := range principals {
+		if !strings.HasPrefix(p, federatedPrefix) {
+			continue
+		}
+		p = p[len(federatedPrefix):]
+		if r := arn.ARN(p); r.Valid() && r.Type() == "saml-provider" {
+			continue
+		}
+		if tc.aud == "" {
+			return cli.Errorf("-oidc-aud required for web identity "+
+				"principal %q", p)
+		} else if sharedWebIdentity[webIdentityProvider(p)] && tc.sub == "" {
+			return cli.Errorf("-oidc-sub required for shared web identity "+
+				"provider %q", p)
+		}
+	}
+	return nil
+}
+
+// Condition used to limit AssumeRole policy statements to a specific time.
+const (
+	expiryCondType = "DateLessThan"
+	expiryCondKey  = "aws:CurrentTime"
+)
+
+// setExpiry adds an expiration condition to all statements.
+func setExpiry(stmts []*iamx.Statement, t time.Time) {
+	exp := t.UTC().Truncate(time.Second).Format(time.RFC3339)
+	for _, s := range stmts {
+		c := make(iamx.ConditionMap, len(s.Condition)+1)
+		for k, v := range s.Condition {
+			c[k] = v
+		}
+		c[expiryCondType] = iamx.Conditions{expiryCondKey: {exp}}
+		s.Condition = c
+	}
+}
+
+// stmtExpiry returns the expiration time of an AssumeRole policy statement or
+// zero time if the statement does not expire.
+func stmtExpiry(s *iamx.Statement) time.Time {
+	if v := s.Condition[expiryCondType][expiryCondKey]; len(v) == 1 {
+		if t, err := time.Parse(time.RFC3339, v[0]); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// stmtPrincipals returns all principals of the specified statements in the
+// format used by checkPrincipals.
+func stmtPrincipals(stmts ...*iamx.Statement) []string {
+	var all []string
+	for _, s := range stmts {
+		if s.Principal == nil {
+			continue
+		}
+		all = append(all, s.Principal.AWS...)
+		for _, id := range s.Principal.Federated {
+			all = append(all, federatedPrefix+id)
+		}
+		for _, id := range s.Principal.Service {
+			all = append(all, servicePrefix+id)
+		}
+	}
+	return all
+}
+
 // roleAuthz creates new roles and updates existing AssumeRole policies.
 type roleAuthz struct {
 	get    iam.GetRoleInput
 	create iam.CreateRoleInput
 	attach iam.AttachRolePolicyInput
-	trust  *iamx.Statement
+	put    *iam.PutRolePolicyInput
+	trust  []*iamx.Statement
+	ids    []string
 }
 
-func newRoleAuthz(path, name string, attachPolicy arn.ARN, principals ...string) *roleAuthz {
+func newRoleAuthz(path, name string, attachPolicy arn.ARN, trust []*iamx.Statement) *roleAuthz {
 	roleName := aws.String(name)
-	assumeRolePolicy := iamx.AssumeRolePolicy(iamx.Allow, principals...)
+	assumeRolePolicy := &iamx.Policy{
+		Version:   iamx.PolicyVersion2012,
+		Statement: trust,
+	}
 	return &roleAuthz{
 		iam.GetRoleInput{RoleName: roleName},
 		iam.CreateRoleInput{
@@ -220,7 +617,9 @@ func newRoleAuthz(path, name string, attachPolicy arn.ARN, principals ...string)
 			PolicyArn: arn.String(attachPolicy),
 			RoleName:  roleName,
 		},
-		assumeRolePolicy.Statement[0],
+		nil,
+		trust,
+		stmtPrincipals(trust...),
 	}
 }
 
@@ -234,6 +633,9 @@ func (r *roleAuthz) exec(c iamx.Client) (role *iam.Role, created bool, err error
 		if err == nil && arn.Value(r.attach.PolicyArn) != "" {
 			_, err = c.AttachRolePolicyRequest(&r.attach).Send()
 		}
+		if err == nil && r.put != nil {
+			_, err = c.PutRolePolicyRequest(r.put).Send()
+		}
 		return out.Role, true, err
 	}
 
@@ -244,10 +646,16 @@ func (r *roleAuthz) exec(c iamx.Client) (role *iam.Role, created bool, err error
 		return
 	}
 
-	// Merge and update AssumeRole policy
+	// Merge and update AssumeRole policy. New grants replace existing
+	// time-bound grants for the same principals.
 	pol, err := iamx.ParsePolicy(role.AssumeRolePolicyDocument)
 	if err == nil {
-		appendAssumeRolePolicy(pol, r.trust)
+		removePrincipals(pol, r.ids, func(s *iamx.Statement) bool {
+			return !stmtExpiry(s).IsZero()
+		})
+		for _, s := range r.trust {
+			appendAssumeRolePolicy(pol, s)
+		}
 		in := iam.UpdateAssumeRolePolicyInput{
 			PolicyDocument: pol.Doc(),
 			RoleName:       role.RoleName,
@@ -261,13 +669,28 @@ func appendAssumeRolePolicy(p *iamx.Policy, s *iamx.Statement) {
 	for _, t := range p.Statement {
 		// Resources are not allowed, Principal and NotPrincipal are mutually
 		// exclusive and cannot be empty.
-		if t.Effect != s.Effect || t.NotPrincipal != nil ||
-			!t.Action.Equal(s.Action) || len(t.Condition) != 0 {
+		if t.Effect != s.Effect || t.Principal == nil || t.Principal.Any ||
+			!t.Action.Equal(s.Action) || !conditionsEqual(t.Condition, s.Condition) {
 			continue
 		}
 		// Duplicates get merged by AWS
-		t.Principal.AWS = append(t.Principal.AWS, s.Principal.AWS...)
+		m, n := &t.Principal.PrincipalMap, &s.Principal.PrincipalMap
+		m.AWS = append(m.AWS, n.AWS...)
+		m.Federated = append(m.Federated, n.Federated...)
+		m.Service = append(m.Service, n.Service...)
 		return
 	}
-	p.Statement = append(p.Statement, s)
+	// s may be shared by multiple policies, so it must not be modified later
+	cpy := *s
+	cpy.Principal = &iamx.Principal{PrincipalMap: iamx.PrincipalMap{
+		AWS:       append(iamx.PolicyMultiVal(nil), s.Principal.AWS...),
+		Federated: append(iamx.PolicyMultiVal(nil), s.Principal.Federated...),
+		Service:   append(iamx.PolicyMultiVal(nil), s.Principal.Service...),
+	}}
+	p.Statement = append(p.Statement, &cpy)
+}
+
+// conditionsEqual returns true if a and b contain the same conditions.
+func conditionsEqual(a, b iamx.ConditionMap) bool {
+	return len(a) == 0 && len(b) == 0 || reflect.DeepEqual(a, b)
 }
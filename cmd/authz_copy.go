@@ -0,0 +1,462 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/mxk/go-cli"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/mxk/go-cloud/aws/awsx"
+	"github.com/mxk/go-cloud/aws/iamx"
+	"github.com/mxk/go-fast"
+	"github.com/mxk/oktapus/op"
+	"github.com/pkg/errors"
+)
+
+// copyRole implements authz -copy-from.
+func (cmd *authzCmd) copyRole(ctx *op.Ctx) (interface{}, error) {
+	if cmd.Role != "" || cmd.Tmp || cmd.Desc != nil || cmd.Boundary != "" ||
+		cmd.MaxSession != 0 || cmd.PolicyFile != "" || cmd.Expires != 0 ||
+		cmd.RequireMFA || cmd.ExternalID != "" || cmd.SourceIP != "" {
+		return nil, cli.Error("-copy-from cannot be combined with other " +
+			"role options")
+	}
+	i := strings.LastIndexByte(cmd.CopyFrom, ':')
+	if i <= 0 || i == len(cmd.CopyFrom)-1 {
+		return nil, cli.Error("-copy-from must be <account>:<role>")
+	}
+	srcSpec := cmd.CopyFrom[:i]
+	roleName := cmd.CopyFrom[i+1:]
+	roleName = roleName[strings.LastIndexByte(roleName, '/')+1:]
+	if err := checkPrincipals(ctx.Ident().Ctx(), cmd.Principals, true); err != nil {
+		return nil, err
+	}
+	tc := &trustConds{aud: cmd.OIDCAud, sub: cmd.OIDCSub}
+	if err := checkWebIdentity(cmd.Principals, tc); err != nil {
+		return nil, err
+	}
+
+	// Read source role
+	src, err := ctx.Match(srcSpec)
+	if err != nil {
+		return nil, err
+	} else if len(src) != 1 {
+		return nil, fmt.Errorf("-copy-from account %q matches %d accounts",
+			srcSpec, len(src))
+	}
+	if src.EnsureCreds(minDur); !src[0].CredsValid() {
+		return nil, errors.Wrapf(src[0].Err, "failed to access account %s",
+			src[0].Name)
+	}
+	def, err := getRoleDef(src[0].IAM, roleName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read role %q in account %s",
+			roleName, src[0].Name)
+	}
+	for _, s := range trustStatements(cmd.Principals, tc, time.Time{}) {
+		appendAssumeRolePolicy(def.trust, s)
+	}
+
+	// Copy to target accounts
+	acs, err := ctx.Match(cmd.Spec)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*roleOutput, len(acs))
+	acs.EnsureCreds(minDur).Map(func(i int, ac *op.Account) error {
+		ro := &roleOutput{Account: ac.ID, Name: ac.Name}
+		out[i] = ro
+		if !ac.CredsValid() {
+			ro.Result = "ERROR: " + explainError(ac.Err)
+			return nil
+		}
+		role, result, err := def.forAccount(src[0].ID, ac.ID).exec(ac.IAM, cmd.Prune)
+		if ro.Role, ro.Result = role, result; err != nil {
+			ro.Result = "ERROR: " + explainError(err)
+		}
+		return nil
+	})
+	return out, nil
+}
+
+// roleDef is a complete IAM role definition.
+type roleDef struct {
+	role       arn.ARN
+	path       string
+	name       string
+	desc       string
+	maxSession int64
+	boundary   arn.ARN
+	trust      *iamx.Policy
+	attached   []arn.ARN
+	inline     map[string]*iamx.Policy
+}
+
+// getRoleDef reads the definition of an existing role.
+func getRoleDef(c iamx.Client, name string) (*roleDef, error) {
+	in := iam.GetRoleInput{RoleName: aws.String(name)}
+	out, err := c.GetRoleRequest(&in).Send()
+	if err != nil {
+		return nil, err
+	}
+	role := out.Role
+	d := &roleDef{
+		role:       arn.Value(role.Arn),
+		path:       aws.StringValue(role.Path),
+		name:       aws.StringValue(role.RoleName),
+		desc:       aws.StringValue(role.Description),
+		maxSession: aws.Int64Value(role.MaxSessionDuration),
+		inline:     make(map[string]*iamx.Policy),
+	}
+	if b := role.PermissionsBoundary; b != nil {
+		d.boundary = arn.Value(b.PermissionsBoundaryArn)
+	}
+	if d.trust, err = iamx.ParsePolicy(role.AssumeRolePolicyDocument); err != nil {
+		return nil, err
+	}
+	if d.attached, err = attachedPolicyARNs(c, role.RoleName); err != nil {
+		return nil, err
+	}
+	pin := iam.ListRolePoliciesInput{RoleName: role.RoleName}
+	r := c.ListRolePoliciesRequest(&pin)
+	p := r.Paginate()
+	var names []string
+	for p.Next() {
+		names = append(names, p.CurrentPage().PolicyNames...)
+	}
+	if err = p.Err(); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		in := iam.GetRolePolicyInput{
+			PolicyName: aws.String(name),
+			RoleName:   role.RoleName,
+		}
+		out, err := c.GetRolePolicyRequest(&in).Send()
+		if err != nil {
+			return nil, err
+		}
+		pol, err := iamx.ParsePolicy(out.PolicyDocument)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid inline policy %q", name)
+		}
+		d.inline[name] = pol
+	}
+	return d, nil
+}
+
+// forAccount returns a copy of d for account dst. Customer-managed policies of
+// account src are replaced with policies of the same name in dst.
+func (d *roleDef) forAccount(src, dst string) *roleDef {
+	cpy := *d
+	move := func(r arn.ARN) arn.ARN {
+		if r.Valid() && r.Account() == src {
+			return r.WithAccount(dst)
+		}
+		return r
+	}
+	cpy.boundary = move(d.boundary)
+	cpy.attached = make([]arn.ARN, len(d.attached))
+	for i, r := range d.attached {
+		cpy.attached[i] = move(r)
+	}
+	return &cpy
+}
+
+// exec creates the role or updates an existing role to match d. The result
+// lists role attributes that were different. Policies and trusted principals of
+// the existing role that are not in d are reported as extra and only removed if
+// prune is set.
+func (d *roleDef) exec(c iamx.Client, prune bool) (role, result string, err error) {
+	cur, err := getRoleDef(c, d.name)
+	if err != nil {
+		if awsx.ErrCode(err) != iam.ErrCodeNoSuchEntityException {
+			return "", "", err
+		}
+		return d.create(c)
+	}
+	role = string(cur.role)
+	if cur.path != d.path {
+		return role, "", op.Error("role path mismatch")
+	}
+	var drift []string
+	name := aws.String(d.name)
+	call := func(what string, fn func() error) {
+		drift = append(drift, what)
+		if err == nil {
+			err = fn()
+		}
+	}
+	var extra []string
+	trust, update := d.trust, !policyEqual(cur.trust, d.trust)
+	if !prune {
+		if stmts, ids := extraTrust(cur.trust, d.trust); len(ids) > 0 {
+			rest := normPolicy(cur.trust)
+			removePrincipals(rest, ids, nil)
+			update = !policyEqual(rest, d.trust)
+			cpy := *d.trust
+			cpy.Statement = append(append([]*iamx.Statement(nil),
+				d.trust.Statement...), stmts...)
+			trust = &cpy
+			for _, id := range ids {
+				extra = append(extra, "trust:"+id)
+			}
+		}
+	}
+	if update {
+		call("trust", func() error {
+			_, err := c.UpdateAssumeRolePolicyRequest(&iam.UpdateAssumeRolePolicyInput{
+				PolicyDocument: trust.Doc(),
+				RoleName:       name,
+			}).Send()
+			return err
+		})
+	}
+	if cur.desc != d.desc || cur.maxSession != d.maxSession {
+		call("settings", func() error {
+			in := iam.UpdateRoleInput{
+				Description: aws.String(d.desc),
+				RoleName:    name,
+			}
+			if d.maxSession != 0 {
+				in.MaxSessionDuration = aws.Int64(d.maxSession)
+			}
+			_, err := c.UpdateRoleRequest(&in).Send()
+			return err
+		})
+	}
+	if cur.boundary != d.boundary {
+		call("boundary", func() error {
+			if d.boundary == "" {
+				_, err := c.DeleteRolePermissionsBoundaryRequest(
+					&iam.DeleteRolePermissionsBoundaryInput{RoleName: name},
+				).Send()
+				return err
+			}
+			_, err := c.PutRolePermissionsBoundaryRequest(
+				&iam.PutRolePermissionsBoundaryInput{
+					PermissionsBoundary: arn.String(d.boundary),
+					RoleName:            name,
+				}).Send()
+			return err
+		})
+	}
+	attach, detach := setDiff(arnStrings(d.attached), arnStrings(cur.attached))
+	if !prune {
+		extra, detach = append(extra, detach...), nil
+	}
+	if len(attach)+len(detach) > 0 {
+		call("policies", func() error {
+			if err := attachPolicies(c, name, attach); err != nil {
+				return err
+			}
+			for _, p := range detach {
+				_, err := c.DetachRolePolicyRequest(&iam.DetachRolePolicyInput{
+					PolicyArn: aws.String(p),
+					RoleName:  name,
+				}).Send()
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	var put, del []string
+	for pol, doc := range d.inline {
+		if cur := cur.inline[pol]; cur == nil || !policyEqual(cur, doc) {
+			put = append(put, pol)
+		}
+	}
+	for pol := range cur.inline {
+		if _, ok := d.inline[pol]; !ok {
+			del = append(del, pol)
+		}
+	}
+	sort.Strings(put)
+	sort.Strings(del)
+	if !prune {
+		for _, pol := range del {
+			extra = append(extra, "inline:"+pol)
+		}
+		del = nil
+	}
+	if len(put)+len(del) > 0 {
+		call("inline policies", func() error {
+			if err := d.putInline(c, put); err != nil {
+				return err
+			}
+			for _, pol := range del {
+				_, err := c.DeleteRolePolicyRequest(&iam.DeleteRolePolicyInput{
+					PolicyName: aws.String(pol),
+					RoleName:   name,
+				}).Send()
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if result = "UNCHANGED"; len(drift) > 0 {
+		result = "UPDATED (" + strings.Join(drift, ", ") + ")"
+	}
+	if len(extra) > 0 {
+		result += "; EXTRA (" + strings.Join(extra, ", ") + ")"
+	}
+	return role, result, err
+}
+
+// extraTrust returns the principals that Allow statements of the current trust
+// policy cur grant access to, but that are not in policy want. It also returns
+// copies of those statements that are limited to the extra principals.
+func extraTrust(cur, want *iamx.Policy) ([]*iamx.Statement, []string) {
+	wantIDs := normPrincipals(stmtPrincipals(want.Statement...))
+	rest := normPolicy(cur)
+	allow := rest.Statement[:0]
+	for _, s := range rest.Statement {
+		if s.Effect == iamx.Allow && s.Principal != nil && !s.Principal.Any {
+			allow = append(allow, s)
+		}
+	}
+	_, ids := setDiff(wantIDs, stmtPrincipals(allow...))
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	rest.Statement = allow
+	removePrincipals(rest, wantIDs, nil)
+	return rest.Statement, ids
+}
+
+// create creates a new role from definition d.
+func (d *roleDef) create(c iamx.Client) (role, result string, err error) {
+	in := iam.CreateRoleInput{
+		AssumeRolePolicyDocument: d.trust.Doc(),
+		Path:                     aws.String(d.path),
+		RoleName:                 aws.String(d.name),
+	}
+	if d.desc != "" {
+		in.Description = aws.String(d.desc)
+	}
+	if d.maxSession != 0 {
+		in.MaxSessionDuration = aws.Int64(d.maxSession)
+	}
+	if d.boundary != "" {
+		in.PermissionsBoundary = arn.String(d.boundary)
+	}
+	out, err := c.CreateRoleRequest(&in).Send()
+	if err != nil {
+		return "", "", err
+	}
+	role, result = aws.StringValue(out.Role.Arn), "CREATED"
+	if err = attachPolicies(c, in.RoleName, arnStrings(d.attached)); err == nil {
+		names := make([]string, 0, len(d.inline))
+		for name := range d.inline {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		err = d.putInline(c, names)
+	}
+	return
+}
+
+// putInline puts the specified inline policies of d.
+func (d *roleDef) putInline(c iamx.Client, names []string) error {
+	return fast.ForEachIO(len(names), func(i int) error {
+		_, err := c.PutRolePolicyRequest(&iam.PutRolePolicyInput{
+			PolicyDocument: d.inline[names[i]].Doc(),
+			PolicyName:     aws.String(names[i]),
+			RoleName:       aws.String(d.name),
+		}).Send()
+		return err
+	})
+}
+
+// attachPolicies attaches managed policies to the specified role.
+func attachPolicies(c iamx.Client, role *string, arns []string) error {
+	return fast.ForEachIO(len(arns), func(i int) error {
+		_, err := c.AttachRolePolicyRequest(&iam.AttachRolePolicyInput{
+			PolicyArn: aws.String(arns[i]),
+			RoleName:  role,
+		}).Send()
+		return err
+	})
+}
+
+// policyEqual returns true if policies a and b are equivalent. IAM may store a
+// policy with principals, values, and statements in a different form or order
+// than the one it was given, so both policies are normalized first.
+func policyEqual(a, b *iamx.Policy) bool {
+	return reflect.DeepEqual(normPolicy(a), normPolicy(b))
+}
+
+// normPolicy returns a normalized copy of p. Root ARNs of AWS principals are
+// replaced with account IDs, all values are sorted, and statements are sorted
+// by their JSON encoding.
+func normPolicy(p *iamx.Policy) *iamx.Policy {
+	cpy := &iamx.Policy{
+		Version:   p.Version,
+		ID:        p.ID,
+		Statement: make([]*iamx.Statement, len(p.Statement)),
+	}
+	if cpy.Version == "" {
+		cpy.Version = iamx.PolicyVersion2012
+	}
+	keys := make(map[*iamx.Statement]string, len(p.Statement))
+	for i, s := range p.Statement {
+		t := *s
+		t.Principal = normPrincipal(s.Principal)
+		t.NotPrincipal = normPrincipal(s.NotPrincipal)
+		t.Action = sortedVal(s.Action)
+		t.NotAction = sortedVal(s.NotAction)
+		t.Resource = sortedVal(s.Resource)
+		t.NotResource = sortedVal(s.NotResource)
+		t.Condition = nil
+		if len(s.Condition) > 0 {
+			t.Condition = make(iamx.ConditionMap, len(s.Condition))
+			for typ, conds := range s.Condition {
+				m := make(iamx.Conditions, len(conds))
+				for k, v := range conds {
+					m[k] = sortedVal(v)
+				}
+				t.Condition[typ] = m
+			}
+		}
+		b, _ := json.Marshal(&t)
+		cpy.Statement[i], keys[&t] = &t, string(b)
+	}
+	sort.Slice(cpy.Statement, func(i, j int) bool {
+		return keys[cpy.Statement[i]] < keys[cpy.Statement[j]]
+	})
+	return cpy
+}
+
+// normPrincipal returns a normalized copy of p.
+func normPrincipal(p *iamx.Principal) *iamx.Principal {
+	if p == nil {
+		return nil
+	}
+	cpy := &iamx.Principal{Any: p.Any}
+	if len(p.AWS) > 0 {
+		cpy.AWS = sortedVal(iamx.PolicyMultiVal(normPrincipals(p.AWS)))
+	}
+	cpy.Federated = sortedVal(p.Federated)
+	cpy.Service = sortedVal(p.Service)
+	return cpy
+}
+
+// sortedVal returns a sorted copy of v or nil if v is empty.
+func sortedVal(v iamx.PolicyMultiVal) iamx.PolicyMultiVal {
+	if len(v) == 0 {
+		return nil
+	}
+	cpy := append(iamx.PolicyMultiVal(nil), v...)
+	sort.Strings(cpy)
+	return cpy
+}
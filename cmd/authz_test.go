@@ -1,11 +1,20 @@
 package cmd
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/mxk/go-cloud/aws/iamx"
 	"github.com/mxk/oktapus/mock"
 	"github.com/mxk/oktapus/op"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -55,3 +64,306 @@ func TestAuthz(t *testing.T) {
 	}}
 	require.Equal(t, want, out)
 }
+
+func TestAuthzOptions(t *testing.T) {
+	ctx, w := mockOrg(mock.Ctx, "test1")
+	dir, err := ioutil.TempDir("", "oktapus")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "s3-read.json")
+	doc := `{"Statement":[{"Effect":"Allow","Action":"s3:Get*","Resource":"*"}]}`
+	require.NoError(t, ioutil.WriteFile(file, []byte(doc), 0600))
+
+	cmd := authzCli.New().(*authzCmd)
+	cmd.Spec = "test1"
+	cmd.Role = "ci"
+	cmd.Policy = ""
+	cmd.PolicyFile = file
+	cmd.Boundary = "PowerUserAccess"
+	cmd.MaxSession = 4 * time.Hour
+	cmd.RequireMFA = true
+	cmd.ExternalID = "xyz"
+	cmd.SourceIP = "10.0.0.0/8, 192.0.2.1"
+	cmd.OIDCAud = "sts.amazonaws.com"
+	cmd.OIDCSub = "repo:org/repo:*"
+	cmd.Principals = []string{
+		"user/user1",
+		"Service:lambda.amazonaws.com",
+		"oidc-provider/token.actions.githubusercontent.com",
+	}
+	out, err := cmd.Run(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "CREATED", out.([]*roleOutput)[0].Result)
+
+	role := w.Account("1").RoleRouter()["ci"]
+	assert.Equal(t, int64(4*3600), aws.Int64Value(role.MaxSessionDuration))
+	assert.Equal(t, "arn:aws:iam::aws:policy/PowerUserAccess",
+		aws.StringValue(role.PermissionsBoundary.PermissionsBoundaryArn))
+	assert.Empty(t, role.AttachedPolicies)
+	assert.Equal(t, map[string]string{"s3-read": `{"Version":"2012-10-17",` +
+		`"Statement":[{"Effect":"Allow","Action":"s3:Get*","Resource":"*"}]}`},
+		role.InlinePolicies)
+	pol, err := iamx.ParsePolicy(role.AssumeRolePolicyDocument)
+	require.NoError(t, err)
+	want := []*iamx.Statement{{
+		Effect:    iamx.Allow,
+		Principal: iamx.NewAWSPrincipal("arn:aws:iam::000000000000:user/user1"),
+		Action:    iamx.PolicyMultiVal{"sts:AssumeRole"},
+		Condition: iamx.ConditionMap{
+			"Bool":         {"aws:MultiFactorAuthPresent": {"true"}},
+			"StringEquals": {"sts:ExternalId": {"xyz"}},
+			"IpAddress":    {"aws:SourceIp": {"10.0.0.0/8", "192.0.2.1"}},
+		},
+	}, {
+		Effect: iamx.Allow,
+		Principal: &iamx.Principal{PrincipalMap: iamx.PrincipalMap{
+			Service: iamx.PolicyMultiVal{"lambda.amazonaws.com"},
+		}},
+		Action: iamx.PolicyMultiVal{"sts:AssumeRole"},
+	}, {
+		Effect: iamx.Allow,
+		Principal: &iamx.Principal{PrincipalMap: iamx.PrincipalMap{
+			Federated: iamx.PolicyMultiVal{"arn:aws:iam::000000000000:" +
+				"oidc-provider/token.actions.githubusercontent.com"},
+		}},
+		Action: iamx.PolicyMultiVal{"sts:AssumeRoleWithWebIdentity"},
+		Condition: iamx.ConditionMap{
+			"StringEquals": {"token.actions.githubusercontent.com:aud": {
+				"sts.amazonaws.com"}},
+			"StringLike": {"token.actions.githubusercontent.com:sub": {
+				"repo:org/repo:*"}},
+		},
+	}}
+	assert.Equal(t, want, pol.Statement)
+
+	// Principals with matching conditions are merged into existing statements
+	cmd = authzCli.New().(*authzCmd)
+	cmd.Spec = "test1"
+	cmd.Role = "ci"
+	cmd.Principals = []string{"Service:ec2.amazonaws.com", "user/user2"}
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "UPDATED", out.([]*roleOutput)[0].Result)
+	pol, err = iamx.ParsePolicy(role.AssumeRolePolicyDocument)
+	require.NoError(t, err)
+	require.Len(t, pol.Statement, 3)
+	assert.Equal(t, iamx.PolicyMultiVal{"lambda.amazonaws.com",
+		"ec2.amazonaws.com", "arn:aws:iam::000000000000:user/user2"},
+		iamx.PolicyMultiVal(append(pol.Statement[1].Principal.Service,
+			pol.Statement[1].Principal.AWS...)))
+
+	// Invalid options
+	cmd = authzCli.New().(*authzCmd)
+	cmd.Spec = "test1"
+	cmd.Role = "ci"
+	cmd.Principals = []string{"user/user1"}
+	cmd.MaxSession = 13 * time.Hour
+	_, err = cmd.Run(ctx)
+	assert.Error(t, err)
+	cmd.MaxSession = 0
+	cmd.SourceIP = "10.0.0.0/33"
+	_, err = cmd.Run(ctx)
+	assert.Error(t, err)
+}
+
+func TestAuthzCopyFrom(t *testing.T) {
+	ctx, w := mockOrg(mock.Ctx, "test1", "test2", "test3")
+	cmd := authzCli.New().(*authzCmd)
+	cmd.Spec = "test1"
+	cmd.Role = "ops/deploy"
+	cmd.Desc = aws.String("Deployment role")
+	cmd.Boundary = "PowerUserAccess"
+	cmd.MaxSession = 2 * time.Hour
+	cmd.Principals = []string{"user/user1"}
+	_, err := cmd.Run(ctx)
+	require.NoError(t, err)
+	src := w.Account("1").RoleRouter()["deploy"]
+	custom := arn.ARN("arn:aws:iam::000000000001:policy/Deploy")
+	src.AttachedPolicies[custom] = custom.Name()
+	src.InlinePolicies = map[string]string{"s3": `{"Version":"2012-10-17",` +
+		`"Statement":[{"Effect":"Allow","Action":"s3:*","Resource":"*"}]}`}
+
+	cmd = authzCli.New().(*authzCmd)
+	cmd.Spec = "test2,test3"
+	cmd.CopyFrom = "test1:deploy"
+	out, err := cmd.Run(ctx)
+	require.NoError(t, err)
+	want := []*roleOutput{{
+		Account: "000000000002",
+		Name:    "test2",
+		Role:    "arn:aws:iam::000000000002:role/ops/deploy",
+		Result:  "CREATED",
+	}, {
+		Account: "000000000003",
+		Name:    "test3",
+		Role:    "arn:aws:iam::000000000003:role/ops/deploy",
+		Result:  "CREATED",
+	}}
+	require.Equal(t, want, out)
+	dst := w.Account("2").RoleRouter()["deploy"]
+	assert.Equal(t, src.AssumeRolePolicyDocument, dst.AssumeRolePolicyDocument)
+	assert.Equal(t, "Deployment role", aws.StringValue(dst.Description))
+	assert.Equal(t, int64(2*3600), aws.Int64Value(dst.MaxSessionDuration))
+	assert.Equal(t, src.PermissionsBoundary, dst.PermissionsBoundary)
+	assert.Equal(t, map[arn.ARN]string{
+		"arn:aws:iam::aws:policy/AdministratorAccess": "AdministratorAccess",
+		"arn:aws:iam::000000000002:policy/Deploy":     "Deploy",
+	}, dst.AttachedPolicies)
+	assert.Equal(t, src.InlinePolicies, dst.InlinePolicies)
+
+	// Drift is corrected and reported
+	dst.Description = aws.String("changed")
+	delete(dst.AttachedPolicies, "arn:aws:iam::000000000002:policy/Deploy")
+	dst.InlinePolicies["extra"] = "{}"
+	dst.PermissionsBoundary = nil
+	cmd.Principals = []string{"user/user2"}
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "UPDATED (trust, settings, boundary, policies); "+
+		"EXTRA (inline:extra)", out.([]*roleOutput)[0].Result)
+	assert.Equal(t, "UPDATED (trust)", out.([]*roleOutput)[1].Result)
+	assert.Equal(t, "Deployment role", aws.StringValue(dst.Description))
+	assert.Equal(t, src.PermissionsBoundary, dst.PermissionsBoundary)
+	assert.Len(t, dst.AttachedPolicies, 2)
+	assert.Len(t, dst.InlinePolicies, 2)
+
+	// Extra policies are only removed with -prune
+	cmd.Principals = nil
+	cmd.Prune = true
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "UPDATED (trust, inline policies)",
+		out.([]*roleOutput)[0].Result)
+	assert.Equal(t, src.InlinePolicies, dst.InlinePolicies)
+	cmd.Prune = false
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "UNCHANGED", out.([]*roleOutput)[0].Result)
+
+	// Equivalent trust policy is not drift
+	dst.AssumeRolePolicyDocument = aws.String(strings.Replace(
+		aws.StringValue(dst.AssumeRolePolicyDocument),
+		`"AWS":"arn:aws:iam::000000000000:user/user1"`,
+		`"AWS":["arn:aws:iam::000000000000:user/user1"]`, 1))
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "UNCHANGED", out.([]*roleOutput)[0].Result)
+
+	// Extra trusted principals are kept and only removed with -prune
+	srcTrust := aws.StringValue(src.AssumeRolePolicyDocument)
+	dst.AssumeRolePolicyDocument = aws.String(strings.Replace(srcTrust,
+		`"AWS":"arn:aws:iam::000000000000:user/user1"`,
+		`"AWS":["arn:aws:iam::000000000000:user/user1",`+
+			`"arn:aws:iam::000000000000:user/user3"]`, 1))
+	require.NotEqual(t, srcTrust, aws.StringValue(dst.AssumeRolePolicyDocument))
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "UNCHANGED; EXTRA (trust:arn:aws:iam::000000000000:user/user3)",
+		out.([]*roleOutput)[0].Result)
+	cmd.Principals = []string{"user/user2"}
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "UPDATED (trust); "+
+		"EXTRA (trust:arn:aws:iam::000000000000:user/user3)",
+		out.([]*roleOutput)[0].Result)
+	assert.Contains(t, aws.StringValue(dst.AssumeRolePolicyDocument), "user/user2")
+	assert.Contains(t, aws.StringValue(dst.AssumeRolePolicyDocument), "user/user3")
+	cmd.Principals = nil
+	cmd.Prune = true
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "UPDATED (trust)", out.([]*roleOutput)[0].Result)
+	assert.NotContains(t, aws.StringValue(dst.AssumeRolePolicyDocument), "user/user3")
+	cmd.Prune = false
+
+	// Invalid options
+	for _, from := range []string{"test1", "test1:", ":deploy", "test*:deploy",
+		"test1:missing"} {
+		cmd.CopyFrom = from
+		_, err = cmd.Run(ctx)
+		assert.Error(t, err, "%s", from)
+	}
+	cmd.CopyFrom = "test1:deploy"
+	cmd.Tmp = true
+	_, err = cmd.Run(ctx)
+	assert.Error(t, err)
+	cmd.CopyFrom = ""
+	cmd.Tmp = false
+	cmd.Prune = true
+	_, err = cmd.Run(ctx)
+	assert.Error(t, err)
+}
+
+func TestPolicyEqual(t *testing.T) {
+	a, err := iamx.ParsePolicy(aws.String(`{"Version":"2012-10-17",` +
+		`"Statement":[{"Effect":"Allow","Action":"sts:AssumeRole",` +
+		`"Principal":{"AWS":["111111111111","222222222222"]}},` +
+		`{"Effect":"Allow","Action":"sts:AssumeRole",` +
+		`"Principal":{"Service":"ec2.amazonaws.com"}}]}`))
+	require.NoError(t, err)
+	b, err := iamx.ParsePolicy(aws.String(`{"Version":"2012-10-17",` +
+		`"Statement":[{"Effect":"Allow","Action":["sts:AssumeRole"],` +
+		`"Principal":{"Service":["ec2.amazonaws.com"]}},` +
+		`{"Effect":"Allow","Action":"sts:AssumeRole","Principal":{"AWS":[` +
+		`"arn:aws:iam::222222222222:root","arn:aws:iam::111111111111:root"]}}]}`))
+	require.NoError(t, err)
+	assert.True(t, policyEqual(a, b))
+	b.Statement[1].Effect = iamx.Deny
+	assert.False(t, policyEqual(a, b))
+}
+
+func TestCheckPrincipals(t *testing.T) {
+	ctx := mock.Ctx
+	p := []string{
+		"Federated:accounts.google.com",
+		"Federated:arn:aws:iam::123456789012:saml-provider/okta",
+		"123456789012:oidc-provider/example.com/id/1",
+		"Service:lambda.amazonaws.com",
+	}
+	require.NoError(t, checkPrincipals(ctx, p, true))
+	assert.Equal(t, []string{
+		"Federated:accounts.google.com",
+		"Federated:arn:aws:iam::123456789012:saml-provider/okta",
+		"Federated:arn:aws:iam::123456789012:oidc-provider/example.com/id/1",
+		"Service:lambda.amazonaws.com",
+	}, p)
+
+	for _, p := range []string{
+		"Service:lambda.amazonaws.com",
+		"Federated:accounts.google.com",
+		"oidc-provider/example.com",
+	} {
+		assert.Error(t, checkPrincipals(ctx, []string{p}, false), "%s", p)
+	}
+	for _, p := range []string{
+		"Service:",
+		"Federated:user/alice",
+		"Federated:",
+		"group/admins",
+	} {
+		assert.Error(t, checkPrincipals(ctx, []string{p}, true), "%s", p)
+	}
+
+	assert.Error(t, checkWebIdentity(p, nil))
+	assert.Error(t, checkWebIdentity(p, &trustConds{aud: "client"}))
+	assert.NoError(t, checkWebIdentity(p[1:], &trustConds{aud: "client"}))
+	assert.NoError(t, checkWebIdentity(p[1:2], nil))
+	tc := &trustConds{aud: "client", sub: "user"}
+	require.NoError(t, checkWebIdentity(p, tc))
+
+	stmts := trustStatements(p, tc, time.Time{})
+	require.Len(t, stmts, 4)
+	assert.Equal(t, iamx.PolicyMultiVal{"sts:AssumeRoleWithWebIdentity"},
+		stmts[1].Action)
+	assert.Equal(t, iamx.ConditionMap{
+		"StringEquals": {"accounts.google.com:aud": {"client"}},
+		"StringLike":   {"accounts.google.com:sub": {"user"}},
+	}, stmts[1].Condition)
+	assert.Equal(t, iamx.ConditionMap{
+		"StringEquals": {"example.com/id/1:aud": {"client"}},
+		"StringLike":   {"example.com/id/1:sub": {"user"}},
+	}, stmts[2].Condition)
+	assert.Equal(t, iamx.PolicyMultiVal{"sts:AssumeRoleWithSAML"},
+		stmts[3].Action)
+	assert.Nil(t, stmts[3].Condition)
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"github.com/mxk/go-cli"
+	"github.com/mxk/oktapus/op"
+)
+
+var checkCli = cli.Main.Add(&cli.Info{
+	Name:    "check",
+	Usage:   "[options] account-spec",
+	Summary: "Diagnose account access failures",
+	MinArgs: 1,
+	MaxArgs: 1,
+	New:     func() cli.Cmd { return &checkCmd{} },
+})
+
+type checkCmd struct {
+	OutFmt
+	Spec string
+}
+
+func (*checkCmd) Info() *cli.Info { return checkCli }
+
+func (*checkCmd) Help(w *cli.Writer) {
+	w.Text(`
+	Diagnose account access failures.
+
+	Most access errors are reported as "account access denied", which does not
+	say whether the problem is the gateway policy, a missing role, a role trust
+	policy that does not include the gateway, or a service control policy. For
+	each account that cannot be accessed, this command tries to determine the
+	cause and prints advice for fixing it.
+
+	The gateway policy is evaluated with iam:SimulatePrincipalPolicy. If the
+	gateway has access to the organization master, the account role is
+	inspected via ` + op.OrgAccessRole + `. Encoded authorization failure
+	messages are decoded with sts:DecodeAuthorizationMessage. Any of these
+	checks are skipped if the gateway identity is not allowed to perform them.
+	Use -json to see full error details.
+	`)
+	accountSpecHelp(w)
+}
+
+func (cmd *checkCmd) Main(args []string) error {
+	cmd.Spec = args[0]
+	return op.RunAndPrint(cmd)
+}
+
+func (cmd *checkCmd) Run(ctx *op.Ctx) (interface{}, error) {
+	acs, err := ctx.Match(cmd.Spec)
+	if err != nil {
+		return nil, err
+	}
+	diag := make([]*op.Diagnosis, len(acs))
+	acs.EnsureCreds(minDur).Map(func(i int, ac *op.Account) error {
+		diag[i] = ctx.Diagnose(ac)
+		return nil
+	})
+	var out []*checkOutput
+	for i, d := range diag {
+		if d != nil {
+			out = append(out, &checkOutput{
+				Account: acs[i].ID,
+				Name:    acs[i].Name,
+				Cause:   d.Cause,
+				Advice:  d.Advice,
+				Role:    string(d.Role),
+				Detail:  d.Detail,
+			})
+		}
+	}
+	return out, nil
+}
+
+type checkOutput struct {
+	Account string
+	Name    string
+	Cause   string
+	Advice  string `printer:",last"`
+	Role    string
+	Detail  string `json:",omitempty"`
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/mxk/go-cli"
+	"github.com/mxk/go-fast"
+	"github.com/mxk/oktapus/op"
+)
+
+var chownCli = cli.Main.Add(&cli.Info{
+	Name:    "chown",
+	Usage:   "[options] account-spec new-owner",
+	Summary: "Transfer ownership of allocated accounts",
+	MinArgs: 2,
+	MaxArgs: 2,
+	New:     func() cli.Cmd { return &chownCmd{} },
+})
+
+type chownCmd struct {
+	OutFmt
+	Force bool `flag:"Transfer accounts owned by others"`
+	Spec  string
+	Owner string
+}
+
+func (*chownCmd) Info() *cli.Info { return chownCli }
+
+func (*chownCmd) Help(w *cli.Writer) {
+	w.Text(`
+	Transfer ownership of allocated accounts.
+
+	This command hands allocated accounts to another owner without freeing them,
+	so temporary IAM users and roles are preserved and no one else can allocate
+	the accounts in the meantime. Ownership is changed only if the current owner
+	has not been modified concurrently, and the new owner is verified after the
+	same delay as used by 'alloc'.
+
+	The previous owner and the time of transfer are recorded in account control
+	information and shown in the output. Team ownership (see 'alloc -team') is
+	not transferred, but team members may transfer accounts owned by the team.
+	Transferring accounts owned by others with -force is limited to account
+	admins (see 'tag -admins').
+	`)
+	accountSpecHelp(w)
+}
+
+func (cmd *chownCmd) Main(args []string) error {
+	cmd.Spec, cmd.Owner = args[0], args[1]
+	if cmd.Owner == "" {
+		return cli.Error("new owner must not be empty")
+	}
+	return op.RunAndPrint(cmd)
+}
+
+func (cmd *chownCmd) Run(ctx *op.Ctx) (interface{}, error) {
+	acs, err := ctx.Match(cmd.Spec)
+	if err != nil {
+		return nil, err
+	}
+	owned := ownedFilter(ctx, cmd.Force)
+	acs = acs.Filter(func(ac *op.Account) bool {
+		return ac.Ctl.Owner != cmd.Owner && owned(ac)
+	})
+	if len(acs) == 0 {
+		return []*chownOutput{}, nil
+	}
+	now := fast.Time()
+	allowed := acs.Filter(func(ac *op.Account) bool {
+		if ac.Err == op.ErrNotAdmin {
+			return false
+		}
+		ac.Ctl.Chown(cmd.Owner, now)
+		return true
+	})
+	if len(allowed) > 0 {
+		allowed.StoreCtl()
+		verifyOwner(allowed, cmd.Owner)
+	}
+	out := make([]*chownOutput, len(acs))
+	for i, ac := range acs.SortByName() {
+		out[i] = &chownOutput{
+			Account: ac.ID,
+			Name:    ac.Name,
+			From:    ac.Ctl.PrevOwner,
+			Owner:   ac.Ctl.Owner,
+			Result:  "OK",
+		}
+		if ac.Err != nil {
+			out[i].From = ""
+			out[i].Result = "ERROR: " + explainError(ac.Err)
+		} else if ac.Ctl.ChownTime != 0 {
+			out[i].Time = time.Unix(ac.Ctl.ChownTime, 0).UTC().Format(time.RFC3339)
+		}
+	}
+	return out, nil
+}
+
+type chownOutput struct {
+	Account string
+	Name    string
+	From    string
+	Owner   string
+	Time    string
+	Result  string
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/mxk/go-fast"
+	"github.com/mxk/oktapus/mock"
+	"github.com/mxk/oktapus/op"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChown(t *testing.T) {
+	fast.MockSleep(-1)
+	defer fast.MockSleep(0)
+	now := fast.MockTime(time.Unix(1500000000, 0))
+	defer fast.MockTime(time.Time{})
+
+	ctx, w := mockOrg(mock.Ctx, "test1", "test2", "test3")
+	setCtl(w, op.Ctl{Owner: "alice", Tags: op.Tags{"x"}}, "1")
+	setCtl(w, op.Ctl{Owner: "carol"}, "2")
+	setCtl(w, op.Ctl{Owner: "carol", Admins: []string{"carol"}}, "3")
+
+	cmd := chownCmd{Spec: "test1,test2,test3", Owner: "bob"}
+	out, err := cmd.Run(ctx)
+	require.NoError(t, err)
+	want := []*chownOutput{{
+		Account: "000000000001",
+		Name:    "test1",
+		From:    "alice",
+		Owner:   "bob",
+		Time:    "2017-07-14T02:40:00Z",
+		Result:  "OK",
+	}}
+	assert.Equal(t, want, out)
+
+	var ctl op.Ctl
+	role := w.Account("1").RoleRouter()[op.CtlRole]
+	require.NoError(t, ctl.Decode(aws.StringValue(role.Description)))
+	assert.Equal(t, op.Ctl{
+		Owner:     "bob",
+		Tags:      op.Tags{"x"},
+		PrevOwner: "alice",
+		ChownTime: now.Unix(),
+	}, ctl)
+
+	// Accounts owned by others require -force and organization admins may
+	// transfer accounts without an admins list
+	ctx.Admins = []string{"alice"}
+	cmd = chownCmd{Force: true, Spec: "test2", Owner: "bob"}
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "carol", out.([]*chownOutput)[0].From)
+	assert.Equal(t, "OK", out.([]*chownOutput)[0].Result)
+
+	// Non-admins cannot use -force
+	cmd = chownCmd{Force: true, Spec: "test3", Owner: "bob"}
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "ERROR: "+op.ErrNotAdmin.Error(),
+		out.([]*chownOutput)[0].Result)
+
+	// Concurrent owner change
+	cmd = chownCmd{Force: true, Spec: "test1", Owner: "dave"}
+	setCtl(w, op.Ctl{Owner: "eve"}, "1")
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "ERROR: "+op.ErrCtlUpdate.Error(),
+		out.([]*chownOutput)[0].Result)
+}
@@ -59,7 +59,9 @@ func (*consoleCmd) Help(w *cli.Writer) {
 	gateway credentials are used by default if no spec is provided. If these
 	credentials belong to an IAM user, GetFederationToken API is called to get a
 	temporary session. This session is not allowed to make IAM API calls, so
-	that part of the console will be inaccessible.
+	that part of the console will be inaccessible. AWS requires long-term user
+	credentials for this call, so the MFA session (if any) is only used for
+	accessing other accounts.
 
 	The login URL is normally opened via a redirect from an embedded HTTP
 	server. Use -srv="" to disable the server and open the URL directly.
@@ -116,8 +118,11 @@ func (cmd *consoleCmd) Run(ctx *op.Ctx) (interface{}, error) {
 		return nil, errors.Wrap(err, "invalid credentials")
 	}
 	if viaUser {
+		// GetFederationToken does not accept MFA session credentials
+		cfg := ctx.Cfg()
+		cfg.Credentials = ctx.UserCreds()
 		in := sts.GetFederationTokenInput{Name: aws.String(ident.Name())}
-		out, err := sts.New(ctx.Cfg()).GetFederationTokenRequest(&in).Send()
+		out, err := sts.New(cfg).GetFederationTokenRequest(&in).Send()
 		if err != nil {
 			return nil, errors.Wrap(err, "GetFederationToken call failed")
 		}
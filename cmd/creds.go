@@ -46,7 +46,9 @@ func (*credsCmd) Help(w *cli.Writer) {
 	match the spec. Credentials are cached and renewed automatically when they
 	are set to expire within 5 minutes. You can increase this duration with -dur
 	(e.g. -dur=30m) or force unconditional renewal with a negative duration
-	(e.g. -dur=-1s).
+	(e.g. -dur=-1s). Durations over one hour require the session_duration
+	setting and an IAM role that allows longer sessions. Role chaining limits
+	credentials to one hour regardless of these settings.
 
 	If -user is specified, the command creates long-term IAM access keys for new
 	or existing IAM users. If -tmp is specified, the users will be automatically
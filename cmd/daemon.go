@@ -85,6 +85,9 @@ func (d *daemonCmd) serve(q *daemon.Request) bool {
 	case *op.SavedCtx:
 		d.log("Context updated:", v.Sig)
 		d.saved[v.Sig] = v
+	case *op.DelCtx:
+		d.log("Context deleted:", v.Sig)
+		delete(d.saved, v.Sig)
 	}
 	return true
 }
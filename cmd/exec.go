@@ -85,7 +85,11 @@ func (cmd *execCmd) Run(ctx *op.Ctx) (interface{}, error) {
 	log.SetPrefix("==> ")
 	var credsErr, runErr int
 	for _, ac := range acs {
-		log.Printf("ACCOUNT %s: %s", ac.ID, ac.Name)
+		if ac.Gateway == "" {
+			log.Printf("ACCOUNT %s: %s", ac.ID, ac.Name)
+		} else {
+			log.Printf("ACCOUNT %s: %s (%s)", ac.ID, ac.Name, ac.Gateway)
+		}
 		if err := ac.CredsProvider().Ensure(cmd.Dur); err != nil {
 			log.Println("ERROR:", err)
 			credsErr++
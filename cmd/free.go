@@ -1,7 +1,15 @@
 package cmd
 
 import (
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/mxk/go-cli"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/mxk/go-cloud/aws/awsx"
+	"github.com/mxk/go-cloud/aws/iamx"
 	"github.com/mxk/go-fast"
 	"github.com/mxk/oktapus/op"
 )
@@ -17,8 +25,9 @@ var freeCli = cli.Main.Add(&cli.Info{
 
 type freeCmd struct {
 	OutFmt
-	Force bool `flag:"Free accounts owned by others"`
-	Spec  string
+	Force      bool `flag:"Free accounts owned by others"`
+	Quarantine bool `flag:"Put accounts into maintenance if cleanup fails"`
+	Spec       string
 }
 
 func (*freeCmd) Info() *cli.Info { return freeCli }
@@ -27,8 +36,32 @@ func (*freeCmd) Help(w *cli.Writer) {
 	w.Text(`
 	Release allocated accounts.
 
-	Freeing an account allows someone else to allocate it. Any temporary IAM
-	users or roles are deleted (see authz and creds commands for more detail).
+	Freeing an account allows someone else to allocate it. All IAM instance
+	profiles, groups, users, roles, and customer-managed policies under the
+	temporary path (/oktapus/tmp/) are deleted first, in that order, followed
+	by SAML providers whose names start with "oktapus-tmp-". The number of
+	deleted entities is reported for each account (see authz and creds
+	commands for more detail). Users are removed from all groups, and their
+	inline policies, login profiles, MFA devices, signing certificates, SSH
+	keys, and service-specific credentials are deleted with them. The account
+	remains allocated if any of them cannot be deleted.
+
+	Accounts owned by one of your teams (see 'alloc -team') may be freed like
+	your own. Freeing accounts owned by others with -force is limited to account
+	admins (see 'tag -admins').
+
+	OIDC identity providers are not deleted because they are identified only
+	by their URL and cannot be tagged, so there is no way to tell temporary
+	ones apart. They must be deleted manually.
+
+	Before any deletions, pre_free hooks from the config file are run for
+	accounts with matching tags. A failed hook leaves the account allocated.
+	See 'alloc' for more information about hooks.
+
+	With -quarantine, accounts that fail IAM cleanup are freed and put into
+	maintenance instead, with the error as the reason, so that they cannot be
+	allocated until someone fixes them and ends maintenance with 'tag -maint'.
+	Accounts with failed hooks remain allocated.
 	`)
 	accountSpecHelp(w)
 }
@@ -46,27 +79,574 @@ func (cmd *freeCmd) Run(ctx *op.Ctx) (interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
-	me := ctx.Role().Name()
-	acs = acs.Filter(func(ac *op.Account) bool {
-		return ac.CtlValid() && ac.Ctl.Owner != "" &&
-			(ac.Ctl.Owner == me || cmd.Force)
-	})
+	acs = acs.Filter(ownedFilter(ctx, cmd.Force))
 
-	// Delete temporary users/roles
-	acs.Map(func(_ int, ac *op.Account) error {
-		return fast.Call(
-			func() error { return ac.IAM.DeleteRoles(op.IAMTmpPath) },
-			func() error { return ac.IAM.DeleteUsers(op.IAMTmpPath) },
-		)
+	// Run pre-free hooks and delete temporary IAM entities
+	deleted := make([]string, len(acs))
+	failed := make([]error, len(acs))
+	acs.Map(func(i int, ac *op.Account) error {
+		if ac.Err == op.ErrNotAdmin {
+			return nil
+		}
+		if err := runHooks(ctx, ac, "pre_free", ctx.Hooks.PreFree); err != nil {
+			return err
+		}
+		deleted[i], failed[i] = deleteTmpIAM(ac.IAM, op.IAMTmpPath)
+		return failed[i]
 	})
 
-	// Clear owner if all temporary users/roles were deleted
+	// Quarantine accounts that failed IAM cleanup
+	if cmd.Quarantine {
+		for i, ac := range acs {
+			if failed[i] != nil {
+				ac.Ctl.SetMaint("free: " + explainError(failed[i]))
+				ac.Err = nil
+			}
+		}
+	}
+
+	// Clear owner if all hooks succeeded and temporary entities were deleted
 	acs.Filter(func(ac *op.Account) bool {
 		if ac.Err != nil {
 			return false
 		}
-		ac.Ctl.Owner = ""
+		ac.Ctl.Owner, ac.Ctl.Team = "", ""
 		return true
 	}).StoreCtl()
-	return listOwners(acs), nil
+	out := make([]*freeOutput, len(acs))
+	for i, o := range listOwners(acs) {
+		if acs[i].Err == nil && acs[i].Ctl.InMaint() && failed[i] != nil {
+			o.Result = "QUARANTINED: " + explainError(failed[i])
+		}
+		out[i] = &freeOutput{o.Account, o.Name, o.Owner, deleted[i], o.Result}
+	}
+	return out, nil
+}
+
+type freeOutput struct {
+	Account string
+	Name    string
+	Owner   string
+	Deleted string
+	Result  string
+}
+
+// deleteTmpIAM deletes all IAM entities under the specified path in dependency
+// order and returns a summary of what was deleted.
+func deleteTmpIAM(c iamx.Client, path string) (string, error) {
+	steps := []struct {
+		what string
+		del  func(c iamx.Client, path string) (int, error)
+	}{
+		{"instance profile", deleteInstanceProfiles},
+		{"group", deleteGroups},
+		{"user", deleteUsers},
+		{"role", deleteRoles},
+		{"policy", deletePolicies},
+		{"SAML provider", deleteSAMLProviders},
+	}
+	var deleted []string
+	for _, s := range steps {
+		n, err := s.del(c, path)
+		if n > 0 {
+			what := s.what
+			if n > 1 {
+				if strings.HasSuffix(what, "y") {
+					what = what[:len(what)-1] + "ie"
+				}
+				what += "s"
+			}
+			deleted = append(deleted, strconv.Itoa(n)+" "+what)
+		}
+		if err != nil {
+			return strings.Join(deleted, ", "), err
+		}
+	}
+	return strings.Join(deleted, ", "), nil
+}
+
+// deleteInstanceProfiles removes roles from and deletes all instance profiles
+// under the specified path.
+func deleteInstanceProfiles(c iamx.Client, path string) (int, error) {
+	in := iam.ListInstanceProfilesInput{PathPrefix: aws.String(path)}
+	r := c.ListInstanceProfilesRequest(&in)
+	p := r.Paginate()
+	var ips []iam.InstanceProfile
+	for p.Next() {
+		ips = append(ips, p.CurrentPage().InstanceProfiles...)
+	}
+	if err := p.Err(); err != nil {
+		return 0, err
+	}
+	err := fast.ForEachIO(len(ips), func(i int) error {
+		name := ips[i].InstanceProfileName
+		for _, role := range ips[i].Roles {
+			in := iam.RemoveRoleFromInstanceProfileInput{
+				InstanceProfileName: name,
+				RoleName:            role.RoleName,
+			}
+			if _, err := c.RemoveRoleFromInstanceProfileRequest(&in).Send(); err != nil {
+				return err
+			}
+		}
+		in := iam.DeleteInstanceProfileInput{InstanceProfileName: name}
+		_, err := c.DeleteInstanceProfileRequest(&in).Send()
+		return err
+	})
+	return countDeleted(len(ips), err)
+}
+
+// deleteGroups deletes all groups under the specified path after removing
+// their users and policies.
+func deleteGroups(c iamx.Client, path string) (int, error) {
+	in := iam.ListGroupsInput{PathPrefix: aws.String(path)}
+	r := c.ListGroupsRequest(&in)
+	p := r.Paginate()
+	var names []string
+	for p.Next() {
+		for _, g := range p.CurrentPage().Groups {
+			names = append(names, aws.StringValue(g.GroupName))
+		}
+	}
+	if err := p.Err(); err != nil {
+		return 0, err
+	}
+	err := fast.ForEachIO(len(names), func(i int) error {
+		name := aws.String(names[i])
+		err := fast.Call(
+			func() error { return removeGroupUsers(c, name) },
+			func() error { return detachGroupPolicies(c, name) },
+			func() error { return deleteGroupPolicies(c, name) },
+		)
+		if err == nil {
+			in := iam.DeleteGroupInput{GroupName: name}
+			_, err = c.DeleteGroupRequest(&in).Send()
+		}
+		return err
+	})
+	return countDeleted(len(names), err)
+}
+
+// removeGroupUsers removes all users from the specified group.
+func removeGroupUsers(c iamx.Client, group *string) error {
+	in := iam.GetGroupInput{GroupName: group}
+	r := c.GetGroupRequest(&in)
+	p := r.Paginate()
+	var users []string
+	for p.Next() {
+		for _, u := range p.CurrentPage().Users {
+			users = append(users, aws.StringValue(u.UserName))
+		}
+	}
+	if err := p.Err(); err != nil {
+		return err
+	}
+	return fast.ForEachIO(len(users), func(i int) error {
+		in := iam.RemoveUserFromGroupInput{
+			GroupName: group,
+			UserName:  aws.String(users[i]),
+		}
+		_, err := c.RemoveUserFromGroupRequest(&in).Send()
+		return err
+	})
+}
+
+// detachGroupPolicies detaches all managed policies from the specified group.
+func detachGroupPolicies(c iamx.Client, group *string) error {
+	in := iam.ListAttachedGroupPoliciesInput{GroupName: group}
+	r := c.ListAttachedGroupPoliciesRequest(&in)
+	p := r.Paginate()
+	var arns []string
+	for p.Next() {
+		for _, pol := range p.CurrentPage().AttachedPolicies {
+			arns = append(arns, aws.StringValue(pol.PolicyArn))
+		}
+	}
+	if err := p.Err(); err != nil {
+		return err
+	}
+	return fast.ForEachIO(len(arns), func(i int) error {
+		in := iam.DetachGroupPolicyInput{
+			GroupName: group,
+			PolicyArn: aws.String(arns[i]),
+		}
+		_, err := c.DetachGroupPolicyRequest(&in).Send()
+		return err
+	})
+}
+
+// deleteGroupPolicies deletes all inline policies of the specified group.
+func deleteGroupPolicies(c iamx.Client, group *string) error {
+	in := iam.ListGroupPoliciesInput{GroupName: group}
+	r := c.ListGroupPoliciesRequest(&in)
+	p := r.Paginate()
+	var names []string
+	for p.Next() {
+		names = append(names, p.CurrentPage().PolicyNames...)
+	}
+	if err := p.Err(); err != nil {
+		return err
+	}
+	return fast.ForEachIO(len(names), func(i int) error {
+		in := iam.DeleteGroupPolicyInput{
+			GroupName:  group,
+			PolicyName: aws.String(names[i]),
+		}
+		_, err := c.DeleteGroupPolicyRequest(&in).Send()
+		return err
+	})
+}
+
+// deleteUsers deletes all users under the specified path.
+func deleteUsers(c iamx.Client, path string) (int, error) {
+	in := iam.ListUsersInput{PathPrefix: aws.String(path)}
+	r := c.ListUsersRequest(&in)
+	p := r.Paginate()
+	var names []string
+	for p.Next() {
+		for _, u := range p.CurrentPage().Users {
+			names = append(names, aws.StringValue(u.UserName))
+		}
+	}
+	if err := p.Err(); err != nil {
+		return 0, err
+	}
+	err := fast.ForEachIO(len(names), func(i int) error {
+		name := aws.String(names[i])
+		err := fast.Call(
+			func() error { return removeUserGroups(c, name) },
+			func() error { return deleteUserPolicies(c, name) },
+			func() error { return deleteLoginProfile(c, name) },
+			func() error { return deleteMFADevices(c, name) },
+			func() error { return deleteSigningCerts(c, name) },
+			func() error { return deleteSSHPublicKeys(c, name) },
+			func() error { return deleteServiceCreds(c, name) },
+		)
+		if err == nil {
+			err = c.DeleteUser(names[i])
+		}
+		return err
+	})
+	return countDeleted(len(names), err)
+}
+
+// removeUserGroups removes the specified user from all groups.
+func removeUserGroups(c iamx.Client, user *string) error {
+	in := iam.ListGroupsForUserInput{UserName: user}
+	r := c.ListGroupsForUserRequest(&in)
+	p := r.Paginate()
+	var groups []string
+	for p.Next() {
+		for _, g := range p.CurrentPage().Groups {
+			groups = append(groups, aws.StringValue(g.GroupName))
+		}
+	}
+	if err := p.Err(); err != nil {
+		return err
+	}
+	return fast.ForEachIO(len(groups), func(i int) error {
+		in := iam.RemoveUserFromGroupInput{
+			GroupName: aws.String(groups[i]),
+			UserName:  user,
+		}
+		_, err := c.RemoveUserFromGroupRequest(&in).Send()
+		return err
+	})
+}
+
+// deleteUserPolicies deletes all inline policies of the specified user.
+func deleteUserPolicies(c iamx.Client, user *string) error {
+	in := iam.ListUserPoliciesInput{UserName: user}
+	r := c.ListUserPoliciesRequest(&in)
+	p := r.Paginate()
+	var names []string
+	for p.Next() {
+		names = append(names, p.CurrentPage().PolicyNames...)
+	}
+	if err := p.Err(); err != nil {
+		return err
+	}
+	return fast.ForEachIO(len(names), func(i int) error {
+		in := iam.DeleteUserPolicyInput{
+			PolicyName: aws.String(names[i]),
+			UserName:   user,
+		}
+		_, err := c.DeleteUserPolicyRequest(&in).Send()
+		return err
+	})
+}
+
+// deleteLoginProfile deletes the console password of the specified user.
+func deleteLoginProfile(c iamx.Client, user *string) error {
+	in := iam.DeleteLoginProfileInput{UserName: user}
+	_, err := c.DeleteLoginProfileRequest(&in).Send()
+	if awsx.ErrCode(err) == iam.ErrCodeNoSuchEntityException {
+		err = nil
+	}
+	return err
+}
+
+// deleteMFADevices deactivates all MFA devices of the specified user. Virtual
+// devices are also deleted.
+func deleteMFADevices(c iamx.Client, user *string) error {
+	in := iam.ListMFADevicesInput{UserName: user}
+	r := c.ListMFADevicesRequest(&in)
+	p := r.Paginate()
+	var serials []string
+	for p.Next() {
+		for _, d := range p.CurrentPage().MFADevices {
+			serials = append(serials, aws.StringValue(d.SerialNumber))
+		}
+	}
+	if err := p.Err(); err != nil {
+		return err
+	}
+	return fast.ForEachIO(len(serials), func(i int) error {
+		sn := aws.String(serials[i])
+		in := iam.DeactivateMFADeviceInput{SerialNumber: sn, UserName: user}
+		if _, err := c.DeactivateMFADeviceRequest(&in).Send(); err != nil {
+			return err
+		}
+		if !arn.ARN(serials[i]).Valid() {
+			return nil // Hardware device
+		}
+		vin := iam.DeleteVirtualMFADeviceInput{SerialNumber: sn}
+		_, err := c.DeleteVirtualMFADeviceRequest(&vin).Send()
+		return err
+	})
+}
+
+// deleteSigningCerts deletes all signing certificates of the specified user.
+func deleteSigningCerts(c iamx.Client, user *string) error {
+	in := iam.ListSigningCertificatesInput{UserName: user}
+	r := c.ListSigningCertificatesRequest(&in)
+	p := r.Paginate()
+	var ids []string
+	for p.Next() {
+		for _, cert := range p.CurrentPage().Certificates {
+			ids = append(ids, aws.StringValue(cert.CertificateId))
+		}
+	}
+	if err := p.Err(); err != nil {
+		return err
+	}
+	return fast.ForEachIO(len(ids), func(i int) error {
+		in := iam.DeleteSigningCertificateInput{
+			CertificateId: aws.String(ids[i]),
+			UserName:      user,
+		}
+		_, err := c.DeleteSigningCertificateRequest(&in).Send()
+		return err
+	})
+}
+
+// deleteSSHPublicKeys deletes all SSH public keys of the specified user.
+func deleteSSHPublicKeys(c iamx.Client, user *string) error {
+	in := iam.ListSSHPublicKeysInput{UserName: user}
+	r := c.ListSSHPublicKeysRequest(&in)
+	p := r.Paginate()
+	var ids []string
+	for p.Next() {
+		for _, k := range p.CurrentPage().SSHPublicKeys {
+			ids = append(ids, aws.StringValue(k.SSHPublicKeyId))
+		}
+	}
+	if err := p.Err(); err != nil {
+		return err
+	}
+	return fast.ForEachIO(len(ids), func(i int) error {
+		in := iam.DeleteSSHPublicKeyInput{
+			SSHPublicKeyId: aws.String(ids[i]),
+			UserName:       user,
+		}
+		_, err := c.DeleteSSHPublicKeyRequest(&in).Send()
+		return err
+	})
+}
+
+// deleteServiceCreds deletes all service-specific credentials (e.g. for
+// CodeCommit) of the specified user.
+func deleteServiceCreds(c iamx.Client, user *string) error {
+	in := iam.ListServiceSpecificCredentialsInput{UserName: user}
+	out, err := c.ListServiceSpecificCredentialsRequest(&in).Send()
+	if err != nil {
+		return err
+	}
+	creds := out.ServiceSpecificCredentials
+	return fast.ForEachIO(len(creds), func(i int) error {
+		in := iam.DeleteServiceSpecificCredentialInput{
+			ServiceSpecificCredentialId: creds[i].ServiceSpecificCredentialId,
+			UserName:                    user,
+		}
+		_, err := c.DeleteServiceSpecificCredentialRequest(&in).Send()
+		return err
+	})
+}
+
+// deleteRoles deletes all roles under the specified path after removing them
+// from any instance profiles, including those outside of the path.
+func deleteRoles(c iamx.Client, path string) (int, error) {
+	roles, err := listRoles(c, path)
+	if err != nil {
+		return 0, err
+	}
+	err = fast.ForEachIO(len(roles), func(i int) error {
+		err := removeFromInstanceProfiles(c, roles[i].RoleName)
+		if err == nil {
+			err = c.DeleteRole(aws.StringValue(roles[i].RoleName))
+		}
+		return err
+	})
+	return countDeleted(len(roles), err)
+}
+
+// removeFromInstanceProfiles removes a role from all of its instance profiles.
+func removeFromInstanceProfiles(c iamx.Client, role *string) error {
+	in := iam.ListInstanceProfilesForRoleInput{RoleName: role}
+	r := c.ListInstanceProfilesForRoleRequest(&in)
+	p := r.Paginate()
+	var names []*string
+	for p.Next() {
+		for _, ip := range p.CurrentPage().InstanceProfiles {
+			names = append(names, ip.InstanceProfileName)
+		}
+	}
+	if err := p.Err(); err != nil {
+		return err
+	}
+	return fast.ForEachIO(len(names), func(i int) error {
+		in := iam.RemoveRoleFromInstanceProfileInput{
+			InstanceProfileName: names[i],
+			RoleName:            role,
+		}
+		_, err := c.RemoveRoleFromInstanceProfileRequest(&in).Send()
+		return err
+	})
+}
+
+// deletePolicies deletes all customer-managed policies under the specified
+// path. Policies are detached from all entities, including those outside of
+// the path, and all non-default versions are deleted first.
+func deletePolicies(c iamx.Client, path string) (int, error) {
+	in := iam.ListPoliciesInput{
+		PathPrefix: aws.String(path),
+		Scope:      iam.PolicyScopeTypeLocal,
+	}
+	r := c.ListPoliciesRequest(&in)
+	p := r.Paginate()
+	var arns []string
+	for p.Next() {
+		for _, pol := range p.CurrentPage().Policies {
+			arns = append(arns, aws.StringValue(pol.Arn))
+		}
+	}
+	if err := p.Err(); err != nil {
+		return 0, err
+	}
+	err := fast.ForEachIO(len(arns), func(i int) error {
+		pa := aws.String(arns[i])
+		err := fast.Call(
+			func() error { return detachPolicy(c, pa) },
+			func() error { return deletePolicyVersions(c, pa) },
+		)
+		if err == nil {
+			in := iam.DeletePolicyInput{PolicyArn: pa}
+			_, err = c.DeletePolicyRequest(&in).Send()
+		}
+		return err
+	})
+	return countDeleted(len(arns), err)
+}
+
+// detachPolicy detaches a managed policy from all groups, roles, and users.
+func detachPolicy(c iamx.Client, pa *string) error {
+	in := iam.ListEntitiesForPolicyInput{PolicyArn: pa}
+	r := c.ListEntitiesForPolicyRequest(&in)
+	p := r.Paginate()
+	var detach []func() error
+	for p.Next() {
+		out := p.CurrentPage()
+		for _, g := range out.PolicyGroups {
+			in := &iam.DetachGroupPolicyInput{GroupName: g.GroupName, PolicyArn: pa}
+			detach = append(detach, func() error {
+				_, err := c.DetachGroupPolicyRequest(in).Send()
+				return err
+			})
+		}
+		for _, r := range out.PolicyRoles {
+			in := &iam.DetachRolePolicyInput{PolicyArn: pa, RoleName: r.RoleName}
+			detach = append(detach, func() error {
+				_, err := c.DetachRolePolicyRequest(in).Send()
+				return err
+			})
+		}
+		for _, u := range out.PolicyUsers {
+			in := &iam.DetachUserPolicyInput{PolicyArn: pa, UserName: u.UserName}
+			detach = append(detach, func() error {
+				_, err := c.DetachUserPolicyRequest(in).Send()
+				return err
+			})
+		}
+	}
+	if err := p.Err(); err != nil {
+		return err
+	}
+	return fast.Call(detach...)
+}
+
+// deletePolicyVersions deletes all non-default versions of a managed policy.
+func deletePolicyVersions(c iamx.Client, pa *string) error {
+	in := iam.ListPolicyVersionsInput{PolicyArn: pa}
+	r := c.ListPolicyVersionsRequest(&in)
+	p := r.Paginate()
+	var ids []string
+	for p.Next() {
+		for _, v := range p.CurrentPage().Versions {
+			if !aws.BoolValue(v.IsDefaultVersion) {
+				ids = append(ids, aws.StringValue(v.VersionId))
+			}
+		}
+	}
+	if err := p.Err(); err != nil {
+		return err
+	}
+	return fast.ForEachIO(len(ids), func(i int) error {
+		in := iam.DeletePolicyVersionInput{
+			PolicyArn: pa,
+			VersionId: aws.String(ids[i]),
+		}
+		_, err := c.DeletePolicyVersionRequest(&in).Send()
+		return err
+	})
+}
+
+// deleteSAMLProviders deletes all SAML providers with names that start with
+// op.IAMTmpPrefix. SAML providers do not have a path, so the path argument is
+// ignored.
+func deleteSAMLProviders(c iamx.Client, _ string) (int, error) {
+	out, err := c.ListSAMLProvidersRequest(&iam.ListSAMLProvidersInput{}).Send()
+	if err != nil {
+		return 0, err
+	}
+	var arns []*string
+	for _, p := range out.SAMLProviderList {
+		if strings.HasPrefix(arn.Value(p.Arn).Name(), op.IAMTmpPrefix) {
+			arns = append(arns, p.Arn)
+		}
+	}
+	err = fast.ForEachIO(len(arns), func(i int) error {
+		in := iam.DeleteSAMLProviderInput{SAMLProviderArn: arns[i]}
+		_, err := c.DeleteSAMLProviderRequest(&in).Send()
+		return err
+	})
+	return countDeleted(len(arns), err)
+}
+
+// countDeleted returns the number of deleted entities. Partial failures are
+// reported as zero deletions because the exact count is unknown.
+func countDeleted(n int, err error) (int, error) {
+	if err != nil {
+		n = 0
+	}
+	return n, err
 }
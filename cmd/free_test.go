@@ -1,8 +1,14 @@
 package cmd
 
 import (
+	"os"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/mxk/go-fast"
 	"github.com/mxk/oktapus/mock"
 	"github.com/mxk/oktapus/op"
 	"github.com/stretchr/testify/assert"
@@ -17,10 +23,231 @@ func TestFree(t *testing.T) {
 	cmd := freeCmd{Spec: "test1,test2"}
 	out, err := cmd.Run(ctx)
 	require.NoError(t, err)
-	want := []*ownerOutput{{
+	want := []*freeOutput{{
 		Account: "000000000001",
 		Name:    "test1",
 		Result:  "OK",
 	}}
 	assert.Equal(t, want, out)
 }
+
+func TestFreeHooks(t *testing.T) {
+	ctx, w := mockOrg(mock.Ctx, "test1", "test2", "test3")
+	setCtl(w, op.Ctl{Owner: "alice", Tags: op.Tags{"hook"}}, "1", "2")
+	setCtl(w, op.Ctl{Owner: "alice"}, "3")
+	ctx.Hooks.PreFree = map[string][]string{
+		"hook": {os.Args[0], "-test.run=TestExec"},
+	}
+	os.Setenv(testEnv, "hook")
+	defer os.Unsetenv(testEnv)
+
+	cmd := freeCmd{Spec: "test1,test2,test3"}
+	out, err := cmd.Run(ctx)
+	require.NoError(t, err)
+	want := []*freeOutput{{
+		Account: "000000000001",
+		Name:    "test1",
+		Result:  "OK",
+	}, {
+		Account: "000000000002",
+		Name:    "test2",
+		Owner:   "alice",
+		Result: "ERROR: pre_free hook failed: exit status 1 " +
+			"(AWS_SESSION_TOKEN=arn:aws:sts::000000000002:assumed-role/alice/alice)",
+	}, {
+		Account: "000000000003",
+		Name:    "test3",
+		Result:  "OK",
+	}}
+	assert.Equal(t, want, out)
+
+	// Hook failures are not quarantined
+	cmd = freeCmd{Quarantine: true, Spec: "test2"}
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, want[1:2], out)
+
+	fast.MockSleep(-1)
+	defer fast.MockSleep(0)
+	alloc := allocCmd{Spec: "hook"}
+	out, err = alloc.Run(ctx)
+	require.NoError(t, err)
+	require.Len(t, out, 1)
+	assert.Equal(t, "test1", out.([]*ownerOutput)[0].Name)
+}
+
+func TestFreeQuarantine(t *testing.T) {
+	ctx, w := mockOrg(mock.Ctx, "test1")
+	setCtl(w, op.Ctl{Owner: "alice"}, "1")
+	fail := awserr.New("ServiceFailure", "cleanup failed", nil)
+	w.Account("1").Add(mock.RouterFunc(func(q *mock.Request) bool {
+		if _, ok := q.Params.(*iam.ListUsersInput); ok {
+			q.Error = fail
+			return true
+		}
+		return false
+	}))
+	cmd := freeCmd{Quarantine: true, Spec: "test1"}
+	out, err := cmd.Run(ctx)
+	require.NoError(t, err)
+	msg := explainError(fail)
+	want := []*freeOutput{{
+		Account: "000000000001",
+		Name:    "test1",
+		Result:  "QUARANTINED: " + msg,
+	}}
+	assert.Equal(t, want, out)
+	var ctl op.Ctl
+	role := w.Account("1").RoleRouter()[op.CtlRole]
+	require.NoError(t, ctl.Decode(aws.StringValue(role.Description)))
+	assert.Equal(t, op.Ctl{Maint: "free: " + msg}, ctl)
+}
+
+func TestFreeCleanup(t *testing.T) {
+	ctx, w := mockOrg(mock.Ctx, "test1")
+	setCtl(w, op.Ctl{Owner: "alice"}, "1")
+	ac := w.Account("1")
+	tmp := aws.String(op.IAMTmpPath)
+	pol := arn.ARN("arn:aws:iam::000000000001:policy/oktapus/tmp/P1")
+	admin := arn.ARN("arn:aws:iam::aws:policy/AdministratorAccess")
+	ac.PolicyRouter()[pol] = &mock.Policy{
+		Policy: iam.Policy{Arn: arn.String(pol), Path: tmp},
+		Versions: []*iam.PolicyVersion{
+			{VersionId: aws.String("v1")},
+			{VersionId: aws.String("v2"), IsDefaultVersion: aws.Bool(true)},
+		},
+	}
+	pol2 := arn.ARN("arn:aws:iam::000000000001:policy/oktapus/tmp/P2")
+	ac.PolicyRouter()[pol2] = &mock.Policy{
+		Policy: iam.Policy{Arn: arn.String(pol2), Path: tmp},
+		Versions: []*iam.PolicyVersion{
+			{VersionId: aws.String("v1"), IsDefaultVersion: aws.Bool(true)},
+		},
+	}
+	roles := ac.RoleRouter()
+	roles["r1"] = &mock.Role{
+		Role:             iam.Role{Path: tmp, RoleName: aws.String("r1")},
+		AttachedPolicies: map[arn.ARN]string{pol: "P1"},
+		InlinePolicies:   map[string]string{"inline": "{}"},
+	}
+	roles["keep"] = &mock.Role{
+		Role:             iam.Role{Path: aws.String(op.IAMPath), RoleName: aws.String("keep")},
+		AttachedPolicies: map[arn.ARN]string{pol: "P1", admin: "AdministratorAccess"},
+	}
+	roles["r2"] = &mock.Role{Role: iam.Role{Path: tmp, RoleName: aws.String("r2")}}
+	ac.InstanceProfileRouter()["ip1"] = &iam.InstanceProfile{
+		InstanceProfileName: aws.String("ip1"),
+		Path:                tmp,
+		Roles:               []iam.Role{{RoleName: aws.String("r1")}},
+	}
+	ac.InstanceProfileRouter()["ec2"] = &iam.InstanceProfile{
+		InstanceProfileName: aws.String("ec2"),
+		Path:                aws.String("/"),
+		Roles:               []iam.Role{{RoleName: aws.String("r2")}},
+	}
+	users := ac.UserRouter()
+	users["u1"] = &mock.User{
+		User:           iam.User{Path: tmp, UserName: aws.String("u1")},
+		InlinePolicies: map[string]string{"inline": "{}"},
+		LoginProfile:   &iam.LoginProfile{UserName: aws.String("u1")},
+		MFADevices: []*iam.MFADevice{
+			{SerialNumber: aws.String("arn:aws:iam::000000000001:mfa/u1")},
+			{SerialNumber: aws.String("GAHT12345678")},
+		},
+		SigningCerts: []*iam.SigningCertificate{
+			{CertificateId: aws.String("CERTIFICATE0123456789ABC")},
+		},
+		SSHPublicKeys: []*iam.SSHPublicKeyMetadata{
+			{SSHPublicKeyId: aws.String("APKAEIBAERJR2EXAMPLE")},
+		},
+		ServiceCreds: []*iam.ServiceSpecificCredentialMetadata{
+			{ServiceSpecificCredentialId: aws.String("ACCAEXAMPLE123EXAMPLE")},
+		},
+	}
+	users["bob"] = &mock.User{User: iam.User{Path: aws.String("/"), UserName: aws.String("bob")}}
+	ac.GroupRouter()["g1"] = &mock.Group{
+		Group:            iam.Group{GroupName: aws.String("g1"), Path: tmp},
+		Users:            map[string]bool{"u1": true, "bob": true},
+		AttachedPolicies: map[arn.ARN]string{pol2: "P2"},
+		InlinePolicies:   map[string]string{"inline": "{}"},
+	}
+	ac.GroupRouter()["keep"] = &mock.Group{
+		Group: iam.Group{GroupName: aws.String("keep"), Path: aws.String("/")},
+		Users: map[string]bool{"u1": true, "bob": true},
+	}
+	saml := ac.SAMLProviderRouter()
+	for _, name := range []string{op.IAMTmpPrefix + "idp", "okta"} {
+		pa := arn.ARN("arn:aws:iam::000000000001:saml-provider/" + name)
+		saml[pa] = &iam.SAMLProviderListEntry{Arn: arn.String(pa)}
+	}
+
+	cmd := freeCmd{Spec: "test1"}
+	out, err := cmd.Run(ctx)
+	require.NoError(t, err)
+	want := []*freeOutput{{
+		Account: "000000000001",
+		Name:    "test1",
+		Deleted: "1 instance profile, 1 group, 1 user, 2 roles, 2 policies, " +
+			"1 SAML provider",
+		Result: "OK",
+	}}
+	assert.Equal(t, want, out)
+	require.Len(t, ac.InstanceProfileRouter(), 1)
+	assert.Empty(t, ac.InstanceProfileRouter()["ec2"].Roles)
+	assert.Len(t, ac.GroupRouter(), 1)
+	assert.Equal(t, map[string]bool{"bob": true}, ac.GroupRouter()["keep"].Users)
+	assert.Len(t, saml, 1)
+	assert.Contains(t, saml, arn.ARN("arn:aws:iam::000000000001:saml-provider/okta"))
+	assert.Empty(t, ac.PolicyRouter())
+	assert.Len(t, users, 1)
+	assert.Contains(t, users, "bob")
+	assert.Len(t, roles, 2)
+	assert.Equal(t, map[arn.ARN]string{admin: "AdministratorAccess"},
+		roles["keep"].AttachedPolicies)
+}
+
+func TestFreeTeam(t *testing.T) {
+	ctx, w := mockOrg(mock.Ctx, "test1", "test2", "test3", "test4")
+	setCtl(w, op.Ctl{Owner: "bob", Team: "infra"}, "1")
+	setCtl(w, op.Ctl{Owner: "bob", Admins: []string{"bob"}}, "2")
+	setCtl(w, op.Ctl{Owner: "carol"}, "3", "4")
+	ctx.Teams = map[string][]string{"infra": {"alice", "bob"}}
+	ctx.Admins = []string{"alice"}
+
+	cmd := freeCmd{Spec: "test1,test2,test3"}
+	out, err := cmd.Run(ctx)
+	require.NoError(t, err)
+	want := []*freeOutput{{
+		Account: "000000000001",
+		Name:    "test1",
+		Result:  "OK",
+	}}
+	assert.Equal(t, want, out)
+
+	cmd = freeCmd{Force: true, Quarantine: true, Spec: "test2,test3"}
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	want = []*freeOutput{{
+		Account: "000000000002",
+		Name:    "test2",
+		Owner:   "bob",
+		Result:  "ERROR: " + op.ErrNotAdmin.Error(),
+	}, {
+		Account: "000000000003",
+		Name:    "test3",
+		Result:  "OK",
+	}}
+	assert.Equal(t, want, out)
+
+	var ctl op.Ctl
+	role := w.Account("2").RoleRouter()[op.CtlRole]
+	require.NoError(t, ctl.Decode(aws.StringValue(role.Description)))
+	assert.Equal(t, op.Ctl{Owner: "bob", Admins: []string{"bob"}}, ctl)
+
+	// Without any admins, everyone may use -force
+	ctx.Admins = nil
+	cmd = freeCmd{Force: true, Spec: "test4"}
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "OK", out.([]*freeOutput)[0].Result)
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+
+	"github.com/mxk/oktapus/op"
+	"github.com/pkg/errors"
+)
+
+// Account environment variables set for hook commands.
+const (
+	hookAccountIDEnv   = "OKTAPUS_ACCOUNT_ID"
+	hookAccountNameEnv = "OKTAPUS_ACCOUNT_NAME"
+)
+
+// runHooks runs each hook command that applies to account ac, stopping at the
+// first failure. Commands are executed with account credentials, the same way
+// as the exec command. Their output is discarded, except for the last line of
+// a failed command, which is included in the returned error.
+func runHooks(ctx *op.Ctx, ac *op.Account, kind string, hooks map[string][]string) error {
+	cmds := op.HookCmds(hooks, ac.Ctl.Tags)
+	if len(cmds) == 0 {
+		return nil
+	}
+	if err := ac.CredsProvider().Ensure(minDur); err != nil {
+		return err
+	}
+	env := append(execEnv(ctx),
+		hookAccountIDEnv+"="+ac.ID,
+		hookAccountNameEnv+"="+ac.Name,
+	)
+	env = env[:len(env):len(env)]
+	for _, c := range cmds {
+		path, err := exec.LookPath(c[0])
+		if err != nil {
+			return errors.Wrapf(err, "%s hook failed", kind)
+		}
+		var out bytes.Buffer
+		tpl := exec.Cmd{
+			Path:   path,
+			Args:   c,
+			Env:    env,
+			Stdout: &out,
+			Stderr: &out,
+		}
+		if err = run(tpl, ac); err != nil {
+			s := strings.TrimSpace(out.String())
+			if s == "" {
+				return errors.Wrapf(err, "%s hook failed", kind)
+			}
+			s = s[strings.LastIndexByte(s, '\n')+1:]
+			return errors.Errorf("%s hook failed: %v (%s)", kind, err, s)
+		}
+	}
+	return nil
+}
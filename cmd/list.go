@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"strings"
+
 	"github.com/mxk/go-cli"
 	"github.com/mxk/oktapus/op"
 	"github.com/mxk/oktapus/table"
@@ -28,10 +30,14 @@ func (*listCmd) Help(w *cli.Writer) {
 
 	By default, this command lists only accessible and initialized accounts. Use
 	"all" to list all known accounts. Use the 'tag' command to initialize
-	account control (-init option) and set account tags.
+	account control (-init option) and set account tags. The team, admins, and
+	maint columns are omitted if no accounts have these attributes set.
 
 	In rare circumstances, it may be helpful to run 'kill-daemon' command to
 	reset cache when diagnosing access problems.
+
+	In IAM mode, a warning is printed if the gateway access key is older than
+	` + op.KeyMaxAgeEnv + `. Use 'rotate-key' command to replace it.
 	`)
 	accountSpecHelp(w)
 }
@@ -48,13 +54,18 @@ func (cmd *listCmd) Run(ctx *op.Ctx) (interface{}, error) {
 		}
 	}
 	acs, err := ctx.Match(cmd.Spec)
+	warnKeyAge(ctx)
 	return listAccounts(acs), err
 }
 
 type listOutput struct {
 	Account     string
 	Name        string
+	Org         string `json:",omitempty" printer:",omitempty"`
 	Owner       string
+	Team        string `json:",omitempty" printer:",omitempty"`
+	Admins      string `json:",omitempty" printer:",omitempty"`
+	Maint       string `json:",omitempty" printer:",omitempty"`
 	Description string
 	Tags        string `printer:",last"`
 	Error       string `json:",omitempty"`
@@ -66,7 +77,11 @@ func listAccounts(acs op.Accounts) []*listOutput {
 		out[i] = &listOutput{
 			Account:     ac.ID,
 			Name:        ac.Name,
+			Org:         ac.Gateway,
 			Owner:       ac.Ctl.Owner,
+			Team:        ac.Ctl.Team,
+			Admins:      strings.Join(ac.Ctl.Admins, ","),
+			Maint:       ac.Ctl.Maint,
 			Description: ac.Ctl.Desc,
 			Tags:        ac.Ctl.Tags.String(),
 			Error:       explainError(ac.Err),
@@ -81,6 +96,7 @@ func (o *listOutput) PrintRow(p *table.Printer) {
 	} else {
 		p.PrintCol(0, o.Account, true)
 		p.PrintCol(1, o.Name, true)
+		p.PrintCol(2, o.Org, true)
 		p.PrintErr(o.Error)
 	}
 }
@@ -0,0 +1,629 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/mxk/go-cli"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/mxk/go-cloud/aws/awsx"
+	"github.com/mxk/go-cloud/aws/iamx"
+	"github.com/mxk/go-fast"
+	"github.com/mxk/oktapus/account"
+	"github.com/mxk/oktapus/op"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+var planCli = cli.Main.Add(&cli.Info{
+	Name:    "plan",
+	Usage:   "[options] -f file",
+	Summary: "Show changes needed to reach the desired account state",
+	New:     func() cli.Cmd { return &planCmd{} },
+})
+
+var applyCli = cli.Main.Add(&cli.Info{
+	Name:    "apply",
+	Usage:   "[options] -f file",
+	Summary: "Apply desired account state",
+	New:     func() cli.Cmd { return &planCmd{apply: true} },
+})
+
+type planCmd struct {
+	OutFmt
+	File string `flag:"f,Desired state <file>"`
+
+	apply bool
+}
+
+func (cmd *planCmd) Info() *cli.Info {
+	if cmd.apply {
+		return applyCli
+	}
+	return planCli
+}
+
+func (cmd *planCmd) Help(w *cli.Writer) {
+	if cmd.apply {
+		w.Text(`
+		Apply desired account state.
+
+		This command makes the changes shown by 'plan'. See 'oktapus help plan'
+		for the file format.
+		`)
+		return
+	}
+	w.Text(`
+	Show changes needed to reach the desired account state.
+
+	The desired state of account control information and IAM roles is declared
+	in a YAML file. Each entry in the accounts list applies to all accounts
+	matching its account spec. The optional desc and tags keys change account
+	control information in the same way as the 'tag' command. Each entry in the
+	roles list declares an IAM role with the exact set of principals that may
+	assume it and managed policies that are attached to it. Roles are named and
+	principals are specified in the same way as for 'authz -role'. Roles that
+	are not declared are not modified.
+
+	The optional require_mfa, external_id, and source_ip keys declare trust
+	policy conditions for AWS principals, and oidc_aud and oidc_sub declare
+	token conditions for web identity principals, in the same way as the
+	corresponding 'authz' options. Web identity principals require oidc_aud
+	and, for shared providers, oidc_sub.
+
+	Example:
+
+	  accounts:
+	  - spec: team-a
+	    desc: Team A sandbox
+	    tags: team-a,!unused
+	    roles:
+	    - name: developer
+	      principals: [user/alice, user/bob]
+	      policies: [PowerUserAccess]
+	      require_mfa: true
+
+	Only principals that are added, removed, or whose conditions differ from
+	the declared ones are changed in existing AssumeRole policies. Expiration
+	conditions set by 'authz -expires' are kept for principals that remain.
+	Use 'apply' to make the changes.
+	`)
+}
+
+func (cmd *planCmd) Main(args []string) error {
+	if cmd.File == "" {
+		return cli.Error("-f is required")
+	}
+	return op.RunAndPrint(cmd)
+}
+
+func (cmd *planCmd) Run(ctx *op.Ctx) (interface{}, error) {
+	b, err := ioutil.ReadFile(cmd.File)
+	if err != nil {
+		return nil, err
+	}
+	var sf stateFile
+	if err = yaml.UnmarshalStrict(b, &sf); err != nil {
+		return nil, errors.Wrapf(err, "invalid state file %q", cmd.File)
+	}
+	acs, plans, err := sf.plan(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid state file %q", cmd.File)
+	}
+
+	// Account control information
+	ctl := make([]*planOutput, len(acs))
+	update := acs.Filter(func(ac *op.Account) bool {
+		p := plans[ac]
+		if p.desc == nil && len(p.set)+len(p.clr) == 0 {
+			return false
+		}
+		out := &planOutput{Account: ac.ID, Name: ac.Name, Object: "ctl"}
+		if !ac.CtlValid() {
+			out.Result = "ERROR: " + explainError(op.Accounts{ac}.CtlOrErr()[0].Err)
+			ctl[indexOf(acs, ac)] = out
+			return false
+		}
+		var changes []string
+		desc := ac.Ctl.Desc
+		if p.desc != nil && *p.desc != desc {
+			desc = *p.desc
+			changes = append(changes, fmt.Sprintf("desc=%q", desc))
+		}
+		tags := append(op.Tags(nil), ac.Ctl.Tags...)
+		tags.Apply(p.set, p.clr)
+		set, clr := tags.Diff(ac.Ctl.Tags)
+		for _, t := range set {
+			changes = append(changes, "+"+t)
+		}
+		for _, t := range clr {
+			changes = append(changes, "-"+t)
+		}
+		if len(changes) == 0 {
+			return false
+		}
+		out.Result = "WOULD UPDATE"
+		out.Changes = strings.Join(changes, ", ")
+		ctl[indexOf(acs, ac)] = out
+		if cmd.apply {
+			ac.Ctl.Desc, ac.Ctl.Tags = desc, tags
+		}
+		return true
+	})
+	if cmd.apply {
+		update.StoreCtl()
+		for _, ac := range update {
+			out := ctl[indexOf(acs, ac)]
+			if out.Result = "UPDATED"; ac.Err != nil {
+				out.Result = "ERROR: " + explainError(ac.Err)
+			}
+		}
+	}
+
+	// Roles
+	roles := make([][]*planOutput, len(acs))
+	acs.EnsureCreds(minDur).Map(func(i int, ac *op.Account) error {
+		rps := plans[ac].roles
+		if len(rps) == 0 {
+			return nil
+		}
+		if !ac.CredsValid() {
+			roles[i] = []*planOutput{{
+				Account: ac.ID,
+				Name:    ac.Name,
+				Result:  "ERROR: " + explainError(ac.Err),
+			}}
+			return nil
+		}
+		id := ctx.Ident().Ctx()
+		id.Account = ac.ID
+		out := make([]*planOutput, len(rps))
+		fast.ForEachIO(len(rps), func(j int) error {
+			r := rps[j]
+			result, changes, err := r.exec(ac.IAM, cmd.apply)
+			if err != nil {
+				result = "ERROR: " + explainError(err)
+			} else if result == "" {
+				return nil
+			}
+			out[j] = &planOutput{
+				Account: ac.ID,
+				Name:    ac.Name,
+				Object:  string(id.New("iam", "role", r.path, r.name)),
+				Result:  result,
+				Changes: changes,
+			}
+			return nil
+		})
+		for _, o := range out {
+			if o != nil {
+				roles[i] = append(roles[i], o)
+			}
+		}
+		return nil
+	})
+
+	var out []*planOutput
+	for i := range acs {
+		if ctl[i] != nil {
+			out = append(out, ctl[i])
+		}
+		out = append(out, roles[i]...)
+	}
+	return out, nil
+}
+
+type planOutput struct {
+	Account string
+	Name    string
+	Object  string
+	Result  string
+	Changes string `printer:",last"`
+}
+
+// stateFile is the desired state file format.
+type stateFile struct {
+	Accounts []*accountState `yaml:"accounts"`
+}
+
+// accountState is the desired state of all accounts matching an account spec.
+type accountState struct {
+	Spec  string       `yaml:"spec"`
+	Desc  *string      `yaml:"desc"`
+	Tags  string       `yaml:"tags"`
+	Roles []*roleState `yaml:"roles"`
+}
+
+// roleState is the desired state of an IAM role.
+type roleState struct {
+	Name       string   `yaml:"name"`
+	Principals []string `yaml:"principals"`
+	Policies   []string `yaml:"policies"`
+	RequireMFA bool     `yaml:"require_mfa"`
+	ExternalID string   `yaml:"external_id"`
+	SourceIP   string   `yaml:"source_ip"`
+	OIDCAud    string   `yaml:"oidc_aud"`
+	OIDCSub    string   `yaml:"oidc_sub"`
+}
+
+// accountPlan contains all changes requested for one account.
+type accountPlan struct {
+	desc     *string
+	set, clr op.Tags
+	roles    []*rolePlan
+}
+
+// plan returns matching accounts sorted by name and their requested changes.
+func (sf *stateFile) plan(ctx *op.Ctx) (op.Accounts, map[*op.Account]*accountPlan, error) {
+	var acs op.Accounts
+	plans := make(map[*op.Account]*accountPlan)
+	for i, as := range sf.Accounts {
+		if as.Spec == "" {
+			return nil, nil, fmt.Errorf("accounts[%d]: missing spec", i)
+		}
+		set, clr, err := op.ParseTags(as.Tags)
+		if err != nil {
+			return nil, nil, fmt.Errorf("accounts[%d]: %v", i, err)
+		}
+		rps := make([]*rolePlan, len(as.Roles))
+		for j, rs := range as.Roles {
+			if rps[j], err = newRolePlan(ctx, rs); err != nil {
+				return nil, nil, fmt.Errorf("accounts[%d].roles[%d]: %v",
+					i, j, err)
+			}
+		}
+		match, err := ctx.Match(as.Spec)
+		if err != nil {
+			return nil, nil, fmt.Errorf("accounts[%d]: %v", i, err)
+		}
+		for _, ac := range match {
+			p := plans[ac]
+			if p == nil {
+				p = new(accountPlan)
+				plans[ac] = p
+				acs = append(acs, ac)
+			}
+			if as.Desc != nil {
+				p.desc = as.Desc
+			}
+			p.set = append(p.set, set...)
+			p.clr = append(p.clr, clr...)
+			for _, r := range rps {
+				for _, q := range p.roles {
+					if q.name == r.name {
+						return nil, nil, fmt.Errorf("role %q is declared "+
+							"more than once for account %s", r.name, ac.Name)
+					}
+				}
+				p.roles = append(p.roles, r)
+			}
+		}
+	}
+	return acs.SortByName(), plans, nil
+}
+
+// rolePlan reconciles an IAM role with its declared state.
+type rolePlan struct {
+	path       string
+	name       string
+	principals []string
+	policies   []arn.ARN
+	trust      *trustConds
+}
+
+// newRolePlan validates the declared role state.
+func newRolePlan(ctx *op.Ctx, rs *roleState) (*rolePlan, error) {
+	if rs.Name == "" {
+		return nil, errors.New("missing role name")
+	} else if len(rs.Principals) == 0 {
+		return nil, errors.New("no principals")
+	}
+	path, name, err := splitPathName(rs.Name, false)
+	if err != nil {
+		return nil, err
+	}
+	r := &rolePlan{
+		path:       path,
+		name:       name,
+		principals: append([]string(nil), rs.Principals...),
+		policies:   make([]arn.ARN, len(rs.Policies)),
+	}
+	r.trust, err = newTrustConds(rs.RequireMFA, rs.ExternalID, rs.SourceIP,
+		rs.OIDCAud, rs.OIDCSub)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkPrincipals(ctx.Ident().Ctx(), r.principals, true); err != nil {
+		return nil, err
+	}
+	if err = checkWebIdentity(r.principals, r.trust); err != nil {
+		return nil, err
+	}
+	for i, p := range rs.Policies {
+		if r.policies[i], err = getManagedPolicy(ctx.Ident().Partition(), p); err != nil {
+			return nil, err
+		} else if r.policies[i] == "" {
+			return nil, errors.New("empty policy name")
+		}
+	}
+	return r, nil
+}
+
+// exec compares the role with its declared state. If apply is true, the role
+// is created or updated to match. It returns an empty result if the role is
+// already in the declared state.
+func (r *rolePlan) exec(c iamx.Client, apply bool) (result, changes string, err error) {
+	in := iam.GetRoleInput{RoleName: aws.String(r.name)}
+	out, err := c.GetRoleRequest(&in).Send()
+	if err != nil && awsx.ErrCode(err) != iam.ErrCodeNoSuchEntityException {
+		return "", "", err
+	}
+	create := err != nil
+	pol := &iamx.Policy{Version: iamx.PolicyVersion2012}
+	var attached []arn.ARN
+	if !create {
+		role := out.Role
+		if aws.StringValue(role.Path) != r.path {
+			return "", "", op.Error("role path mismatch")
+		}
+		if pol, err = iamx.ParsePolicy(role.AssumeRolePolicyDocument); err != nil {
+			return "", "", err
+		}
+		if attached, err = attachedPolicyARNs(c, role.RoleName); err != nil {
+			return "", "", err
+		}
+	}
+	cur := principalConds(pol)
+	ids := normPrincipals(r.principals)
+	sort.Strings(ids)
+	var addIDs, modIDs, all []string
+	for _, id := range dedupSorted(ids) {
+		want := r.conditions(id)
+		if conds, ok := cur[id]; !ok {
+			addIDs = append(addIDs, id)
+			if all = append(all, "+"+id); len(want) > 0 {
+				all[len(all)-1] += " if " + condString(want)
+			}
+		} else if !hasConditions(conds, want) {
+			modIDs = append(modIDs, id)
+			all = append(all, "~"+id+" if "+
+				condString(withoutExpiry(conds[0]))+" -> "+condString(want))
+		}
+	}
+	_, rmIDs := setDiff(ids, mapKeys(cur))
+	attach, detach := setDiff(arnStrings(r.policies), arnStrings(attached))
+	for _, v := range rmIDs {
+		all = append(all, "-"+v)
+	}
+	for _, v := range attach {
+		all = append(all, "+"+v)
+	}
+	for _, v := range detach {
+		all = append(all, "-"+v)
+	}
+	if changes = strings.Join(all, ", "); changes == "" {
+		return "", "", nil
+	}
+	if !apply {
+		if create {
+			return "WOULD CREATE", changes, nil
+		}
+		return "WOULD UPDATE", changes, nil
+	}
+
+	// Only modify the statements of changed principals
+	isAllow := func(s *iamx.Statement) bool { return s.Effect == iamx.Allow }
+	removePrincipals(pol, append(rmIDs, modIDs...), isAllow)
+	for _, id := range addIDs {
+		for _, s := range trustStatements([]string{id}, r.trust, time.Time{}) {
+			appendAssumeRolePolicy(pol, s)
+		}
+	}
+	for _, id := range modIDs {
+		exp := condsExpiry(cur[id])
+		for _, s := range trustStatements([]string{id}, r.trust, exp) {
+			appendAssumeRolePolicy(pol, s)
+		}
+	}
+	if result = "UPDATED"; create {
+		result = "CREATED"
+		_, err = c.CreateRoleRequest(&iam.CreateRoleInput{
+			AssumeRolePolicyDocument: pol.Doc(),
+			Path:                     aws.String(r.path),
+			RoleName:                 aws.String(r.name),
+		}).Send()
+	} else if len(addIDs)+len(modIDs)+len(rmIDs) > 0 {
+		_, err = c.UpdateAssumeRolePolicyRequest(&iam.UpdateAssumeRolePolicyInput{
+			PolicyDocument: pol.Doc(),
+			RoleName:       aws.String(r.name),
+		}).Send()
+	}
+	for _, p := range attach {
+		if err != nil {
+			break
+		}
+		_, err = c.AttachRolePolicyRequest(&iam.AttachRolePolicyInput{
+			PolicyArn: aws.String(p),
+			RoleName:  aws.String(r.name),
+		}).Send()
+	}
+	for _, p := range detach {
+		if err != nil {
+			break
+		}
+		_, err = c.DetachRolePolicyRequest(&iam.DetachRolePolicyInput{
+			PolicyArn: aws.String(p),
+			RoleName:  aws.String(r.name),
+		}).Send()
+	}
+	return result, changes, err
+}
+
+// conditions returns the declared AssumeRole policy conditions for principal
+// id, which must be normalized by checkPrincipals.
+func (r *rolePlan) conditions(id string) iamx.ConditionMap {
+	return trustStatements([]string{id}, r.trust, time.Time{})[0].Condition
+}
+
+// principalConds returns the conditions of all Allow statements in AssumeRole
+// policy p, keyed by normalized principal.
+func principalConds(p *iamx.Policy) map[string][]iamx.ConditionMap {
+	m := make(map[string][]iamx.ConditionMap)
+	for _, s := range p.Statement {
+		if s.Effect == iamx.Allow {
+			for _, id := range normPrincipals(stmtPrincipals(s)) {
+				m[id] = append(m[id], s.Condition)
+			}
+		}
+	}
+	return m
+}
+
+// hasConditions returns true if one of conds, ignoring expiration, equals want.
+func hasConditions(conds []iamx.ConditionMap, want iamx.ConditionMap) bool {
+	for _, c := range conds {
+		if conditionsEqual(withoutExpiry(c), want) {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutExpiry returns a copy of c without the expiration condition.
+func withoutExpiry(c iamx.ConditionMap) iamx.ConditionMap {
+	if _, ok := c[expiryCondType][expiryCondKey]; !ok {
+		return c
+	}
+	cpy := make(iamx.ConditionMap, len(c))
+	for typ, m := range c {
+		if typ == expiryCondType {
+			m2 := make(iamx.Conditions, len(m))
+			for k, v := range m {
+				if k != expiryCondKey {
+					m2[k] = v
+				}
+			}
+			if len(m2) == 0 {
+				continue
+			}
+			m = m2
+		}
+		cpy[typ] = m
+	}
+	return cpy
+}
+
+// condsExpiry returns the latest expiration time of conds or zero time if any
+// of them do not expire.
+func condsExpiry(conds []iamx.ConditionMap) time.Time {
+	var exp time.Time
+	for _, c := range conds {
+		t := stmtExpiry(&iamx.Statement{Condition: c})
+		if t.IsZero() {
+			return t
+		} else if t.After(exp) {
+			exp = t
+		}
+	}
+	return exp
+}
+
+// condString returns a compact representation of conditions c.
+func condString(c iamx.ConditionMap) string {
+	var all []string
+	for typ, m := range c {
+		for k, v := range m {
+			all = append(all, typ+" "+k+"="+strings.Join(v, "|"))
+		}
+	}
+	sort.Strings(all)
+	return "{" + strings.Join(all, "; ") + "}"
+}
+
+// mapKeys returns the keys of m.
+func mapKeys(m map[string][]iamx.ConditionMap) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// attachedPolicyARNs returns the ARNs of all managed policies attached to the
+// specified role.
+func attachedPolicyARNs(c iamx.Client, role *string) ([]arn.ARN, error) {
+	in := iam.ListAttachedRolePoliciesInput{RoleName: role}
+	r := c.ListAttachedRolePoliciesRequest(&in)
+	p := r.Paginate()
+	var arns []arn.ARN
+	for p.Next() {
+		for _, pol := range p.CurrentPage().AttachedPolicies {
+			arns = append(arns, arn.Value(pol.PolicyArn))
+		}
+	}
+	return arns, p.Err()
+}
+
+// normPrincipals converts account root ARNs to account IDs so that both forms
+// compare equal.
+func normPrincipals(ids []string) []string {
+	norm := make([]string, len(ids))
+	for i, id := range ids {
+		if r := arn.ARN(id); r.Valid() && r.Resource() == "root" &&
+			account.IsID(r.Account()) {
+			id = r.Account()
+		}
+		norm[i] = id
+	}
+	return norm
+}
+
+// arnStrings converts ARNs to strings.
+func arnStrings(arns []arn.ARN) []string {
+	s := make([]string, len(arns))
+	for i, r := range arns {
+		s[i] = string(r)
+	}
+	return s
+}
+
+// setDiff returns sorted values that are only in a (add) and only in b (rm).
+// Duplicates are ignored.
+func setDiff(a, b []string) (add, rm []string) {
+	in := func(s []string) map[string]bool {
+		m := make(map[string]bool, len(s))
+		for _, v := range s {
+			m[v] = true
+		}
+		return m
+	}
+	ma, mb := in(a), in(b)
+	for v := range ma {
+		if !mb[v] {
+			add = append(add, v)
+		}
+	}
+	for v := range mb {
+		if !ma[v] {
+			rm = append(rm, v)
+		}
+	}
+	sort.Strings(add)
+	sort.Strings(rm)
+	return
+}
+
+// indexOf returns the index of ac in acs or -1 if it is not found.
+func indexOf(acs op.Accounts, ac *op.Account) int {
+	for i := range acs {
+		if acs[i] == ac {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/mxk/go-cloud/aws/iamx"
+	"github.com/mxk/go-fast"
+	"github.com/mxk/oktapus/mock"
+	"github.com/mxk/oktapus/op"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanApply(t *testing.T) {
+	ctx, w := mockOrg(mock.Ctx, "test1", "test2")
+	setCtl(w, op.Ctl{Tags: op.Tags{"old"}}, "1", "2")
+
+	// Existing role with an extra principal and policy
+	authz := authzCli.New().(*authzCmd)
+	authz.Spec = "test1"
+	authz.Role = "dev"
+	authz.Principals = []string{"user/alice", "user/eve"}
+	_, err := authz.Run(ctx)
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "oktapus")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "access.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte(`
+accounts:
+- spec: test1,test2
+  desc: sandbox
+  tags: team,!old
+  roles:
+  - name: dev
+    principals: [user/alice, user/bob]
+    policies: [ReadOnlyAccess]
+`), 0600))
+
+	cmd := planCli.New().(*planCmd)
+	cmd.File = file
+	out, err := cmd.Run(ctx)
+	require.NoError(t, err)
+	want := []*planOutput{{
+		Account: "000000000001",
+		Name:    "test1",
+		Object:  "ctl",
+		Result:  "WOULD UPDATE",
+		Changes: `desc="sandbox", +team, -old`,
+	}, {
+		Account: "000000000001",
+		Name:    "test1",
+		Object:  "arn:aws:iam::000000000001:role/oktapus/dev",
+		Result:  "WOULD UPDATE",
+		Changes: "+arn:aws:iam::000000000000:user/bob, " +
+			"-arn:aws:iam::000000000000:user/eve, " +
+			"+arn:aws:iam::aws:policy/ReadOnlyAccess, " +
+			"-arn:aws:iam::aws:policy/AdministratorAccess",
+	}, {
+		Account: "000000000002",
+		Name:    "test2",
+		Object:  "ctl",
+		Result:  "WOULD UPDATE",
+		Changes: `desc="sandbox", +team, -old`,
+	}, {
+		Account: "000000000002",
+		Name:    "test2",
+		Object:  "arn:aws:iam::000000000002:role/oktapus/dev",
+		Result:  "WOULD CREATE",
+		Changes: "+arn:aws:iam::000000000000:user/alice, " +
+			"+arn:aws:iam::000000000000:user/bob, " +
+			"+arn:aws:iam::aws:policy/ReadOnlyAccess",
+	}}
+	require.Equal(t, want, out)
+	assert.Equal(t, "", ctx.Accounts()[0].Ctl.Desc)
+
+	cmd = applyCli.New().(*planCmd)
+	cmd.File = file
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	want[0].Result, want[1].Result = "UPDATED", "UPDATED"
+	want[2].Result, want[3].Result = "UPDATED", "CREATED"
+	require.Equal(t, want, out)
+
+	for _, id := range []string{"1", "2"} {
+		role := w.Account(id).RoleRouter()["dev"]
+		pol, err := iamx.ParsePolicy(role.AssumeRolePolicyDocument)
+		require.NoError(t, err)
+		require.Len(t, pol.Statement, 1)
+		assert.Equal(t, iamx.PolicyMultiVal{
+			"arn:aws:iam::000000000000:user/alice",
+			"arn:aws:iam::000000000000:user/bob",
+		}, pol.Statement[0].Principal.AWS)
+		assert.Equal(t, map[arn.ARN]string{
+			"arn:aws:iam::aws:policy/ReadOnlyAccess": "ReadOnlyAccess",
+		}, role.AttachedPolicies)
+	}
+
+	cmd = planCli.New().(*planCmd)
+	cmd.File = file
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, out)
+}
+
+func TestPlanInvalid(t *testing.T) {
+	ctx, _ := mockOrg(mock.Ctx, "test1")
+	dir, err := ioutil.TempDir("", "oktapus")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "access.yaml")
+	for _, doc := range []string{
+		"accounts:\n- tags: x\n",
+		"accounts:\n- spec: test1\n  foo: 1\n",
+		"accounts:\n- spec: test1\n  roles:\n  - name: r\n",
+		"accounts:\n- spec: test1\n  roles:\n  - name: r\n" +
+			"    principals: [group/g]\n",
+		"accounts:\n- spec: test1\n  roles:\n  - name: r\n" +
+			"    principals: [user/a]\n    source_ip: x\n",
+		"accounts:\n- spec: test1\n  roles:\n  - name: r\n" +
+			"    principals: [Federated:accounts.google.com]\n",
+		"accounts:\n" +
+			"- spec: test1\n  roles:\n  - name: r\n    principals: [user/a]\n" +
+			"- spec: test1\n  roles:\n  - name: r\n    principals: [user/b]\n",
+	} {
+		require.NoError(t, ioutil.WriteFile(file, []byte(doc), 0600))
+		cmd := planCli.New().(*planCmd)
+		cmd.File = file
+		_, err := cmd.Run(ctx)
+		assert.Error(t, err, "%s", doc)
+	}
+}
+
+func TestPlanConditions(t *testing.T) {
+	ctx, w := mockOrg(mock.Ctx, "test1")
+	now := fast.MockTime(fast.Time())
+	defer fast.MockTime(time.Time{})
+	authz := authzCli.New().(*authzCmd)
+	authz.Spec = "test1"
+	authz.Role = "dev"
+	authz.Policy = ""
+	authz.RequireMFA = true
+	authz.Expires = time.Hour
+	authz.Principals = []string{"user/alice", "user/eve"}
+	_, err := authz.Run(ctx)
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "oktapus")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "access.yaml")
+	run := func(apply bool, doc string) []*planOutput {
+		require.NoError(t, ioutil.WriteFile(file, []byte(doc), 0600))
+		cmd := planCli.New().(*planCmd)
+		cmd.File, cmd.apply = file, apply
+		out, err := cmd.Run(ctx)
+		require.NoError(t, err)
+		return out.([]*planOutput)
+	}
+	mfa := `
+accounts:
+- spec: test1
+  roles:
+  - name: dev
+    principals: [user/alice, user/bob]
+    require_mfa: true
+`
+	out := run(false, mfa)
+	require.Len(t, out, 1)
+	assert.Equal(t, "+arn:aws:iam::000000000000:user/bob if "+
+		"{Bool aws:MultiFactorAuthPresent=true}, "+
+		"-arn:aws:iam::000000000000:user/eve", out[0].Changes)
+	run(true, mfa)
+
+	// Time-bound grant for alice is kept
+	role := w.Account("1").RoleRouter()["dev"]
+	pol, err := iamx.ParsePolicy(role.AssumeRolePolicyDocument)
+	require.NoError(t, err)
+	require.Len(t, pol.Statement, 2)
+	assert.Equal(t, iamx.PolicyMultiVal{"arn:aws:iam::000000000000:user/alice"},
+		pol.Statement[0].Principal.AWS)
+	exp := now.Add(time.Hour).UTC().Truncate(time.Second)
+	assert.Equal(t, exp, stmtExpiry(pol.Statement[0]))
+	assert.Empty(t, run(false, mfa))
+
+	// Condition changes are shown and keep the expiration time
+	noMFA := strings.Replace(mfa, "    require_mfa: true\n", "", 1)
+	out = run(false, noMFA)
+	require.Len(t, out, 1)
+	assert.Equal(t, "~arn:aws:iam::000000000000:user/alice if "+
+		"{Bool aws:MultiFactorAuthPresent=true} -> {}, "+
+		"~arn:aws:iam::000000000000:user/bob if "+
+		"{Bool aws:MultiFactorAuthPresent=true} -> {}", out[0].Changes)
+	run(true, noMFA)
+	pol, err = iamx.ParsePolicy(role.AssumeRolePolicyDocument)
+	require.NoError(t, err)
+	require.Len(t, pol.Statement, 2)
+	for _, s := range pol.Statement {
+		c := withoutExpiry(s.Condition)
+		assert.Empty(t, c)
+	}
+	assert.Equal(t, iamx.ConditionMap{expiryCondType: {expiryCondKey: {
+		exp.Format(time.RFC3339)}}}, pol.Statement[0].Condition)
+	assert.Equal(t, iamx.PolicyMultiVal{"arn:aws:iam::000000000000:user/alice"},
+		pol.Statement[0].Principal.AWS)
+	assert.Empty(t, run(false, noMFA))
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"github.com/mxk/go-cli"
+	"github.com/mxk/oktapus/op"
+)
+
+var rotateKeyCli = cli.Main.Add(&cli.Info{
+	Name:    "rotate-key",
+	Usage:   "[options]",
+	Summary: "Replace gateway IAM user access key",
+	New:     func() cli.Cmd { return &rotateKeyCmd{} },
+})
+
+type rotateKeyCmd struct{ OutFmt }
+
+func (*rotateKeyCmd) Info() *cli.Info { return rotateKeyCli }
+
+func (*rotateKeyCmd) Help(w *cli.Writer) {
+	w.Text(`
+	Replace gateway IAM user access key.
+
+	This command is only available when the gateway credentials are a long-term
+	IAM user access key loaded from a shared credentials file. A new key is
+	created and verified with sts:GetCallerIdentity, and the profile section
+	that contained the old key is updated in place. The old key is then
+	deactivated and deleted, and the daemon context associated with it is
+	discarded.
+
+	The user may have only one access key when this command is executed, since
+	AWS limits each user to two keys. Set ` + op.KeyMaxAgeEnv + ` (e.g. 2160h)
+	to have 'ls' and 'status' warn when the key is older than this duration.
+	`)
+}
+
+func (cmd *rotateKeyCmd) Main(args []string) error {
+	return op.RunAndPrint(cmd)
+}
+
+func (cmd *rotateKeyCmd) Run(ctx *op.Ctx) (interface{}, error) {
+	r, err := ctx.RotateKey()
+	if r == nil {
+		return nil, err
+	}
+	return []*op.KeyRotation{r}, err
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"reflect"
+
+	"github.com/mxk/go-cli"
+	"github.com/mxk/oktapus/op"
+)
+
+var statusCli = cli.Main.Add(&cli.Info{
+	Name:    "status",
+	Usage:   "[options]",
+	Summary: "Show current context state",
+	New:     func() cli.Cmd { return &statusCmd{} },
+})
+
+type statusCmd struct{ OutFmt }
+
+func (*statusCmd) Info() *cli.Info { return statusCli }
+
+func (*statusCmd) Help(w *cli.Writer) {
+	w.Text(`
+	Show current context state.
+
+	This command describes the gateway identity, organization, and master role
+	that oktapus is using, and whether this information was restored from the
+	daemon or obtained by a new login. Account counts reflect cached state
+	only. Use 'ls' or 'ls -refresh' to update them.
+
+	In aggregate mode, the status of each gateway is shown separately.
+	`)
+}
+
+func (cmd *statusCmd) Main(args []string) error {
+	return op.RunAndPrint(cmd)
+}
+
+func (cmd *statusCmd) Run(ctx *op.Ctx) (interface{}, error) {
+	warnKeyAge(ctx)
+	all := ctx.Status()
+	out := make([]*statusOutput, len(all))
+	for i, s := range all {
+		state := "login"
+		if s.FromDaemon {
+			state = "daemon"
+		}
+		out[i] = &statusOutput{
+			Gateway:          s.Gateway,
+			AuthMode:         s.AuthMode.String(),
+			Identity:         s.Identity,
+			Account:          s.Account,
+			SessName:         s.SessName,
+			CommonRole:       s.CommonRole,
+			OrgID:            s.OrgID,
+			OrgMaster:        s.OrgMaster,
+			MasterRole:       s.MasterRole,
+			MasterExternalID: s.MasterExternalID,
+			IdPSession:       expTime{s.IdPSessionExpires},
+			State:            state,
+			Accounts:         s.Accounts,
+			ValidCreds:       s.ValidCreds,
+			ValidCtl:         s.ValidCtl,
+			Errors:           s.Errors,
+		}
+	}
+	return out, nil
+}
+
+func (cmd *statusCmd) Print(v interface{}) error {
+	if cmd.JSON {
+		return cmd.OutFmt.Print(v)
+	}
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	for i, s := range v.([]*statusOutput) {
+		if i > 0 {
+			w.WriteByte('\n')
+		}
+		s.print(w)
+	}
+	return nil
+}
+
+type statusOutput struct {
+	Gateway          string `json:",omitempty"`
+	AuthMode         string
+	Identity         string
+	Account          string
+	SessName         string
+	CommonRole       string
+	OrgID            string
+	OrgMaster        string
+	MasterRole       string
+	MasterExternalID string
+	IdPSession       expTime
+	State            string
+	Accounts         int
+	ValidCreds       int
+	ValidCtl         int
+	Errors           int
+}
+
+// print writes non-empty fields of s as aligned "name: value" lines.
+func (s *statusOutput) print(w *bufio.Writer) {
+	v := reflect.ValueOf(s).Elem()
+	t := v.Type()
+	width := 0
+	for i := 0; i < t.NumField(); i++ {
+		if n := len(t.Field(i).Name); n > width {
+			width = n
+		}
+	}
+	for i := 0; i < t.NumField(); i++ {
+		val := fmt.Sprint(v.Field(i).Interface())
+		if val == "" {
+			continue
+		}
+		fmt.Fprintf(w, "%-*s %s\n", width+1, t.Field(i).Name+":", val)
+	}
+}
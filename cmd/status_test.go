@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/mxk/oktapus/mock"
+	"github.com/mxk/oktapus/op"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatus(t *testing.T) {
+	ctx, w := mockOrg(mock.Ctx, "test1")
+	setCtl(w, op.Ctl{}, "1")
+	_, err := ctx.Match("all")
+	require.NoError(t, err)
+
+	cmd := statusCmd{}
+	out, err := cmd.Run(ctx)
+	require.NoError(t, err)
+	want := []*statusOutput{{
+		AuthMode:   "IAM",
+		Identity:   "arn:aws:iam::000000000000:user/alice",
+		Account:    "000000000000",
+		SessName:   "alice",
+		CommonRole: "arn:aws:iam:::role/oktapus/alice",
+		OrgID:      "o-master",
+		OrgMaster:  "000000000000",
+		State:      "login",
+		Accounts:   2,
+		ValidCreds: 2,
+		ValidCtl:   1,
+		Errors:     1,
+	}}
+	assert.Equal(t, want, out)
+
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	want[0].print(bw)
+	bw.Flush()
+	assert.Equal(t, ""+
+		"AuthMode:         IAM\n"+
+		"Identity:         arn:aws:iam::000000000000:user/alice\n"+
+		"Account:          000000000000\n"+
+		"SessName:         alice\n"+
+		"CommonRole:       arn:aws:iam:::role/oktapus/alice\n"+
+		"OrgID:            o-master\n"+
+		"OrgMaster:        000000000000\n"+
+		"State:            login\n"+
+		"Accounts:         2\n"+
+		"ValidCreds:       2\n"+
+		"ValidCtl:         1\n"+
+		"Errors:           1\n", buf.String())
+}
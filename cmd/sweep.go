@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/mxk/go-cli"
+	"github.com/mxk/go-cloud/aws/iamx"
+	"github.com/mxk/go-fast"
+	"github.com/mxk/oktapus/op"
+)
+
+var sweepCli = cli.Main.Add(&cli.Info{
+	Name:    "sweep",
+	Usage:   "[options] [account-spec]",
+	Summary: "Remove expired role-based account access",
+	MaxArgs: 1,
+	New:     func() cli.Cmd { return &sweepCmd{} },
+})
+
+type sweepCmd struct {
+	OutFmt
+	DryRun bool `flag:"dry-run,Show expired grants without removing them"`
+	Spec   string
+}
+
+func (*sweepCmd) Info() *cli.Info { return sweepCli }
+
+func (*sweepCmd) Help(w *cli.Writer) {
+	w.Text(`
+	Remove expired role-based account access.
+
+	This command removes expired time-bound grants, which are created by
+	'authz -expires', from the AssumeRole policies of oktapus roles in each
+	matching account. Roles without any remaining principals are deleted, along
+	with all of their policies. Only modified roles are listed.
+
+	AWS stops honoring expired grants on its own, so sweeping is only needed to
+	keep policies and reports tidy. It is safe to run this command periodically
+	(e.g. from cron).
+	`)
+	accountSpecHelp(w)
+}
+
+func (cmd *sweepCmd) Main(args []string) error {
+	cmd.Spec = get(args, 0)
+	return op.RunAndPrint(cmd)
+}
+
+func (cmd *sweepCmd) Run(ctx *op.Ctx) (interface{}, error) {
+	acs, err := ctx.Match(cmd.Spec)
+	if err != nil {
+		return nil, err
+	}
+	now := fast.Time()
+	rows := make([][]*roleOutput, len(acs))
+	acs.EnsureCreds(minDur).Map(func(i int, ac *op.Account) error {
+		var roles []iam.Role
+		err := ac.Err
+		if ac.CredsValid() {
+			roles, err = listRoles(ac.IAM, op.IAMPath)
+		}
+		if err != nil {
+			rows[i] = []*roleOutput{{
+				Account: ac.ID,
+				Name:    ac.Name,
+				Result:  "ERROR: " + explainError(err),
+			}}
+			return nil
+		}
+		out := make([]*roleOutput, len(roles))
+		fast.ForEachIO(len(roles), func(j int) error {
+			result, err := sweepRole(ac.IAM, &roles[j], now, cmd.DryRun)
+			if err != nil {
+				result = "ERROR: " + explainError(err)
+			} else if result == "" {
+				return nil
+			}
+			out[j] = &roleOutput{
+				Account: ac.ID,
+				Name:    ac.Name,
+				Role:    aws.StringValue(roles[j].Arn),
+				Result:  result,
+			}
+			return nil
+		})
+		for _, r := range out {
+			if r != nil {
+				rows[i] = append(rows[i], r)
+			}
+		}
+		return nil
+	})
+	var out []*roleOutput
+	for _, r := range rows {
+		out = append(out, r...)
+	}
+	return out, nil
+}
+
+// sweepRole removes AssumeRole policy statements that expired before now. The
+// role is deleted if no statements remain. It returns an empty result if the
+// role was not modified.
+func sweepRole(c iamx.Client, role *iam.Role, now time.Time, dryRun bool) (string, error) {
+	pol, err := iamx.ParsePolicy(role.AssumeRolePolicyDocument)
+	if err != nil {
+		return "", err
+	}
+	stmts := pol.Statement[:0]
+	for _, s := range pol.Statement {
+		if exp := stmtExpiry(s); exp.IsZero() || now.Before(exp) {
+			stmts = append(stmts, s)
+		}
+	}
+	if len(stmts) == len(pol.Statement) {
+		return "", nil
+	}
+	pol.Statement = stmts
+	del := len(stmts) == 0
+	if dryRun {
+		if del {
+			return "WOULD DELETE", nil
+		}
+		return "WOULD UPDATE", nil
+	}
+	if del {
+		return "DELETED", c.DeleteRole(aws.StringValue(role.RoleName))
+	}
+	in := iam.UpdateAssumeRolePolicyInput{
+		PolicyDocument: pol.Doc(),
+		RoleName:       role.RoleName,
+	}
+	_, err = c.UpdateAssumeRolePolicyRequest(&in).Send()
+	return "UPDATED", err
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mxk/go-cloud/aws/iamx"
+	"github.com/mxk/go-fast"
+	"github.com/mxk/oktapus/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSweep(t *testing.T) {
+	now := fast.MockTime(fast.Time())
+	defer fast.MockTime(time.Time{})
+	ctx, w := mockOrg(mock.Ctx, "test1")
+
+	authz := authzCli.New().(*authzCmd)
+	authz.Spec = "test1"
+	authz.Role = "shared"
+	authz.Principals = []string{"user/user1"}
+	_, err := authz.Run(ctx)
+	require.NoError(t, err)
+	authz.Principals = []string{"user/user2"}
+	authz.Expires = time.Hour
+	_, err = authz.Run(ctx)
+	require.NoError(t, err)
+	authz.Role = "oncall"
+	authz.Principals = []string{"user/user3"}
+	_, err = authz.Run(ctx)
+	require.NoError(t, err)
+
+	// Extend user3 access
+	fast.MockTime(now.Add(30 * time.Minute))
+	authz.Expires = 2 * time.Hour
+	_, err = authz.Run(ctx)
+	require.NoError(t, err)
+	role := w.Account("1").RoleRouter()["oncall"]
+	pol, err := iamx.ParsePolicy(role.AssumeRolePolicyDocument)
+	require.NoError(t, err)
+	require.Len(t, pol.Statement, 1)
+	assert.Equal(t, now.Add(150*time.Minute).UTC().Truncate(time.Second),
+		stmtExpiry(pol.Statement[0]))
+
+	access := accessCli.New().(*accessCmd)
+	access.Spec = "test1"
+	out, err := access.Run(ctx)
+	require.NoError(t, err)
+	var exp []time.Time
+	for _, r := range out.(*accessReport).Grants {
+		exp = append(exp, r.Expires.Time)
+	}
+	assert.Equal(t, []time.Time{{}, now.Add(time.Hour).UTC().Truncate(time.Second),
+		now.Add(150 * time.Minute).UTC().Truncate(time.Second)}, exp)
+
+	fast.MockTime(now.Add(2 * time.Hour))
+	cmd := sweepCli.New().(*sweepCmd)
+	cmd.Spec = "test1"
+	cmd.DryRun = true
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	want := []*roleOutput{{
+		Account: "000000000001",
+		Name:    "test1",
+		Role:    "arn:aws:iam::000000000001:role/oktapus/shared",
+		Result:  "WOULD UPDATE",
+	}}
+	assert.Equal(t, want, out)
+
+	cmd.DryRun = false
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	want[0].Result = "UPDATED"
+	assert.Equal(t, want, out)
+	role = w.Account("1").RoleRouter()["shared"]
+	pol, err = iamx.ParsePolicy(role.AssumeRolePolicyDocument)
+	require.NoError(t, err)
+	require.Len(t, pol.Statement, 1)
+	assert.Equal(t, iamx.PolicyMultiVal{"arn:aws:iam::000000000000:user/user1"},
+		pol.Statement[0].Principal.AWS)
+
+	fast.MockTime(now.Add(3 * time.Hour))
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	want[0].Role = "arn:aws:iam::000000000001:role/oktapus/oncall"
+	want[0].Result = "DELETED"
+	assert.Equal(t, want, out)
+	assert.Nil(t, w.Account("1").RoleRouter()["oncall"])
+}
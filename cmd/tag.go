@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"strings"
+
 	"github.com/mxk/go-cli"
 	"github.com/mxk/oktapus/op"
 )
@@ -16,11 +18,13 @@ var tagCli = cli.Main.Add(&cli.Info{
 
 type tagCmd struct {
 	OutFmt
-	Desc *string `flag:"Set account description"`
-	Init bool    `flag:"Initialize account control"`
-	Spec string
-	Set  op.Tags
-	Clr  op.Tags
+	Admins *string `flag:"Set comma-separated account admin <names> (empty to clear)"`
+	Desc   *string `flag:"Set account description"`
+	Init   bool    `flag:"Initialize account control"`
+	Maint  *string `flag:"Put account into maintenance for <reason> (empty to end)"`
+	Spec   string
+	Set    op.Tags
+	Clr    op.Tags
 }
 
 func (*tagCmd) Info() *cli.Info { return tagCli }
@@ -29,14 +33,27 @@ func (*tagCmd) Help(w *cli.Writer) {
 	w.Text(`
 	Set account tags and/or description.
 
-	The account owner, description, and tags are stored within each account in
-	the OktapusAccountControl IAM role description. Accounts that do not have
-	this role are not managed by oktapus. Use -init to create this role and set
-	the initial description and tags.
+	The account owner, team, admins, description, tags, and maintenance reason
+	are stored within each account in the OktapusAccountControl IAM role
+	description. Accounts that do not have this role are not managed by oktapus.
+	Use -init to create this role and set the initial description and tags.
 
 	To set or clear tags, specify them as a comma-separated list after the
 	account spec. Use '!' prefix to clear a tag. Escape '!' with a backslash or
 	use single quotes around the entire argument to inhibit shell expansion.
+
+	Use -maint to put broken accounts into maintenance. Accounts in maintenance
+	cannot be allocated until maintenance is ended with -maint ''.
+
+	Use -admins to set who may allocate the account for someone else ('alloc
+	-owner') or free and transfer it without being the owner ('free -force' and
+	'chown -force'). Accounts without an admins list are administered by the
+	organization admins listed in the 'admins' config file setting, so only they
+	can create the list. If there are no organization admins, everyone is an
+	admin of accounts without a list. Once set, the list can only be changed by one of the
+	account admins. Admin and team checks are performed by oktapus, not by AWS,
+	so they do not stop users who can modify the OktapusAccountControl role
+	directly.
 	`)
 	accountSpecHelp(w)
 }
@@ -50,8 +67,10 @@ func (cmd *tagCmd) Main(args []string) error {
 	if err != nil {
 		return err
 	}
-	if cmd.Desc == nil && len(set)+len(clr) == 0 {
-		return cli.Error("either description or tags must be specified")
+	if cmd.Admins == nil && cmd.Desc == nil && cmd.Maint == nil &&
+		len(set)+len(clr) == 0 {
+		return cli.Error("admins, description, maintenance, or tags must be " +
+			"specified")
 	}
 	cmd.Spec, cmd.Set, cmd.Clr = args[0], set, clr
 	return op.RunAndPrint(cmd)
@@ -62,10 +81,21 @@ func (cmd *tagCmd) Run(ctx *op.Ctx) (interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
+	me := ctx.Role().Name()
 	update := func(ac *op.Account) bool {
+		if cmd.Admins != nil {
+			if !ac.Ctl.IsAdmin(me, ctx.Admins) {
+				ac.Err = op.ErrNotAdmin
+				return false
+			}
+			ac.Ctl.SetAdmins(strings.Split(*cmd.Admins, ","))
+		}
 		if cmd.Desc != nil {
 			ac.Ctl.Desc = *cmd.Desc
 		}
+		if cmd.Maint != nil {
+			ac.Ctl.SetMaint(*cmd.Maint)
+		}
 		ac.Ctl.Tags.Apply(cmd.Set, cmd.Clr)
 		return true
 	}
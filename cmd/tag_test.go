@@ -52,4 +52,55 @@ func TestTag(t *testing.T) {
 		Tags:        "set",
 	}}
 	assert.Equal(t, want, out)
+	cmd = tagCmd{Maint: aws.String("broken"), Spec: "test2"}
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	want = []*listOutput{{
+		Account:     "000000000002",
+		Name:        "test2",
+		Maint:       "broken",
+		Description: "desc",
+		Tags:        "set",
+	}}
+	assert.Equal(t, want, out)
+
+	cmd = tagCmd{Maint: aws.String(""), Spec: "test2"}
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, out.([]*listOutput)[0].Maint)
+}
+
+func TestTagAdmins(t *testing.T) {
+	ctx, w := mockOrg(mock.Ctx, "test1", "test2", "test3")
+	setCtl(w, op.Ctl{}, "1", "3")
+	setCtl(w, op.Ctl{Admins: []string{"bob"}}, "2")
+
+	// Only organization admins may create the list
+	ctx.Admins = []string{"carol"}
+	cmd := tagCmd{Admins: aws.String("alice"), Spec: "test3"}
+	out, err := cmd.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, op.ErrNotAdmin.Error(), out.([]*listOutput)[0].Error)
+
+	// Without organization admins, anyone may create the list
+	ctx.Admins = nil
+	cmd = tagCmd{Admins: aws.String("bob,alice"), Spec: "test1,test2"}
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	want := []*listOutput{{
+		Account: "000000000001",
+		Name:    "test1",
+		Admins:  "alice,bob",
+	}, {
+		Account: "000000000002",
+		Name:    "test2",
+		Admins:  "bob",
+		Error:   op.ErrNotAdmin.Error(),
+	}}
+	assert.Equal(t, want, out)
+
+	cmd = tagCmd{Admins: aws.String(""), Spec: "test1"}
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, out.([]*listOutput)[0].Admins)
 }
@@ -0,0 +1,288 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/mxk/go-cli"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/mxk/go-cloud/aws/awsx"
+	"github.com/mxk/go-cloud/aws/iamx"
+	"github.com/mxk/go-fast"
+	"github.com/mxk/oktapus/account"
+	"github.com/mxk/oktapus/op"
+)
+
+var unauthzCli = cli.Main.Add(&cli.Info{
+	Name:    "unauthz",
+	Usage:   "[options] account-spec principal [principal ...]",
+	Summary: "Revoke role-based account access",
+	MinArgs: 2,
+	New:     func() cli.Cmd { return &unauthzCmd{} },
+})
+
+type unauthzCmd struct {
+	OutFmt
+	DryRun     bool   `flag:"dry-run,Show AssumeRole policy changes without applying them"`
+	Role       string `flag:"Role <name> with optional path"`
+	Tmp        bool   `flag:"Use the temporary role path"`
+	Spec       string
+	Principals []string
+
+	diffs []string
+}
+
+func (*unauthzCmd) Info() *cli.Info { return unauthzCli }
+
+func (*unauthzCmd) Help(w *cli.Writer) {
+	w.Text(`
+	Revoke role-based account access.
+
+	This command reverses the effect of 'authz' by removing principals from the
+	AssumeRole policy of IAM roles in each matching account. Role names are
+	derived from principal names unless -role is specified, in which case only
+	that role is updated. Principals are specified in the same way as for
+	'authz'.
+
+	A role is deleted, along with all of its policies, once its AssumeRole
+	policy no longer contains any principals. Roles that do not refer to any of
+	the principals are not modified.
+
+	Use -dry-run to see the AssumeRole policy changes for each role without
+	modifying anything.
+	`)
+	accountSpecHelp(w)
+}
+
+func (cmd *unauthzCmd) Main(args []string) error {
+	cmd.Spec = args[0]
+	cmd.Principals = args[1:]
+	return op.RunAndPrint(cmd)
+}
+
+func (cmd *unauthzCmd) Run(ctx *op.Ctx) (interface{}, error) {
+	err := checkPrincipals(ctx.Ident().Ctx(), cmd.Principals, cmd.Role != "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Map role names to principals
+	var roles []*roleUnauthz
+	if cmd.Role == "" {
+		roles = make([]*roleUnauthz, len(cmd.Principals))
+		dup := make(map[string]bool, len(cmd.Principals))
+		path, _, _ := splitPathName("", cmd.Tmp)
+		for i, p := range cmd.Principals {
+			name := arn.ARN(p).Name()
+			if dup[name] {
+				return nil, fmt.Errorf("duplicate role name %q", name)
+			}
+			dup[name] = true
+			roles[i] = &roleUnauthz{path, name, []string{p}}
+		}
+	} else {
+		path, name, err := splitPathName(cmd.Role, cmd.Tmp)
+		if err != nil {
+			return nil, err
+		}
+		roles = []*roleUnauthz{{path, name, cmd.Principals}}
+	}
+
+	// Execute
+	acs, err := ctx.Match(cmd.Spec)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*roleOutput, len(acs)*len(roles))
+	if len(out) == 0 {
+		return nil, nil
+	}
+	diffs := make([]string, len(out))
+	compact := false
+	acs.EnsureCreds(minDur).Map(func(i int, ac *op.Account) error {
+		i *= len(roles)
+		out, diffs := out[i:i+len(roles)], diffs[i:i+len(roles)]
+		if !ac.CredsValid() {
+			out[0] = &roleOutput{
+				Account: ac.ID,
+				Name:    ac.Name,
+				Result:  "ERROR: " + explainError(ac.Err),
+			}
+			compact = true
+			return nil
+		}
+		return fast.ForEachIO(len(roles), func(i int) error {
+			role, result, diff, err := roles[i].exec(ac.IAM, cmd.DryRun)
+			ro := &roleOutput{
+				Account: ac.ID,
+				Name:    ac.Name,
+				Result:  result,
+			}
+			if role != nil {
+				ro.Role = aws.StringValue(role.Arn)
+			}
+			if err != nil {
+				ro.Result = "ERROR: " + explainError(err)
+			} else if diff != "" {
+				diffs[i] = "--- " + ro.Role + "\n" + diff
+			}
+			out[i] = ro
+			return nil
+		})
+	})
+	for _, d := range diffs {
+		if d != "" {
+			cmd.diffs = append(cmd.diffs, d)
+		}
+	}
+	if compact {
+		i := 0
+		for _, r := range out {
+			if r != nil {
+				out[i] = r
+				i++
+			}
+		}
+		out = out[:i]
+	}
+	return out, nil
+}
+
+func (cmd *unauthzCmd) Print(v interface{}) error {
+	if err := cmd.OutFmt.Print(v); err != nil || cmd.JSON {
+		return err
+	}
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	for _, d := range cmd.diffs {
+		w.WriteByte('\n')
+		w.WriteString(d)
+	}
+	return nil
+}
+
+// roleUnauthz removes principals from an existing AssumeRole policy.
+type roleUnauthz struct {
+	path       string
+	name       string
+	principals []string
+}
+
+// exec removes principals from the role's AssumeRole policy, deleting the role
+// if no principals remain. If dryRun is true, the role is not modified. The
+// returned diff describes the AssumeRole policy change.
+func (r *roleUnauthz) exec(c iamx.Client, dryRun bool) (role *iam.Role, result, diff string, err error) {
+	in := iam.GetRoleInput{RoleName: aws.String(r.name)}
+	out, err := c.GetRoleRequest(&in).Send()
+	if err != nil {
+		if awsx.ErrCode(err) == iam.ErrCodeNoSuchEntityException {
+			err = nil
+			result = "NOT FOUND"
+		}
+		return
+	}
+	role = out.Role
+	if aws.StringValue(role.Path) != r.path {
+		err = op.Error("role path mismatch")
+		return
+	}
+	pol, err := iamx.ParsePolicy(role.AssumeRolePolicyDocument)
+	if err != nil {
+		return
+	}
+	before := policyJSON(pol)
+	if !removeAssumeRolePrincipals(pol, r.principals) {
+		result = "UNCHANGED"
+		return
+	}
+	del := len(pol.Statement) == 0
+	diff = lineDiff(before, policyJSON(pol))
+	if dryRun {
+		if result = "WOULD UPDATE"; del {
+			result = "WOULD DELETE"
+		}
+		return
+	}
+	if del {
+		err = c.DeleteRole(r.name)
+		result = "DELETED"
+	} else {
+		in := iam.UpdateAssumeRolePolicyInput{
+			PolicyDocument: pol.Doc(),
+			RoleName:       role.RoleName,
+		}
+		_, err = c.UpdateAssumeRolePolicyRequest(&in).Send()
+		result = "UPDATED"
+	}
+	return
+}
+
+// removeAssumeRolePrincipals removes principals from all statements of p.
+// Statements without any remaining principals are removed. Account ID
+// principals also match the account root ARN. Federated and service principals
+// must have the type prefix added by checkPrincipals. It returns true if p was
+// modified.
+func removeAssumeRolePrincipals(p *iamx.Policy, principals []string) bool {
+	return removePrincipals(p, principals, nil)
+}
+
+// removePrincipals is like removeAssumeRolePrincipals, but it only modifies
+// statements for which match returns true. A nil match function matches all
+// statements.
+func removePrincipals(p *iamx.Policy, principals []string, match func(*iamx.Statement) bool) bool {
+	rm := make(map[string]bool, len(principals))
+	for _, id := range principals {
+		rm[id] = true
+		if account.IsID(id) {
+			rm[string(arn.New("aws", "iam", "", id, "root"))] = true
+		}
+	}
+	changed := false
+	filter := func(ids iamx.PolicyMultiVal, prefix string) iamx.PolicyMultiVal {
+		if len(ids) == 0 {
+			return ids
+		}
+		keep := ids[:0]
+		for _, id := range ids {
+			if r := arn.ARN(id); rm[prefix+id] ||
+				(r.Valid() && rm[prefix+string(r.WithPartition("aws"))]) {
+				changed = true
+			} else {
+				keep = append(keep, id)
+			}
+		}
+		if len(keep) == 0 {
+			return nil
+		}
+		return keep
+	}
+	stmts := p.Statement[:0]
+	for _, s := range p.Statement {
+		if s.Principal != nil && !s.Principal.Any && (match == nil || match(s)) {
+			m := &s.Principal.PrincipalMap
+			had := len(m.AWS) + len(m.Federated) + len(m.Service)
+			m.AWS = filter(m.AWS, "")
+			m.Federated = filter(m.Federated, federatedPrefix)
+			m.Service = filter(m.Service, servicePrefix)
+			if had > 0 && len(m.AWS)+len(m.Federated)+len(m.Service) == 0 {
+				continue
+			}
+		}
+		stmts = append(stmts, s)
+	}
+	p.Statement = stmts
+	return changed
+}
+
+// policyJSON returns an indented representation of policy p.
+func policyJSON(p *iamx.Policy) string {
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return string(b) + "\n"
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mxk/go-cloud/aws/iamx"
+	"github.com/mxk/oktapus/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnauthz(t *testing.T) {
+	ctx, w := mockOrg(mock.Ctx, "test1", "test2")
+	authz := authzCli.New().(*authzCmd)
+	authz.Spec = "test1,test2"
+	authz.Role = "shared"
+	authz.Principals = []string{"user/user1", "user/user2"}
+	_, err := authz.Run(ctx)
+	require.NoError(t, err)
+	authz.Spec = "test1"
+	authz.Principals = []string{"123456789012"}
+	_, err = authz.Run(ctx)
+	require.NoError(t, err)
+
+	cmd := unauthzCli.New().(*unauthzCmd)
+	cmd.Spec = "test1,test2"
+	cmd.Role = "shared"
+	cmd.Principals = []string{"user/user1", "123456789012"}
+	cmd.DryRun = true
+	out, err := cmd.Run(ctx)
+	require.NoError(t, err)
+	want := []*roleOutput{{
+		Account: "000000000001",
+		Name:    "test1",
+		Role:    "arn:aws:iam::000000000001:role/oktapus/shared",
+		Result:  "WOULD UPDATE",
+	}, {
+		Account: "000000000002",
+		Name:    "test2",
+		Role:    "arn:aws:iam::000000000002:role/oktapus/shared",
+		Result:  "WOULD UPDATE",
+	}}
+	require.Equal(t, want, out)
+	require.Len(t, cmd.diffs, 2)
+	assert.Contains(t, cmd.diffs[0], "\n-           \"123456789012\"\n")
+	assert.Contains(t, cmd.diffs[0],
+		`+         "AWS": "arn:aws:iam::000000000000:user/user2"`)
+
+	cmd = unauthzCli.New().(*unauthzCmd)
+	cmd.Spec = "test1,test2"
+	cmd.Role = "shared"
+	cmd.Principals = []string{"user/user1", "123456789012"}
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	want[0].Result, want[1].Result = "UPDATED", "UPDATED"
+	require.Equal(t, want, out)
+	role := w.Account("1").RoleRouter()["shared"]
+	pol, err := iamx.ParsePolicy(role.AssumeRolePolicyDocument)
+	require.NoError(t, err)
+	require.Len(t, pol.Statement, 1)
+	assert.Equal(t, iamx.PolicyMultiVal{"arn:aws:iam::000000000000:user/user2"},
+		pol.Statement[0].Principal.AWS)
+
+	cmd.Principals = []string{"user/user2"}
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	want[0].Result, want[1].Result = "DELETED", "DELETED"
+	require.Equal(t, want, out)
+	assert.Nil(t, w.Account("1").RoleRouter()["shared"])
+
+	out, err = cmd.Run(ctx)
+	require.NoError(t, err)
+	want[0].Result, want[1].Result = "NOT FOUND", "NOT FOUND"
+	want[0].Role, want[1].Role = "", ""
+	require.Equal(t, want, out)
+}
+
+func TestLineDiff(t *testing.T) {
+	assert.Equal(t, "  a\n- b\n+ x\n  c\n+ d\n", lineDiff("a\nb\nc\n", "a\nx\nc\nd"))
+	assert.Equal(t, "", lineDiff("", ""))
+}
+
+func TestRemoveAssumeRolePrincipals(t *testing.T) {
+	p := &iamx.Policy{Statement: trustStatements([]string{
+		"arn:aws:iam::000000000000:user/user1",
+		"Service:lambda.amazonaws.com",
+		"Federated:accounts.google.com",
+	}, nil, time.Time{})}
+	assert.False(t, removeAssumeRolePrincipals(p, []string{"Service:ec2.amazonaws.com"}))
+	assert.True(t, removeAssumeRolePrincipals(p, []string{
+		"Service:lambda.amazonaws.com",
+		"Federated:accounts.google.com",
+	}))
+	require.Len(t, p.Statement, 1)
+	assert.Equal(t, iamx.PolicyMultiVal{"arn:aws:iam::000000000000:user/user1"},
+		p.Statement[0].Principal.AWS)
+}
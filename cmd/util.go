@@ -3,6 +3,7 @@ package cmd
 import (
 	"bufio"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"os"
 	"strings"
@@ -75,6 +76,18 @@ func explainError(err error) string {
 	return ""
 }
 
+// warnKeyAge writes a warning to stderr if the gateway IAM user access key
+// should be rotated.
+func warnKeyAge(ctx *op.Ctx) {
+	msg, err := ctx.KeyAgeWarning()
+	if err != nil {
+		msg = explainError(err)
+	}
+	if msg != "" {
+		fmt.Fprintln(os.Stderr, "warning:", msg)
+	}
+}
+
 // OutFmt implements the common -json flag.
 type OutFmt struct {
 	JSON bool `flag:"Write output in JSON format"`
@@ -135,3 +148,63 @@ func (t expTime) String() string {
 	}
 	return t.Sub(fast.Time()).Truncate(time.Second).String()
 }
+
+// lineDiff returns a line-based diff of strings a and b. Each line is prefixed
+// with "- " if it was removed, "+ " if it was added, or "  " if unchanged.
+func lineDiff(a, b string) string {
+	x := strings.SplitAfter(a, "\n")
+	y := strings.SplitAfter(b, "\n")
+	if x[len(x)-1] == "" {
+		x = x[:len(x)-1]
+	}
+	if y[len(y)-1] == "" {
+		y = y[:len(y)-1]
+	}
+
+	// Longest common subsequence lengths of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var buf strings.Builder
+	line := func(prefix, s string) {
+		buf.WriteString(prefix)
+		buf.WriteString(s)
+		if !strings.HasSuffix(s, "\n") {
+			buf.WriteByte('\n')
+		}
+	}
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			line("  ", x[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			line("- ", x[i])
+			i++
+		default:
+			line("+ ", y[j])
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		line("- ", x[i])
+	}
+	for ; j < len(y); j++ {
+		line("+ ", y[j])
+	}
+	return buf.String()
+}
@@ -15,7 +15,14 @@ func mockOrg(ctx arn.Ctx, accounts ...string) (*op.Ctx, *mock.AWS) {
 	c := op.NewCtx()
 	w := mock.NewAWS(ctx, mock.NewOrg(ctx, "master", accounts...))
 	for id := range w.Root().OrgRouter().Accounts {
-		*w.Account(id) = mock.ChainRouter{mock.UserRouter{}, mock.RoleRouter{}}
+		*w.Account(id) = mock.ChainRouter{
+			mock.UserRouter{},
+			mock.RoleRouter{},
+			mock.GroupRouter{},
+			mock.InstanceProfileRouter{},
+			mock.PolicyRouter{},
+			mock.SAMLProviderRouter{},
+		}
 	}
 	if err := c.Init(&w.Cfg); err != nil {
 		panic(err)
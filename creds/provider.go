@@ -2,26 +2,43 @@ package creds
 
 import (
 	"errors"
-	"reflect"
+	"fmt"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/aws/ec2rolecreds"
+	"github.com/aws/aws-sdk-go-v2/aws/endpointcreds"
+	"github.com/aws/aws-sdk-go-v2/aws/stscreds"
 	"github.com/mxk/go-fast"
 )
 
 // Source names of credentials providers.
 const (
-	ProxyProviderName  = "ProxyCredentialsProvider"
-	StaticProviderName = "StaticCredentialsProvider"
+	ProxyProviderName       = "ProxyCredentialsProvider"
+	StaticProviderName      = "StaticCredentialsProvider"
+	WebIdentityProviderName = "WebIdentityCredentialsProvider"
 )
 
 // ErrUnable is returned by Provider if the credentials do not satisfy the
-// requested validity duration after successful renewal.
+// requested validity duration after successful renewal. See LimitError.
 var ErrUnable = errors.New("creds: unable to satisfy minimum expiration time")
 
+// LimitError is returned by Provider instead of ErrUnable if the requested
+// validity duration exceeds a known limit on the session duration.
+type LimitError struct {
+	Want   time.Duration // Requested validity duration
+	Limit  time.Duration // Maximum session duration
+	Reason string        // Limit description
+}
+
+// Error implements the error interface.
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("creds: requested validity (%v) exceeds %s (%v)",
+		e.Want, e.Reason, e.Limit)
+}
+
 // RenewFunc renews client credentials. CanExpire and Expires fields control
 // error caching if an error is returned. If CanExpire is false, Provider
 // automatically caches the error for a limited amount of time.
@@ -43,6 +60,7 @@ func ValidFor(cr *aws.Credentials, d time.Duration) bool {
 // be copied.
 type Provider struct {
 	cr    atomic.Value
+	lim   atomic.Value
 	mu    sync.Mutex
 	renew RenewFunc
 }
@@ -67,7 +85,9 @@ func RenewableProvider(fn RenewFunc) *Provider {
 // WrapProvider converts an existing aws.CredentialsProvider to a Provider
 // instance. If cp is a SafeCredentialsProvider, it must not be used by other
 // goroutines during this call, and its RetrieveFn will no longer be protected
-// by a single mutex if the old and new providers are used concurrently.
+// by a single mutex if the old and new providers are used concurrently. Unknown
+// provider types, such as those for SSO or credential_process, are renewed by
+// calling their Retrieve method.
 func WrapProvider(cp aws.CredentialsProvider) *Provider {
 	switch cp := cp.(type) {
 	case *Provider:
@@ -89,11 +109,18 @@ func WrapProvider(cp aws.CredentialsProvider) *Provider {
 			p.Store(cr, err)
 		}
 		return p
+	case *aws.ChainProvider:
+		return WrapProvider(&cp.SafeCredentialsProvider)
 	case *ec2rolecreds.Provider:
 		return WrapProvider(&cp.SafeCredentialsProvider)
+	case *endpointcreds.Provider:
+		return WrapProvider(&cp.SafeCredentialsProvider)
+	case *stscreds.AssumeRoleProvider:
+		return WrapProvider(&cp.SafeCredentialsProvider)
+	case nil:
+		return StaticProvider(aws.Credentials{}, errors.New("creds: no provider"))
 	}
-	// TODO: Handle ChainProvider?
-	panic("creds: unsupported provider type " + reflect.TypeOf(cp).String())
+	return RenewableProvider(cp.Retrieve)
 }
 
 // Retrieve implements aws.CredentialsProvider.
@@ -119,6 +146,13 @@ func (p *Provider) Store(cr aws.Credentials, err error) {
 	p.cr.Store(&creds{cr, err})
 }
 
+// SetLimit sets the maximum session duration of renewed credentials and the
+// reason for it. Ensure returns a LimitError instead of ErrUnable if the
+// requested duration is not less than d. This is normally called by RenewFunc.
+func (p *Provider) SetLimit(d time.Duration, reason string) {
+	p.lim.Store(&LimitError{Limit: d, Reason: reason})
+}
+
 // Ensure ensures that credentials will remain valid for the specified duration,
 // renewing them if necessary. A negative duration forces unconditional renewal.
 // ErrUnable is returned if the validity period cannot be satisfied.
@@ -158,6 +192,9 @@ func (p *Provider) ensure(d time.Duration) (aws.Credentials, error) {
 	if cr.keepCurrent(d) {
 		return cr.Credentials, cr.err
 	}
+	if lim, _ := p.lim.Load().(*LimitError); lim != nil && d >= lim.Limit {
+		return cr.Credentials, &LimitError{d, lim.Limit, lim.Reason}
+	}
 	return cr.Credentials, ErrUnable
 }
 
@@ -105,6 +105,18 @@ func TestWrap(t *testing.T) {
 	ec2cr := ec2rolecreds.NewProvider(nil)
 	assert.NotPanics(t, func() { WrapProvider(ec2cr) })
 
+	chain := aws.NewChainProvider([]aws.CredentialsProvider{
+		aws.AnonymousCredentials, static,
+	})
+	cr, err = WrapProvider(chain).Retrieve()
+	assert.NoError(t, err)
+	assert.Equal(t, static.Value, cr)
+
+	custom := customProvider(static.Value)
+	cr, err = WrapProvider(custom).Retrieve()
+	assert.NoError(t, err)
+	assert.Equal(t, static.Value, cr)
+
 	cached, _ := safe.Retrieve()
 	safe.RetrieveFn = func() (aws.Credentials, error) { panic("fail") }
 	cr, err = WrapProvider(&safe).Retrieve()
@@ -182,8 +194,14 @@ func TestTemporary(t *testing.T) {
 	assert.Equal(t, ErrUnable, p.Ensure(time.Hour))
 	assert.Equal(t, 3, calls)
 
+	// Known limit
+	p.SetLimit(time.Hour, "test limit")
+	assert.EqualError(t, p.Ensure(2*time.Hour),
+		"creds: requested validity (2h0m0s) exceeds test limit (1h0m0s)")
+	assert.Equal(t, 4, calls)
+
 	assert.NoError(t, p.Ensure(30*time.Minute))
-	assert.Equal(t, 3, calls)
+	assert.Equal(t, 4, calls)
 
 	cr, err = p.Creds()
 	assert.NoError(t, err)
@@ -231,3 +249,9 @@ func TestError(t *testing.T) {
 	cr, _ = p.Creds()
 	assert.Equal(t, aws.Credentials{}, cr)
 }
+
+type customProvider aws.Credentials
+
+func (p customProvider) Retrieve() (aws.Credentials, error) {
+	return aws.Credentials(p), nil
+}
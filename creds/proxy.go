@@ -1,15 +1,37 @@
 package creds
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
 	"path"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/mxk/go-cloud/aws/arn"
 )
 
+// RoleChainLimit is the maximum session duration of a role that is assumed with
+// temporary credentials of another role.
+const RoleChainLimit = time.Hour
+
+// defaultSessionDuration is the STS default role session duration.
+const defaultSessionDuration = time.Hour
+
+// IsDurationError returns true if err indicates that the requested session
+// duration exceeds the maximum allowed for the role.
+func IsDurationError(err error) bool {
+	e, ok := err.(awserr.Error)
+	return ok && e.Code() == "ValidationError" &&
+		strings.Contains(e.Message(), "DurationSeconds exceeds")
+}
+
 // FromSTS converts STS credentials to client credentials.
 func FromSTS(src *sts.Credentials) aws.Credentials {
 	if src == nil {
@@ -69,11 +91,39 @@ func (Client) GobEncode() ([]byte, error) { return nil, nil }
 // GobDecode prevents the client from being decoded by gob.
 func (Client) GobDecode([]byte) error { return nil }
 
+// WebIdentityProvider returns a new Provider that calls AssumeRoleWithWebIdentity
+// using the OIDC token in tokenFile. The file is read each time the credentials
+// are renewed because CI systems may replace the token before it expires. The
+// client does not need any credentials of its own.
+func (c Client) WebIdentityProvider(role arn.ARN, sessName, tokenFile string) *Provider {
+	return RenewableProvider(func() (cr aws.Credentials, err error) {
+		tok, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			return
+		}
+		in := &sts.AssumeRoleWithWebIdentityInput{
+			RoleArn:          arn.String(role),
+			RoleSessionName:  aws.String(sessName),
+			WebIdentityToken: aws.String(string(bytes.TrimSpace(tok))),
+		}
+		out, err := c.AssumeRoleWithWebIdentityRequest(in).Send()
+		if err == nil {
+			cr = FromSTS(out.Credentials)
+		}
+		cr.Source = WebIdentityProviderName
+		return
+	})
+}
+
 // Proxy provides IAM role credentials via sts:AssumeRole API.
 type Proxy struct {
 	Client   Client
 	Ident    Ident
 	SessName string
+
+	// Optional SourceIdentity and session tags for all AssumeRole calls
+	SourceIdentity string
+	Tags           map[string]string
 }
 
 // Init initializes client identity information and role session name.
@@ -109,11 +159,98 @@ func (p *Proxy) AssumeRole(role arn.ARN, d time.Duration) *Provider {
 	return p.Provider(in)
 }
 
+// Session contains AssumeRole parameters that may change each time the
+// credentials are renewed.
+type Session struct {
+	Duration time.Duration     // Zero means default duration
+	Tags     map[string]string // Tags in addition to Proxy tags
+}
+
+// SessionProvider returns a new Provider that calls AssumeRole with the
+// specified input and session parameters returned by fn on each renewal. The
+// duration is reduced to RoleChainLimit if the proxy identity is itself a role,
+// and to the role's MaxSessionDuration if STS rejects the request. The provider
+// reports which limit applies via LimitError.
+func (p *Proxy) SessionProvider(in *sts.AssumeRoleInput, fn func() Session) *Provider {
+	var cp *Provider
+	var roleMax time.Duration
+	var roleWhy string
+	cp = RenewableProvider(func() (cr aws.Credentials, err error) {
+		sess := fn()
+		d, why := sess.Duration, "session duration setting"
+		if d <= 0 {
+			d, why = defaultSessionDuration, "default session duration"
+		}
+		if d > RoleChainLimit && p.Ident.Type() == "assumed-role" {
+			d, why = RoleChainLimit, "role chaining limit"
+		}
+		if roleMax > 0 && d > roleMax {
+			d, why = roleMax, roleWhy
+		}
+		req := *in
+		if d != defaultSessionDuration {
+			req.DurationSeconds = aws.Int64(int64(d / time.Second))
+		}
+		out, err := p.assumeRole(&req, sess.Tags)
+		if err != nil && req.DurationSeconds != nil && IsDurationError(err) {
+			// Use default duration to find out the actual limit
+			req.DurationSeconds = nil
+			if out, err = p.assumeRole(&req, sess.Tags); err == nil {
+				roleMax, roleWhy = p.maxSessionDuration(out.Credentials, req.RoleArn)
+				d, why = roleMax, roleWhy
+				if d != defaultSessionDuration {
+					req.DurationSeconds = aws.Int64(int64(d / time.Second))
+					if o, err := p.assumeRole(&req, sess.Tags); err == nil {
+						out = o
+					} else {
+						// Keep the credentials with the default duration
+						d, why = defaultSessionDuration, "default session duration"
+					}
+				}
+			}
+		}
+		if err == nil {
+			cr = FromSTS(out.Credentials)
+			cp.SetLimit(d, why)
+		}
+		cr.Source = ProxyProviderName
+		return
+	})
+	return cp
+}
+
+// maxSessionDuration returns the MaxSessionDuration of the specified role
+// using the role's own credentials and a description of the limit. The default
+// duration is returned if the role cannot be described.
+func (p *Proxy) maxSessionDuration(src *sts.Credentials, role *string) (time.Duration, string) {
+	if d, err := RoleMaxSessionDuration(&p.Client.Config, src, arn.Value(role)); err == nil {
+		return d, "role MaxSessionDuration"
+	}
+	return defaultSessionDuration, "default session duration (iam:GetRole failed)"
+}
+
+// RoleMaxSessionDuration returns the MaxSessionDuration of the specified role
+// by calling iam:GetRole with the role's own credentials src, which were
+// obtained with the default session duration.
+func RoleMaxSessionDuration(cfg *aws.Config, src *sts.Credentials, role arn.ARN) (time.Duration, error) {
+	c := cfg.Copy()
+	c.Credentials = StaticProvider(FromSTS(src), nil)
+	in := &iam.GetRoleInput{RoleName: aws.String(role.Name())}
+	out, err := iam.New(c).GetRoleRequest(in).Send()
+	if err != nil {
+		return 0, err
+	}
+	if out.Role.MaxSessionDuration == nil {
+		return defaultSessionDuration, nil
+	}
+	return time.Duration(*out.Role.MaxSessionDuration) * time.Second, nil
+}
+
 // Provider returns a new Provider that calls AssumeRole with the specified
 // input.
 func (p *Proxy) Provider(in *sts.AssumeRoleInput) *Provider {
 	return RenewableProvider(func() (cr aws.Credentials, err error) {
-		out, err := p.Client.AssumeRoleRequest(in).Send()
+		out, err := p.assumeRole(in, nil)
 		if err == nil {
 			cr = FromSTS(out.Credentials)
 		}
@@ -121,3 +258,58 @@ func (p *Proxy) Provider(in *sts.AssumeRoleInput) *Provider {
 		return
 	})
 }
+
+// assumeRole calls AssumeRole with proxy SourceIdentity and session tags. Extra
+// tags override proxy tags with the same key.
+func (p *Proxy) assumeRole(in *sts.AssumeRoleInput, extra map[string]string) (*sts.AssumeRoleOutput, error) {
+	req := p.Client.AssumeRoleRequest(in)
+	tags := p.Tags
+	if len(extra) > 0 {
+		tags = make(map[string]string, len(p.Tags)+len(extra))
+		for k, v := range p.Tags {
+			tags[k] = v
+		}
+		for k, v := range extra {
+			tags[k] = v
+		}
+	}
+	if p.SourceIdentity != "" || len(tags) > 0 {
+		src := p.SourceIdentity
+		req.Handlers.Build.PushBack(func(r *aws.Request) {
+			addSessionAttrs(r, src, tags)
+		})
+	}
+	return req.Send()
+}
+
+// addSessionAttrs adds SourceIdentity and session tags to an encoded
+// AssumeRole request. The SDK version in use does not support these
+// parameters.
+func addSessionAttrs(r *aws.Request, src string, tags map[string]string) {
+	if r.Error != nil || r.ExpireTime != 0 {
+		return
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	var q url.Values
+	if err == nil {
+		q, err = url.ParseQuery(string(b))
+	}
+	if err != nil {
+		r.Error = awserr.New("SerializationError",
+			"failed to add session attributes", err)
+		return
+	}
+	if src != "" {
+		q.Set("SourceIdentity", src)
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		q.Set(fmt.Sprintf("Tags.member.%d.Key", i+1), k)
+		q.Set(fmt.Sprintf("Tags.member.%d.Value", i+1), tags[k])
+	}
+	r.SetBufferBody([]byte(q.Encode()))
+}
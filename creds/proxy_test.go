@@ -1,13 +1,20 @@
 package creds
 
 import (
+	"io/ioutil"
+	"net/url"
+	"os"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/mxk/go-cloud/aws/arn"
 	"github.com/mxk/go-cloud/aws/awsmock"
 	"github.com/mxk/go-fast"
+	"github.com/mxk/oktapus/mock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -57,3 +64,161 @@ func TestProxy(t *testing.T) {
 	}
 	assert.Equal(t, want, cr)
 }
+
+func TestSessionProvider(t *testing.T) {
+	w := mock.NewAWS(mock.Ctx)
+	w.Account("1").RoleRouter()["admin"] = &mock.Role{Role: iam.Role{
+		MaxSessionDuration: aws.Int64(4 * 3600),
+	}}
+	p := Proxy{Client: NewClient(&w.Cfg)}
+	require.NoError(t, p.Init())
+	in := &sts.AssumeRoleInput{
+		RoleArn:         arn.String(p.Role("000000000001", "admin")),
+		RoleSessionName: aws.String(p.SessName),
+	}
+	dur := 12 * time.Hour
+	cp := p.SessionProvider(in, func() Session { return Session{Duration: dur} })
+
+	// MaxSessionDuration
+	cr, err := cp.Retrieve()
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(4*time.Hour), cr.Expires, time.Minute)
+	assert.EqualError(t, cp.Ensure(5*time.Hour), "creds: requested validity "+
+		"(5h0m0s) exceeds role MaxSessionDuration (4h0m0s)")
+	assert.Nil(t, in.DurationSeconds)
+
+	// Unknown MaxSessionDuration
+	other := &sts.AssumeRoleInput{
+		RoleArn:         arn.String(p.Role("000000000001", "other")),
+		RoleSessionName: aws.String(p.SessName),
+	}
+	ocp := p.SessionProvider(other, func() Session { return Session{Duration: dur} })
+	cr, err = ocp.Retrieve()
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), cr.Expires, time.Minute)
+	assert.EqualError(t, ocp.Ensure(2*time.Hour), "creds: requested validity "+
+		"(2h0m0s) exceeds default session duration (iam:GetRole failed) (1h0m0s)")
+
+	// Retry with MaxSessionDuration fails
+	w.Account("1").RoleRouter()["flaky"] = &mock.Role{Role: iam.Role{
+		MaxSessionDuration: aws.Int64(4 * 3600),
+	}}
+	w.Root().Add(mock.RouterFunc(func(q *mock.Request) bool {
+		in, ok := q.Params.(*sts.AssumeRoleInput)
+		if ok && arn.Value(in.RoleArn).Name() == "flaky" &&
+			aws.Int64Value(in.DurationSeconds) == 4*3600 {
+			q.Error = awserr.New("Throttling", "rate exceeded", nil)
+			return true
+		}
+		return false
+	}))
+	flaky := &sts.AssumeRoleInput{
+		RoleArn:         arn.String(p.Role("000000000001", "flaky")),
+		RoleSessionName: aws.String(p.SessName),
+	}
+	fcp := p.SessionProvider(flaky, func() Session { return Session{Duration: dur} })
+	cr, err = fcp.Retrieve()
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), cr.Expires, time.Minute)
+	assert.Equal(t, &LimitError{Limit: time.Hour, Reason: "default session duration"},
+		fcp.lim.Load())
+
+	// Session duration setting
+	dur = 2 * time.Hour
+	require.NoError(t, cp.Ensure(-1))
+	cr, _ = cp.Creds()
+	assert.WithinDuration(t, time.Now().Add(dur), cr.Expires, time.Minute)
+	assert.EqualError(t, cp.Ensure(3*time.Hour), "creds: requested validity "+
+		"(3h0m0s) exceeds session duration setting (2h0m0s)")
+
+	// Role chaining
+	p.Client = NewClient(&w.Cfg)
+	Set(p.Client.Client, cp)
+	require.NoError(t, p.Init())
+	in = &sts.AssumeRoleInput{
+		RoleArn:         arn.String(p.Role("000000000001", "admin")),
+		RoleSessionName: aws.String(p.SessName),
+	}
+	cp = p.SessionProvider(in, func() Session { return Session{Duration: dur} })
+	cr, err = cp.Retrieve()
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), cr.Expires, time.Minute)
+	assert.EqualError(t, cp.Ensure(dur), "creds: requested validity "+
+		"(2h0m0s) exceeds role chaining limit (1h0m0s)")
+}
+
+func TestSessionAttrs(t *testing.T) {
+	var body url.Values
+	cfg := awsmock.Config(func(r *aws.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		body, err = url.ParseQuery(string(b))
+		require.NoError(t, err)
+		r.Data.(*sts.AssumeRoleOutput).Credentials = &sts.Credentials{
+			AccessKeyId:     aws.String("tempkey"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(fast.Time().Add(time.Hour)),
+		}
+	})
+	p := Proxy{
+		Client:         NewClient(&cfg),
+		SourceIdentity: "alice@example.com",
+		Tags:           map[string]string{"login": "alice", "cmd": "ls"},
+	}
+	in := &sts.AssumeRoleInput{
+		RoleArn:         aws.String("arn:aws:iam::000000000000:role/testrole"),
+		RoleSessionName: aws.String("alice"),
+	}
+	cp := p.SessionProvider(in, func() Session {
+		return Session{Tags: map[string]string{"cmd": "creds", "owner": "bob"}}
+	})
+	_, err := cp.Retrieve()
+	require.NoError(t, err)
+	want := url.Values{
+		"Action":              {"AssumeRole"},
+		"Version":             {"2011-06-15"},
+		"RoleArn":             {"arn:aws:iam::000000000000:role/testrole"},
+		"RoleSessionName":     {"alice"},
+		"SourceIdentity":      {"alice@example.com"},
+		"Tags.member.1.Key":   {"cmd"},
+		"Tags.member.1.Value": {"creds"},
+		"Tags.member.2.Key":   {"login"},
+		"Tags.member.2.Value": {"alice"},
+		"Tags.member.3.Key":   {"owner"},
+		"Tags.member.3.Value": {"bob"},
+	}
+	assert.Equal(t, want, body)
+
+	p.SourceIdentity, p.Tags = "", nil
+	_, err = p.Provider(in).Retrieve()
+	require.NoError(t, err)
+	assert.Len(t, body, 4)
+}
+
+func TestWebIdentity(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "proxy_test.")
+	require.NoError(t, err)
+	defer func() {
+		tmp.Close()
+		assert.NoError(t, os.Remove(tmp.Name()))
+	}()
+	tmp.WriteString("eyJhbGciOiJSUzI1NiJ9.e30.c2ln\n")
+	require.NoError(t, tmp.Close())
+
+	w := mock.NewAWS(mock.Ctx)
+	c := NewClient(&w.Cfg)
+	Set(c.Client, aws.AnonymousCredentials)
+	role := mock.Ctx.New("iam", "role/ci")
+	cp := c.WebIdentityProvider(role, "runner", tmp.Name())
+	cr, err := cp.Retrieve()
+	require.NoError(t, err)
+	assert.Equal(t, WebIdentityProviderName, cr.Source)
+	assert.Equal(t, w.SessionToken("", "ci", "runner"), cr.SessionToken)
+
+	p := Proxy{Client: NewClient(&w.Cfg)}
+	Set(p.Client.Client, cp)
+	require.NoError(t, p.Init())
+	assert.Equal(t, "runner", p.SessName)
+	assert.Equal(t, w.SessionToken("", "ci", "runner"), string(p.Ident.ARN))
+}
@@ -10,4 +10,5 @@ require (
 	github.com/stretchr/testify v1.3.0
 	golang.org/x/crypto v0.0.0-20190103213133-ff983b9c42bc
 	golang.org/x/net v0.0.0-20190119204137-ed066c81e75e
+	gopkg.in/yaml.v2 v2.4.0
 )
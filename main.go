@@ -1,7 +1,11 @@
 package main
 
 import (
+	"os"
+	"strings"
+
 	"github.com/mxk/go-cli"
+	"github.com/mxk/oktapus/op"
 
 	// CLI registration
 	_ "github.com/mxk/oktapus/cmd"
@@ -10,5 +14,28 @@ import (
 func main() {
 	cli.DebugFromEnv("OKTAPUS_DEBUG")
 	cli.Main.Summary = "AWS account management and creation tool"
-	cli.Main.Run()
+	cli.Main.Run(profileArg(os.Args[1:])...)
+}
+
+// profileArg removes the global "-profile <name>" option from args. The
+// profile name is exported via the environment, which makes it available to the
+// context and any child processes.
+func profileArg(args []string) []string {
+	if len(args) == 0 {
+		return args
+	}
+	a := args[0]
+	if strings.HasPrefix(a, "--") {
+		a = a[1:]
+	}
+	var name string
+	if a == "-profile" && len(args) > 1 {
+		name, args = args[1], args[2:]
+	} else if strings.HasPrefix(a, "-profile=") {
+		name, args = a[len("-profile="):], args[1:]
+	} else {
+		return args
+	}
+	os.Setenv(op.ConfigProfileEnv, name)
+	return args
 }
@@ -96,7 +96,7 @@ func (w *AWS) newRequest(r *aws.Request) *Request {
 		Account:   w.Ctx.Account,
 	}
 	cr, err := r.Config.Credentials.Retrieve()
-	if err != nil {
+	if err != nil && r.Config.Credentials != aws.AnonymousCredentials {
 		panic(err)
 	}
 	if cr.SessionToken != "" {
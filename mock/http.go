@@ -23,7 +23,9 @@ func ClientServer() (*http.Client, *Server) {
 func (s *Server) RoundTrip(r *http.Request) (*http.Response, error) {
 	w := httptest.NewRecorder()
 	s.Handler.ServeHTTP(w, r)
-	return w.Result(), nil
+	rsp := w.Result()
+	rsp.Request = r
+	return rsp, nil
 }
 
 // ServeHTTP implements http.Handler.
@@ -0,0 +1,184 @@
+package mock
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/mxk/go-cloud/aws/arn"
+)
+
+// Group is a mock IAM group.
+type Group struct {
+	iam.Group
+	Users            map[string]bool
+	AttachedPolicies map[arn.ARN]string
+	InlinePolicies   map[string]string
+}
+
+// GroupRouter handles IAM group API calls.
+type GroupRouter map[string]*Group
+
+// Route implements the Router interface.
+func (r GroupRouter) Route(q *Request) bool { return RouteMethod(r, q) }
+
+func (r GroupRouter) AddUserToGroup(q *Request, in *iam.AddUserToGroupInput) {
+	if group := r.get(in.GroupName, q); group != nil {
+		if group.Users == nil {
+			group.Users = make(map[string]bool)
+		}
+		group.Users[aws.StringValue(in.UserName)] = true
+	}
+}
+
+func (r GroupRouter) AttachGroupPolicy(q *Request, in *iam.AttachGroupPolicyInput) {
+	if group := r.get(in.GroupName, q); group != nil {
+		if group.AttachedPolicies == nil {
+			group.AttachedPolicies = make(map[arn.ARN]string)
+		}
+		pol := arn.Value(in.PolicyArn)
+		group.AttachedPolicies[pol] = pol.Name()
+	}
+}
+
+func (r GroupRouter) CreateGroup(q *Request, in *iam.CreateGroupInput) {
+	name := aws.StringValue(in.GroupName)
+	if _, ok := r[name]; ok {
+		q.Error = awserr.New(iam.ErrCodeEntityAlreadyExistsException,
+			"group exists: "+name, nil)
+		return
+	}
+	path := aws.StringValue(in.Path)
+	if path == "" {
+		path = "/"
+	}
+	group := &Group{Group: iam.Group{
+		Arn:       arn.String(q.Ctx.New("iam", "group/", name).WithPath(path)),
+		GroupName: in.GroupName,
+		Path:      aws.String(path),
+	}}
+	r[name] = group
+	cpy := group.Group
+	q.Data.(*iam.CreateGroupOutput).Group = &cpy
+}
+
+func (r GroupRouter) DeleteGroup(q *Request, in *iam.DeleteGroupInput) {
+	if group := r.get(in.GroupName, q); group != nil {
+		if len(group.Users) != 0 {
+			panic("mock: group has users")
+		}
+		if len(group.AttachedPolicies) != 0 {
+			panic("mock: group has attached policies")
+		}
+		if len(group.InlinePolicies) != 0 {
+			panic("mock: group has inline policies")
+		}
+		delete(r, *in.GroupName)
+	}
+}
+
+func (r GroupRouter) DeleteGroupPolicy(q *Request, in *iam.DeleteGroupPolicyInput) {
+	if group := r.get(in.GroupName, q); group != nil {
+		name := aws.StringValue(in.PolicyName)
+		if _, ok := group.InlinePolicies[name]; !ok {
+			panic("mock: invalid inline policy: " + name)
+		}
+		delete(group.InlinePolicies, name)
+	}
+}
+
+func (r GroupRouter) DetachGroupPolicy(q *Request, in *iam.DetachGroupPolicyInput) {
+	if group := r.get(in.GroupName, q); group != nil {
+		pol := arn.Value(in.PolicyArn)
+		if _, ok := group.AttachedPolicies[pol]; !ok {
+			panic("mock: invalid attached policy: " + string(pol))
+		}
+		delete(group.AttachedPolicies, pol)
+	}
+}
+
+func (r GroupRouter) GetGroup(q *Request, in *iam.GetGroupInput) {
+	if group := r.get(in.GroupName, q); group != nil {
+		names := make([]string, 0, len(group.Users))
+		for name := range group.Users {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		users := make([]iam.User, len(names))
+		for i, name := range names {
+			users[i] = iam.User{UserName: aws.String(name)}
+		}
+		cpy := group.Group
+		out := q.Data.(*iam.GetGroupOutput)
+		out.Group = &cpy
+		out.Users = users
+	}
+}
+
+func (r GroupRouter) ListAttachedGroupPolicies(q *Request, in *iam.ListAttachedGroupPoliciesInput) {
+	if group := r.get(in.GroupName, q); group != nil {
+		pols := make([]iam.AttachedPolicy, 0, len(group.AttachedPolicies))
+		for pol, name := range group.AttachedPolicies {
+			pols = append(pols, iam.AttachedPolicy{
+				PolicyArn:  arn.String(pol),
+				PolicyName: aws.String(name),
+			})
+		}
+		q.Data.(*iam.ListAttachedGroupPoliciesOutput).AttachedPolicies = pols
+	}
+}
+
+func (r GroupRouter) ListGroupPolicies(q *Request, in *iam.ListGroupPoliciesInput) {
+	if group := r.get(in.GroupName, q); group != nil {
+		names := make([]string, 0, len(group.InlinePolicies))
+		for name := range group.InlinePolicies {
+			names = append(names, name)
+		}
+		q.Data.(*iam.ListGroupPoliciesOutput).PolicyNames = names
+	}
+}
+
+func (r GroupRouter) ListGroups(q *Request, in *iam.ListGroupsInput) {
+	prefix := aws.StringValue(in.PathPrefix)
+	groups := make([]iam.Group, 0, len(r))
+	for _, group := range r {
+		if strings.HasPrefix(aws.StringValue(group.Path), prefix) {
+			groups = append(groups, group.Group)
+		}
+	}
+	q.Data.(*iam.ListGroupsOutput).Groups = groups
+}
+
+func (r GroupRouter) PutGroupPolicy(q *Request, in *iam.PutGroupPolicyInput) {
+	if group := r.get(in.GroupName, q); group != nil {
+		if group.InlinePolicies == nil {
+			group.InlinePolicies = make(map[string]string)
+		}
+		name := aws.StringValue(in.PolicyName)
+		group.InlinePolicies[name] = aws.StringValue(in.PolicyDocument)
+	}
+}
+
+func (r GroupRouter) RemoveUserFromGroup(q *Request, in *iam.RemoveUserFromGroupInput) {
+	if group := r.get(in.GroupName, q); group != nil {
+		name := aws.StringValue(in.UserName)
+		if !group.Users[name] {
+			panic("mock: user not in group: " + name)
+		}
+		delete(group.Users, name)
+	}
+}
+
+func (r GroupRouter) get(name *string, q *Request) *Group {
+	if name == nil {
+		name = aws.String("")
+	} else if group := r[*name]; group != nil {
+		return group
+	}
+	err := awserr.New(iam.ErrCodeNoSuchEntityException, "unknown group: "+(*name), nil)
+	q.Error = awserr.NewRequestFailure(err, http.StatusNotFound, "")
+	return nil
+}
@@ -0,0 +1,116 @@
+package mock
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/mxk/go-cloud/aws/arn"
+)
+
+// InstanceProfileRouter handles IAM instance profile API calls.
+type InstanceProfileRouter map[string]*iam.InstanceProfile
+
+// Route implements the Router interface.
+func (r InstanceProfileRouter) Route(q *Request) bool { return RouteMethod(r, q) }
+
+func (r InstanceProfileRouter) AddRoleToInstanceProfile(q *Request, in *iam.AddRoleToInstanceProfileInput) {
+	if ip := r.get(in.InstanceProfileName, q); ip != nil {
+		if len(ip.Roles) != 0 {
+			q.Error = awserr.New(iam.ErrCodeLimitExceededException,
+				"instance profile already has a role", nil)
+			return
+		}
+		ip.Roles = []iam.Role{{RoleName: in.RoleName}}
+	}
+}
+
+func (r InstanceProfileRouter) CreateInstanceProfile(q *Request, in *iam.CreateInstanceProfileInput) {
+	name := aws.StringValue(in.InstanceProfileName)
+	if _, ok := r[name]; ok {
+		q.Error = awserr.New(iam.ErrCodeEntityAlreadyExistsException,
+			"instance profile exists: "+name, nil)
+		return
+	}
+	path := aws.StringValue(in.Path)
+	if path == "" {
+		path = "/"
+	}
+	ip := &iam.InstanceProfile{
+		Arn:                 arn.String(q.Ctx.New("iam", "instance-profile/", name).WithPath(path)),
+		InstanceProfileName: in.InstanceProfileName,
+		Path:                aws.String(path),
+	}
+	r[name] = ip
+	cpy := *ip
+	q.Data.(*iam.CreateInstanceProfileOutput).InstanceProfile = &cpy
+}
+
+func (r InstanceProfileRouter) DeleteInstanceProfile(q *Request, in *iam.DeleteInstanceProfileInput) {
+	if ip := r.get(in.InstanceProfileName, q); ip != nil {
+		if len(ip.Roles) != 0 {
+			panic("mock: instance profile has roles")
+		}
+		delete(r, *in.InstanceProfileName)
+	}
+}
+
+func (r InstanceProfileRouter) ListInstanceProfiles(q *Request, in *iam.ListInstanceProfilesInput) {
+	prefix := aws.StringValue(in.PathPrefix)
+	ips := make([]iam.InstanceProfile, 0, len(r))
+	for _, ip := range r {
+		if strings.HasPrefix(aws.StringValue(ip.Path), prefix) {
+			ips = append(ips, *ip)
+		}
+	}
+	q.Data.(*iam.ListInstanceProfilesOutput).InstanceProfiles = ips
+}
+
+func (r InstanceProfileRouter) ListInstanceProfilesForRole(q *Request, in *iam.ListInstanceProfilesForRoleInput) {
+	role := aws.StringValue(in.RoleName)
+	var ips []iam.InstanceProfile
+	for _, ip := range r {
+		for i := range ip.Roles {
+			if aws.StringValue(ip.Roles[i].RoleName) == role {
+				ips = append(ips, *ip)
+				break
+			}
+		}
+	}
+	q.Data.(*iam.ListInstanceProfilesForRoleOutput).InstanceProfiles = ips
+}
+
+func (r InstanceProfileRouter) RemoveRoleFromInstanceProfile(q *Request, in *iam.RemoveRoleFromInstanceProfileInput) {
+	if ip := r.get(in.InstanceProfileName, q); ip != nil {
+		role := aws.StringValue(in.RoleName)
+		if len(ip.Roles) == 0 || aws.StringValue(ip.Roles[0].RoleName) != role {
+			panic("mock: role not in instance profile: " + role)
+		}
+		ip.Roles = nil
+	}
+}
+
+// hasRole returns true if the specified role is in any instance profile.
+func (r InstanceProfileRouter) hasRole(role string) bool {
+	for _, ip := range r {
+		for i := range ip.Roles {
+			if aws.StringValue(ip.Roles[i].RoleName) == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r InstanceProfileRouter) get(name *string, q *Request) *iam.InstanceProfile {
+	if name == nil {
+		name = aws.String("")
+	} else if ip := r[*name]; ip != nil {
+		return ip
+	}
+	err := awserr.New(iam.ErrCodeNoSuchEntityException, "unknown instance profile: "+(*name), nil)
+	q.Error = awserr.NewRequestFailure(err, http.StatusNotFound, "")
+	return nil
+}
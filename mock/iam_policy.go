@@ -0,0 +1,187 @@
+package mock
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/mxk/go-fast"
+)
+
+// Policy is a mock customer-managed IAM policy.
+type Policy struct {
+	iam.Policy
+	Versions []*iam.PolicyVersion
+}
+
+// PolicyRouter handles IAM customer-managed policy API calls. Attachments are
+// tracked by the role, user, and group routers of the same account.
+type PolicyRouter map[arn.ARN]*Policy
+
+// Route implements the Router interface.
+func (r PolicyRouter) Route(q *Request) bool { return RouteMethod(r, q) }
+
+func (r PolicyRouter) CreatePolicy(q *Request, in *iam.CreatePolicyInput) {
+	name := aws.StringValue(in.PolicyName)
+	path := aws.StringValue(in.Path)
+	if path == "" {
+		path = "/"
+	}
+	pa := q.Ctx.New("iam", "policy/", name).WithPath(path)
+	if _, ok := r[pa]; ok {
+		q.Error = awserr.New(iam.ErrCodeEntityAlreadyExistsException,
+			"policy exists: "+name, nil)
+		return
+	}
+	now := fast.Time()
+	pol := &Policy{Policy: iam.Policy{
+		Arn:              arn.String(pa),
+		CreateDate:       aws.Time(now),
+		DefaultVersionId: aws.String("v1"),
+		Description:      in.Description,
+		IsAttachable:     aws.Bool(true),
+		Path:             aws.String(path),
+		PolicyName:       in.PolicyName,
+		UpdateDate:       aws.Time(now),
+	}, Versions: []*iam.PolicyVersion{{
+		CreateDate:       aws.Time(now),
+		Document:         in.PolicyDocument,
+		IsDefaultVersion: aws.Bool(true),
+		VersionId:        aws.String("v1"),
+	}}}
+	r[pa] = pol
+	cpy := pol.Policy
+	q.Data.(*iam.CreatePolicyOutput).Policy = &cpy
+}
+
+func (r PolicyRouter) CreatePolicyVersion(q *Request, in *iam.CreatePolicyVersionInput) {
+	if pol := r.get(in.PolicyArn, q); pol != nil {
+		last := pol.Versions[len(pol.Versions)-1]
+		n, _ := strconv.Atoi(strings.TrimPrefix(aws.StringValue(last.VersionId), "v"))
+		v := &iam.PolicyVersion{
+			CreateDate:       aws.Time(fast.Time()),
+			Document:         in.PolicyDocument,
+			IsDefaultVersion: aws.Bool(aws.BoolValue(in.SetAsDefault)),
+			VersionId:        aws.String("v" + strconv.Itoa(n+1)),
+		}
+		if aws.BoolValue(in.SetAsDefault) {
+			for _, v := range pol.Versions {
+				v.IsDefaultVersion = aws.Bool(false)
+			}
+			pol.DefaultVersionId = v.VersionId
+		}
+		pol.Versions = append(pol.Versions, v)
+		cpy := *v
+		q.Data.(*iam.CreatePolicyVersionOutput).PolicyVersion = &cpy
+	}
+}
+
+func (r PolicyRouter) DeletePolicy(q *Request, in *iam.DeletePolicyInput) {
+	if pol := r.get(in.PolicyArn, q); pol != nil {
+		if g, r, u := attachedEntities(q, arn.Value(in.PolicyArn)); len(g)+len(r)+len(u) != 0 {
+			panic("mock: policy is attached")
+		}
+		if len(pol.Versions) != 1 {
+			panic("mock: policy has non-default versions")
+		}
+		delete(r, arn.Value(in.PolicyArn))
+	}
+}
+
+func (r PolicyRouter) DeletePolicyVersion(q *Request, in *iam.DeletePolicyVersionInput) {
+	if pol := r.get(in.PolicyArn, q); pol != nil {
+		id := aws.StringValue(in.VersionId)
+		for i, v := range pol.Versions {
+			if aws.StringValue(v.VersionId) == id {
+				if aws.BoolValue(v.IsDefaultVersion) {
+					panic("mock: cannot delete default policy version")
+				}
+				pol.Versions = append(pol.Versions[:i], pol.Versions[i+1:]...)
+				return
+			}
+		}
+		panic("mock: invalid policy version: " + id)
+	}
+}
+
+func (r PolicyRouter) ListEntitiesForPolicy(q *Request, in *iam.ListEntitiesForPolicyInput) {
+	if pol := r.get(in.PolicyArn, q); pol != nil {
+		out := q.Data.(*iam.ListEntitiesForPolicyOutput)
+		out.PolicyGroups, out.PolicyRoles, out.PolicyUsers =
+			attachedEntities(q, arn.Value(in.PolicyArn))
+	}
+}
+
+func (r PolicyRouter) ListPolicies(q *Request, in *iam.ListPoliciesInput) {
+	if in.Scope == iam.PolicyScopeTypeAws {
+		return
+	}
+	prefix := aws.StringValue(in.PathPrefix)
+	pols := make([]iam.Policy, 0, len(r))
+	for _, pol := range r {
+		if strings.HasPrefix(aws.StringValue(pol.Path), prefix) {
+			pols = append(pols, pol.Policy)
+		}
+	}
+	q.Data.(*iam.ListPoliciesOutput).Policies = pols
+}
+
+func (r PolicyRouter) ListPolicyVersions(q *Request, in *iam.ListPolicyVersionsInput) {
+	if pol := r.get(in.PolicyArn, q); pol != nil {
+		vs := make([]iam.PolicyVersion, len(pol.Versions))
+		for i, v := range pol.Versions {
+			vs[i] = *v
+			vs[i].Document = nil
+		}
+		q.Data.(*iam.ListPolicyVersionsOutput).Versions = vs
+	}
+}
+
+func (r PolicyRouter) get(pa *string, q *Request) *Policy {
+	if pol := r[arn.Value(pa)]; pol != nil {
+		return pol
+	}
+	err := awserr.New(iam.ErrCodeNoSuchEntityException, "unknown policy: "+aws.StringValue(pa), nil)
+	q.Error = awserr.NewRequestFailure(err, http.StatusNotFound, "")
+	return nil
+}
+
+// attachedEntities returns all groups, roles, and users in the request account
+// that have the specified policy attached.
+func attachedEntities(q *Request, pa arn.ARN) ([]iam.PolicyGroup, []iam.PolicyRole, []iam.PolicyUser) {
+	var (
+		gr GroupRouter
+		rr RoleRouter
+		ur UserRouter
+		g  []iam.PolicyGroup
+		r  []iam.PolicyRole
+		u  []iam.PolicyUser
+	)
+	cr := q.AWS.Account(q.Ctx.Account)
+	if cr.Find(&gr) {
+		for name, group := range gr {
+			if _, ok := group.AttachedPolicies[pa]; ok {
+				g = append(g, iam.PolicyGroup{GroupName: aws.String(name)})
+			}
+		}
+	}
+	if cr.Find(&rr) {
+		for name, role := range rr {
+			if _, ok := role.AttachedPolicies[pa]; ok {
+				r = append(r, iam.PolicyRole{RoleName: aws.String(name)})
+			}
+		}
+	}
+	if cr.Find(&ur) {
+		for name, user := range ur {
+			if _, ok := user.AttachedPolicies[pa]; ok {
+				u = append(u, iam.PolicyUser{UserName: aws.String(name)})
+			}
+		}
+	}
+	return g, r, u
+}
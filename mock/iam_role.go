@@ -2,6 +2,7 @@ package mock
 
 import (
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -46,9 +47,16 @@ func (r RoleRouter) CreateRole(q *Request, in *iam.CreateRoleInput) {
 		Arn:                      arn.String(q.Ctx.New("iam", "role/", name).WithPath(path)),
 		AssumeRolePolicyDocument: in.AssumeRolePolicyDocument,
 		Description:              in.Description,
+		MaxSessionDuration:       in.MaxSessionDuration,
 		Path:                     in.Path,
 		RoleName:                 in.RoleName,
 	}}
+	if in.PermissionsBoundary != nil {
+		role.PermissionsBoundary = &iam.AttachedPermissionsBoundary{
+			PermissionsBoundaryArn:  in.PermissionsBoundary,
+			PermissionsBoundaryType: iam.PermissionsBoundaryAttachmentTypePermissionsBoundaryPolicy,
+		}
+	}
 	r[name] = role
 	cpy := role.Role
 	cpy.Description = nil // Match AWS behavior
@@ -63,10 +71,20 @@ func (r RoleRouter) DeleteRole(q *Request, in *iam.DeleteRoleInput) {
 		if len(role.InlinePolicies) != 0 {
 			panic("mock: role has inline policies")
 		}
+		var ipr InstanceProfileRouter
+		if q.AWS.Account(q.Ctx.Account).Find(&ipr) && ipr.hasRole(*in.RoleName) {
+			panic("mock: role is in an instance profile")
+		}
 		delete(r, *in.RoleName)
 	}
 }
 
+func (r RoleRouter) DeleteRolePermissionsBoundary(q *Request, in *iam.DeleteRolePermissionsBoundaryInput) {
+	if role := r.get(in.RoleName, q); role != nil {
+		role.PermissionsBoundary = nil
+	}
+}
+
 func (r RoleRouter) DeleteRolePolicy(q *Request, in *iam.DeleteRolePolicyInput) {
 	if role := r.get(in.RoleName, q); role != nil {
 		name := aws.StringValue(in.PolicyName)
@@ -94,6 +112,22 @@ func (r RoleRouter) GetRole(q *Request, in *iam.GetRoleInput) {
 	}
 }
 
+func (r RoleRouter) GetRolePolicy(q *Request, in *iam.GetRolePolicyInput) {
+	if role := r.get(in.RoleName, q); role != nil {
+		name := aws.StringValue(in.PolicyName)
+		doc, ok := role.InlinePolicies[name]
+		if !ok {
+			err := awserr.New(iam.ErrCodeNoSuchEntityException, "unknown inline policy: "+name, nil)
+			q.Error = awserr.NewRequestFailure(err, http.StatusNotFound, "")
+			return
+		}
+		out := q.Data.(*iam.GetRolePolicyOutput)
+		out.PolicyDocument = aws.String(url.QueryEscape(doc))
+		out.PolicyName = in.PolicyName
+		out.RoleName = in.RoleName
+	}
+}
+
 func (r RoleRouter) ListAttachedRolePolicies(q *Request, in *iam.ListAttachedRolePoliciesInput) {
 	if role := r.get(in.RoleName, q); role != nil {
 		pols := make([]iam.AttachedPolicy, 0, len(r))
@@ -128,6 +162,15 @@ func (r RoleRouter) ListRoles(q *Request, in *iam.ListRolesInput) {
 	q.Data.(*iam.ListRolesOutput).Roles = roles
 }
 
+func (r RoleRouter) PutRolePermissionsBoundary(q *Request, in *iam.PutRolePermissionsBoundaryInput) {
+	if role := r.get(in.RoleName, q); role != nil {
+		role.PermissionsBoundary = &iam.AttachedPermissionsBoundary{
+			PermissionsBoundaryArn:  in.PermissionsBoundary,
+			PermissionsBoundaryType: iam.PermissionsBoundaryAttachmentTypePermissionsBoundaryPolicy,
+		}
+	}
+}
+
 func (r RoleRouter) PutRolePolicy(q *Request, in *iam.PutRolePolicyInput) {
 	if role := r.get(in.RoleName, q); role != nil {
 		if role.InlinePolicies == nil {
@@ -144,6 +187,17 @@ func (r RoleRouter) UpdateAssumeRolePolicy(q *Request, in *iam.UpdateAssumeRoleP
 	}
 }
 
+func (r RoleRouter) UpdateRole(q *Request, in *iam.UpdateRoleInput) {
+	if role := r.get(in.RoleName, q); role != nil {
+		if in.Description != nil {
+			role.Description = in.Description
+		}
+		if in.MaxSessionDuration != nil {
+			role.MaxSessionDuration = in.MaxSessionDuration
+		}
+	}
+}
+
 func (r RoleRouter) UpdateRoleDescription(q *Request, in *iam.UpdateRoleDescriptionInput) {
 	if role := r.get(in.RoleName, q); role != nil {
 		role.Description = in.Description
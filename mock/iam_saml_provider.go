@@ -0,0 +1,51 @@
+package mock
+
+import (
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/mxk/go-fast"
+)
+
+// SAMLProviderRouter handles IAM SAML provider API calls.
+type SAMLProviderRouter map[arn.ARN]*iam.SAMLProviderListEntry
+
+// Route implements the Router interface.
+func (r SAMLProviderRouter) Route(q *Request) bool { return RouteMethod(r, q) }
+
+func (r SAMLProviderRouter) CreateSAMLProvider(q *Request, in *iam.CreateSAMLProviderInput) {
+	name := aws.StringValue(in.Name)
+	pa := q.Ctx.New("iam", "saml-provider/", name)
+	if _, ok := r[pa]; ok {
+		q.Error = awserr.New(iam.ErrCodeEntityAlreadyExistsException,
+			"saml provider exists: "+name, nil)
+		return
+	}
+	r[pa] = &iam.SAMLProviderListEntry{
+		Arn:        arn.String(pa),
+		CreateDate: aws.Time(fast.Time()),
+	}
+	q.Data.(*iam.CreateSAMLProviderOutput).SAMLProviderArn = arn.String(pa)
+}
+
+func (r SAMLProviderRouter) DeleteSAMLProvider(q *Request, in *iam.DeleteSAMLProviderInput) {
+	pa := arn.Value(in.SAMLProviderArn)
+	if _, ok := r[pa]; !ok {
+		err := awserr.New(iam.ErrCodeNoSuchEntityException,
+			"unknown saml provider: "+string(pa), nil)
+		q.Error = awserr.NewRequestFailure(err, http.StatusNotFound, "")
+		return
+	}
+	delete(r, pa)
+}
+
+func (r SAMLProviderRouter) ListSAMLProviders(q *Request, in *iam.ListSAMLProvidersInput) {
+	list := make([]iam.SAMLProviderListEntry, 0, len(r))
+	for _, p := range r {
+		list = append(list, *p)
+	}
+	q.Data.(*iam.ListSAMLProvidersOutput).SAMLProviderList = list
+}
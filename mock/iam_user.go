@@ -16,6 +16,12 @@ type User struct {
 	iam.User
 	AccessKeys       []*iam.AccessKeyMetadata
 	AttachedPolicies map[arn.ARN]string
+	InlinePolicies   map[string]string
+	LoginProfile     *iam.LoginProfile
+	MFADevices       []*iam.MFADevice
+	SigningCerts     []*iam.SigningCertificate
+	SSHPublicKeys    []*iam.SSHPublicKeyMetadata
+	ServiceCreds     []*iam.ServiceSpecificCredentialMetadata
 }
 
 // UserRouter handles IAM user API calls.
@@ -74,6 +80,20 @@ func (r UserRouter) CreateUser(q *Request, in *iam.CreateUserInput) {
 	q.Data.(*iam.CreateUserOutput).User = &cpy
 }
 
+func (r UserRouter) DeactivateMFADevice(q *Request, in *iam.DeactivateMFADeviceInput) {
+	if user := r.get(in.UserName, q); user != nil {
+		sn := aws.StringValue(in.SerialNumber)
+		for i, d := range user.MFADevices {
+			if aws.StringValue(d.SerialNumber) == sn {
+				user.MFADevices = append(user.MFADevices[:i],
+					user.MFADevices[i+1:]...)
+				return
+			}
+		}
+		panic("mock: invalid mfa device: " + sn)
+	}
+}
+
 func (r UserRouter) DeleteAccessKey(q *Request, in *iam.DeleteAccessKeyInput) {
 	if user := r.get(in.UserName, q); user != nil {
 		id := aws.StringValue(in.AccessKeyId)
@@ -88,6 +108,60 @@ func (r UserRouter) DeleteAccessKey(q *Request, in *iam.DeleteAccessKeyInput) {
 	}
 }
 
+func (r UserRouter) DeleteLoginProfile(q *Request, in *iam.DeleteLoginProfileInput) {
+	if user := r.get(in.UserName, q); user != nil {
+		if user.LoginProfile == nil {
+			err := awserr.New(iam.ErrCodeNoSuchEntityException,
+				"no login profile: "+aws.StringValue(in.UserName), nil)
+			q.Error = awserr.NewRequestFailure(err, http.StatusNotFound, "")
+			return
+		}
+		user.LoginProfile = nil
+	}
+}
+
+func (r UserRouter) DeleteSSHPublicKey(q *Request, in *iam.DeleteSSHPublicKeyInput) {
+	if user := r.get(in.UserName, q); user != nil {
+		id := aws.StringValue(in.SSHPublicKeyId)
+		for i, k := range user.SSHPublicKeys {
+			if aws.StringValue(k.SSHPublicKeyId) == id {
+				user.SSHPublicKeys = append(user.SSHPublicKeys[:i],
+					user.SSHPublicKeys[i+1:]...)
+				return
+			}
+		}
+		panic("mock: invalid ssh public key id: " + id)
+	}
+}
+
+func (r UserRouter) DeleteServiceSpecificCredential(q *Request, in *iam.DeleteServiceSpecificCredentialInput) {
+	if user := r.get(in.UserName, q); user != nil {
+		id := aws.StringValue(in.ServiceSpecificCredentialId)
+		for i, c := range user.ServiceCreds {
+			if aws.StringValue(c.ServiceSpecificCredentialId) == id {
+				user.ServiceCreds = append(user.ServiceCreds[:i],
+					user.ServiceCreds[i+1:]...)
+				return
+			}
+		}
+		panic("mock: invalid service-specific credential id: " + id)
+	}
+}
+
+func (r UserRouter) DeleteSigningCertificate(q *Request, in *iam.DeleteSigningCertificateInput) {
+	if user := r.get(in.UserName, q); user != nil {
+		id := aws.StringValue(in.CertificateId)
+		for i, c := range user.SigningCerts {
+			if aws.StringValue(c.CertificateId) == id {
+				user.SigningCerts = append(user.SigningCerts[:i],
+					user.SigningCerts[i+1:]...)
+				return
+			}
+		}
+		panic("mock: invalid signing certificate id: " + id)
+	}
+}
+
 func (r UserRouter) DeleteUser(q *Request, in *iam.DeleteUserInput) {
 	if user := r.get(in.UserName, q); user != nil {
 		if len(user.AttachedPolicies) != 0 {
@@ -96,10 +170,57 @@ func (r UserRouter) DeleteUser(q *Request, in *iam.DeleteUserInput) {
 		if len(user.AccessKeys) != 0 {
 			panic("mock: user has access keys")
 		}
+		if len(user.InlinePolicies) != 0 {
+			panic("mock: user has inline policies")
+		}
+		if user.LoginProfile != nil {
+			panic("mock: user has a login profile")
+		}
+		if len(user.MFADevices) != 0 {
+			panic("mock: user has mfa devices")
+		}
+		if len(user.SigningCerts) != 0 {
+			panic("mock: user has signing certificates")
+		}
+		if len(user.SSHPublicKeys) != 0 {
+			panic("mock: user has ssh public keys")
+		}
+		if len(user.ServiceCreds) != 0 {
+			panic("mock: user has service-specific credentials")
+		}
+		var gr GroupRouter
+		if q.AWS.Account(q.Ctx.Account).Find(&gr) {
+			for _, group := range gr {
+				if group.Users[*in.UserName] {
+					panic("mock: user is in a group")
+				}
+			}
+		}
 		delete(r, *in.UserName)
 	}
 }
 
+func (r UserRouter) DeleteUserPolicy(q *Request, in *iam.DeleteUserPolicyInput) {
+	if user := r.get(in.UserName, q); user != nil {
+		name := aws.StringValue(in.PolicyName)
+		if _, ok := user.InlinePolicies[name]; !ok {
+			panic("mock: invalid inline policy: " + name)
+		}
+		delete(user.InlinePolicies, name)
+	}
+}
+
+func (r UserRouter) DeleteVirtualMFADevice(q *Request, in *iam.DeleteVirtualMFADeviceInput) {
+	sn := aws.StringValue(in.SerialNumber)
+	for _, user := range r {
+		for _, d := range user.MFADevices {
+			if aws.StringValue(d.SerialNumber) == sn {
+				panic("mock: mfa device is active: " + sn)
+			}
+		}
+	}
+}
+
 func (r UserRouter) DetachUserPolicy(q *Request, in *iam.DetachUserPolicyInput) {
 	if user := r.get(in.UserName, q); user != nil {
 		pol := arn.Value(in.PolicyArn)
@@ -140,6 +261,71 @@ func (r UserRouter) ListAttachedUserPolicies(q *Request, in *iam.ListAttachedUse
 	}
 }
 
+func (r UserRouter) ListGroupsForUser(q *Request, in *iam.ListGroupsForUserInput) {
+	if user := r.get(in.UserName, q); user != nil {
+		var groups []iam.Group
+		var gr GroupRouter
+		if q.AWS.Account(q.Ctx.Account).Find(&gr) {
+			for _, group := range gr {
+				if group.Users[*in.UserName] {
+					groups = append(groups, group.Group)
+				}
+			}
+		}
+		q.Data.(*iam.ListGroupsForUserOutput).Groups = groups
+	}
+}
+
+func (r UserRouter) ListMFADevices(q *Request, in *iam.ListMFADevicesInput) {
+	if user := r.get(in.UserName, q); user != nil {
+		devs := make([]iam.MFADevice, 0, len(user.MFADevices))
+		for _, d := range user.MFADevices {
+			devs = append(devs, *d)
+		}
+		q.Data.(*iam.ListMFADevicesOutput).MFADevices = devs
+	}
+}
+
+func (r UserRouter) ListSSHPublicKeys(q *Request, in *iam.ListSSHPublicKeysInput) {
+	if user := r.get(in.UserName, q); user != nil {
+		keys := make([]iam.SSHPublicKeyMetadata, 0, len(user.SSHPublicKeys))
+		for _, k := range user.SSHPublicKeys {
+			keys = append(keys, *k)
+		}
+		q.Data.(*iam.ListSSHPublicKeysOutput).SSHPublicKeys = keys
+	}
+}
+
+func (r UserRouter) ListServiceSpecificCredentials(q *Request, in *iam.ListServiceSpecificCredentialsInput) {
+	if user := r.get(in.UserName, q); user != nil {
+		creds := make([]iam.ServiceSpecificCredentialMetadata, 0, len(user.ServiceCreds))
+		for _, c := range user.ServiceCreds {
+			creds = append(creds, *c)
+		}
+		q.Data.(*iam.ListServiceSpecificCredentialsOutput).ServiceSpecificCredentials = creds
+	}
+}
+
+func (r UserRouter) ListSigningCertificates(q *Request, in *iam.ListSigningCertificatesInput) {
+	if user := r.get(in.UserName, q); user != nil {
+		certs := make([]iam.SigningCertificate, 0, len(user.SigningCerts))
+		for _, c := range user.SigningCerts {
+			certs = append(certs, *c)
+		}
+		q.Data.(*iam.ListSigningCertificatesOutput).Certificates = certs
+	}
+}
+
+func (r UserRouter) ListUserPolicies(q *Request, in *iam.ListUserPoliciesInput) {
+	if user := r.get(in.UserName, q); user != nil {
+		names := make([]string, 0, len(user.InlinePolicies))
+		for name := range user.InlinePolicies {
+			names = append(names, name)
+		}
+		q.Data.(*iam.ListUserPoliciesOutput).PolicyNames = names
+	}
+}
+
 func (r UserRouter) ListUsers(q *Request, in *iam.ListUsersInput) {
 	prefix := aws.StringValue(in.PathPrefix)
 	users := make([]iam.User, 0, len(r))
@@ -151,6 +337,29 @@ func (r UserRouter) ListUsers(q *Request, in *iam.ListUsersInput) {
 	q.Data.(*iam.ListUsersOutput).Users = users
 }
 
+func (r UserRouter) PutUserPolicy(q *Request, in *iam.PutUserPolicyInput) {
+	if user := r.get(in.UserName, q); user != nil {
+		if user.InlinePolicies == nil {
+			user.InlinePolicies = make(map[string]string)
+		}
+		name := aws.StringValue(in.PolicyName)
+		user.InlinePolicies[name] = aws.StringValue(in.PolicyDocument)
+	}
+}
+
+func (r UserRouter) UpdateAccessKey(q *Request, in *iam.UpdateAccessKeyInput) {
+	if user := r.get(in.UserName, q); user != nil {
+		id := aws.StringValue(in.AccessKeyId)
+		for _, k := range user.AccessKeys {
+			if aws.StringValue(k.AccessKeyId) == id {
+				k.Status = in.Status
+				return
+			}
+		}
+		panic("mock: invalid access key id: " + id)
+	}
+}
+
 func (r UserRouter) get(name *string, q *Request) *User {
 	if name == nil {
 		name = aws.String("")
@@ -137,12 +137,42 @@ func (r *ChainRouter) DataTypeRouter() (t DataTypeRouter) {
 	return
 }
 
+// GroupRouter returns the highest priority GroupRouter in the chain. A new
+// router is created if one does not exist.
+func (r *ChainRouter) GroupRouter() (t GroupRouter) {
+	if !r.Find(&t) {
+		t = GroupRouter{}
+		r.Add(t)
+	}
+	return
+}
+
+// InstanceProfileRouter returns the highest priority InstanceProfileRouter in
+// the chain. A new router is created if one does not exist.
+func (r *ChainRouter) InstanceProfileRouter() (t InstanceProfileRouter) {
+	if !r.Find(&t) {
+		t = InstanceProfileRouter{}
+		r.Add(t)
+	}
+	return
+}
+
 // OrgRouter returns the highest priority OrgRouter in the chain.
 func (r ChainRouter) OrgRouter() (t *OrgRouter) {
 	r.Find(&t)
 	return
 }
 
+// PolicyRouter returns the highest priority PolicyRouter in the chain. A new
+// router is created if one does not exist.
+func (r *ChainRouter) PolicyRouter() (t PolicyRouter) {
+	if !r.Find(&t) {
+		t = PolicyRouter{}
+		r.Add(t)
+	}
+	return
+}
+
 // RoleRouter returns the highest priority RoleRouter in the chain. A new router
 // is created if one does not exist.
 func (r *ChainRouter) RoleRouter() (t RoleRouter) {
@@ -153,6 +183,16 @@ func (r *ChainRouter) RoleRouter() (t RoleRouter) {
 	return
 }
 
+// SAMLProviderRouter returns the highest priority SAMLProviderRouter in the
+// chain. A new router is created if one does not exist.
+func (r *ChainRouter) SAMLProviderRouter() (t SAMLProviderRouter) {
+	if !r.Find(&t) {
+		t = SAMLProviderRouter{}
+		r.Add(t)
+	}
+	return
+}
+
 // STSRouter returns the highest priority STSRouter in the chain. A new router
 // is created if one does not exist.
 func (r *ChainRouter) STSRouter() (t STSRouter) {
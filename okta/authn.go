@@ -9,23 +9,14 @@ import (
 	"time"
 
 	"github.com/mxk/go-fast"
+	"github.com/mxk/oktapus/saml"
 )
 
-// Authenticator implements the user interface for multi-factor authentication.
-type Authenticator interface {
-	Username() (string, error)
-	Password() (string, error)
-	Select(c []Choice) (Choice, error)
-	Input(c Choice) (string, error)
-	Notify(format string, a ...interface{})
-}
-
-// Choice is a user-selectable item.
-type Choice interface {
-	Key() string
-	Value() string
-	Prompt() string
-}
+// Authenticator and Choice are shared by all SAML IdP implementations.
+type (
+	Authenticator = saml.Authenticator
+	Choice        = saml.Choice
+)
 
 // Factor is a factor object returned by MFA_ENROLL, MFA_REQUIRED, or
 // MFA_CHALLENGE authentication responses.
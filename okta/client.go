@@ -15,12 +15,13 @@ import (
 
 	"github.com/mxk/go-cloud/aws/arn"
 	"github.com/mxk/go-fast"
+	"github.com/mxk/oktapus/saml"
 )
 
 // ErrRateLimit is returned when too many requests are sent.
 var ErrRateLimit = errors.New("okta: request rate limit exceeded")
 
-// Client provides access to Okta API.
+// Client provides access to Okta API. It implements saml.IdP interface.
 type Client struct {
 	BaseURL url.URL
 	Client  *http.Client
@@ -104,7 +105,7 @@ func (c *Client) AppLinks() ([]*AppLink, error) {
 
 // OpenAWS returns SAML authentication data for the AWS app specified by
 // appLink. If roleARN is specified, the matching AWS role is pre-selected.
-func (c *Client) OpenAWS(appLink string, role arn.ARN) (*AWSAuth, error) {
+func (c *Client) OpenAWS(appLink string, role arn.ARN) (*saml.AWSAuth, error) {
 	ref, err := url.Parse(appLink)
 	if err != nil {
 		return nil, err
@@ -125,11 +126,11 @@ func (c *Client) OpenAWS(appLink string, role arn.ARN) (*AWSAuth, error) {
 		}
 		return nil, fmt.Errorf("okta: AWS app error (%s)", rsp.Status)
 	}
-	sa, err := samlAssertionFromHTML(rsp.Body)
+	sa, err := saml.FromHTML(rsp.Body)
 	if err != nil {
 		return nil, err
 	}
-	return newAWSAuth(sa, role)
+	return saml.NewAWSAuth(sa, role)
 }
 
 // createSession converts session token into a cookie.
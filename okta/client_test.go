@@ -3,6 +3,7 @@ package okta
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"testing"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/mxk/go-fast"
 	"github.com/mxk/oktapus/mock"
+	"github.com/mxk/oktapus/saml"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -126,14 +128,20 @@ func TestClientOpenAWS(t *testing.T) {
 	_, err = c.OpenAWS(links[0].LinkURL, "")
 	assert.Equal(t, ErrRateLimit, err)
 
+	assertion := saml.Assertion(`<Response><Assertion><AttributeStatement>
+<Attribute Name="https://aws.amazon.com/SAML/Attributes/Role">
+<AttributeValue>arn:aws:iam::000000000000:saml-provider/Okta,arn:aws:iam::000000000000:role/OktapusGateway</AttributeValue>
+</Attribute>
+</AttributeStatement></Assertion></Response>`)
 	s.Response[path] = func(w http.ResponseWriter, r *http.Request) {
-		w.Write(samlResponse(assertion).Bytes())
+		fmt.Fprintf(w, `<form><input name="SAMLResponse" type="hidden" value="%s"/></form>`,
+			assertion.Encode())
 	}
 	auth, err := c.OpenAWS(links[0].LinkURL, "")
 	require.NoError(t, err)
-	want := &AWSAuth{
+	want := &saml.AWSAuth{
 		Assertion: assertion,
-		Roles: []awsRole{{
+		Roles: []saml.AWSRole{{
 			Principal: "arn:aws:iam::000000000000:saml-provider/Okta",
 			Role:      "arn:aws:iam::000000000000:role/OktapusGateway",
 		}},
@@ -23,6 +23,13 @@ const (
 
 	// ErrCtlUpdate indicates that account control information was not saved.
 	ErrCtlUpdate = Error("account control update interrupted")
+
+	// ErrCtlTooLong indicates that encoded account control information does
+	// not fit in the IAM role description.
+	ErrCtlTooLong = Error("account control information too long")
+
+	// ErrNotAdmin indicates that the user is not an account admin.
+	ErrNotAdmin = Error("permission denied (not an account admin)")
 )
 
 // Flags contains account state flags.
@@ -56,14 +63,20 @@ func (f Flags) CtlValid() bool { return f&CtlFlag != 0 }
 type Account struct {
 	Flags
 
-	ID   string
-	Name string
-	IAM  iamx.Client
-	Ctl  Ctl
-	Err  error
+	ID      string
+	Name    string
+	Gateway string
+	IAM     iamx.Client
+	Ctl     Ctl
+	Err     error
+
+	// Alias file overrides for account access
+	Role       string
+	ExternalID string
 
-	ref Ctl
-	key sortKey
+	ref   Ctl
+	key   sortKey
+	owner string // Owner tag of the current credentials
 }
 
 // NewAccount returns a new account with the given id and name.
@@ -9,24 +9,26 @@ import (
 	"strings"
 
 	"github.com/mxk/oktapus/okta"
+	"github.com/mxk/oktapus/saml"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
-// termAuthn uses the terminal for Okta authentication.
+// termAuthn uses the terminal for IdP authentication.
 type termAuthn struct {
+	idp  string
 	user string
 	r    io.Reader
 	w    io.Writer
 }
 
-func newTermAuthn(user string) *termAuthn {
-	return &termAuthn{user: user, r: os.Stdin, w: os.Stderr}
+func newTermAuthn(idp, user string) *termAuthn {
+	return &termAuthn{idp: idp, user: user, r: os.Stdin, w: os.Stderr}
 }
 
-// Username prompts the user for their Okta username.
+// Username prompts the user for their IdP username.
 func (t *termAuthn) Username() (string, error) {
 	for t.user == "" {
-		t.println("Okta username: ")
+		t.print(t.idp, " username: ")
 		user, err := readLine(t.r)
 		if err != nil {
 			return "", err
@@ -36,14 +38,14 @@ func (t *termAuthn) Username() (string, error) {
 	return t.user, nil
 }
 
-// Password prompts the user for their Okta password.
+// Password prompts the user for their IdP password.
 func (t *termAuthn) Password() (string, error) {
-	t.printf("Okta password for %q: ", t.user)
+	t.printf("%s password for %q: ", t.idp, t.user)
 	return t.readSecure("PASSWORD")
 }
 
 // Select asks the user to choose one of the options from a menu.
-func (t *termAuthn) Select(all []okta.Choice) (okta.Choice, error) {
+func (t *termAuthn) Select(all []saml.Choice) (saml.Choice, error) {
 	prompt := "Your choice? "
 	switch c := all[0].(type) {
 	case *okta.Factor:
@@ -72,7 +74,7 @@ func (t *termAuthn) Select(all []okta.Choice) (okta.Choice, error) {
 }
 
 // Input asks the user to respond to an MFA challenge.
-func (t *termAuthn) Input(c okta.Choice) (string, error) {
+func (t *termAuthn) Input(c saml.Choice) (string, error) {
 	if p := c.Prompt(); strings.HasSuffix(p, "?") {
 		t.print(p, " ")
 	} else {
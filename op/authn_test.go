@@ -5,13 +5,14 @@ import (
 	"testing"
 
 	"github.com/mxk/oktapus/okta"
+	"github.com/mxk/oktapus/saml"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestAuthn(t *testing.T) {
 	var r, w bytes.Buffer
-	authn := newTermAuthn("")
+	authn := newTermAuthn("Okta", "")
 	authn.r, authn.w = &r, &w
 
 	r.WriteString("user\n")
@@ -25,7 +26,7 @@ func TestAuthn(t *testing.T) {
 	assert.Equal(t, "pass", pass)
 
 	r.WriteString("2\n")
-	choice := []okta.Choice{
+	choice := []saml.Choice{
 		&okta.Factor{
 			ID:         "1",
 			FactorType: "token:software:totp",
@@ -0,0 +1,242 @@
+package op
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/mxk/go-cloud/aws/awsx"
+	"github.com/mxk/go-cloud/aws/iamx"
+	"github.com/mxk/oktapus/creds"
+	"github.com/pkg/errors"
+)
+
+// OrgAccessRole is the role that AWS Organizations creates in new accounts. It
+// is used to inspect accounts that the gateway cannot access.
+const OrgAccessRole = "OrganizationAccountAccessRole"
+
+// Access failure causes reported by Diagnose.
+const (
+	CauseGatewayPolicy = "gateway policy"
+	CauseGatewaySCP    = "gateway SCP"
+	CauseNoRole        = "role not found"
+	CauseTrustPolicy   = "trust policy"
+	CauseRoleAccess    = "role or trust policy"
+	CauseRolePolicy    = "role permissions"
+	CauseTargetPolicy  = "target account policy"
+	CauseIdP           = "IdP role mapping"
+	CauseOther         = "other"
+)
+
+// Diagnosis explains an account access failure.
+type Diagnosis struct {
+	Role   arn.ARN
+	Cause  string
+	Detail string
+	Advice string
+}
+
+// Diagnose attempts to determine why access to account ac failed. It returns
+// nil if the account credentials and control information are valid. The checks
+// are best-effort: the gateway policy is evaluated with
+// iam:SimulatePrincipalPolicy and, if the gateway has organization access,
+// the account role is inspected via OrgAccessRole.
+func (c *Ctx) Diagnose(ac *Account) *Diagnosis {
+	c.requireInit()
+	g := c
+	for _, p := range c.peers {
+		if p.acs[ac.ID] == ac {
+			g = p
+		}
+	}
+	d := &Diagnosis{Role: g.accountRole(ac.ID)}
+	cp := ac.CredsProvider()
+	if _, err := cp.Creds(); err != nil {
+		// Cached errors may have lost their type, so get a new one
+		if err = cp.Ensure(-1); err != nil {
+			g.diagnoseCreds(d, ac, errors.Cause(err))
+			return d
+		}
+		ac.Set(CredsFlag)
+		ac.Err = nil
+	}
+	if err := ac.Err; awsx.StatusCode(err) == http.StatusForbidden {
+		d.Cause = CauseRolePolicy
+		d.Detail = g.decodeError(err)
+		d.Advice = "Role " + string(d.Role) + " can be assumed, but it " +
+			"does not allow access to account control information. Attach " +
+			"IAM read/write permissions to the role (e.g. run 'oktapus authz' " +
+			"again from an account that has access)."
+		return d
+	}
+	return nil
+}
+
+// diagnoseCreds determines why role credentials for account ac could not be
+// obtained.
+func (c *Ctx) diagnoseCreds(d *Diagnosis, ac *Account, err error) {
+	d.Detail = c.decodeError(err)
+	if awsx.ErrCode(err) != "AccessDenied" {
+		d.Cause = CauseOther
+		return
+	}
+	if c.mode == SAML {
+		d.Cause = CauseIdP
+		d.Advice = "Ask the IdP administrator to grant role " + string(d.Role) +
+			" or check that the role trusts the SAML provider."
+		return
+	}
+
+	pr := c.principal()
+	authz := fmt.Sprintf("Run 'oktapus authz %s %s' from an account that has "+
+		"access.", ac.ID, pr)
+
+	// Gateway policy
+	if r, err := c.simulate(pr, d.Role); err == nil && r != nil {
+		if o := r.OrganizationsDecisionDetail; o != nil &&
+			o.AllowedByOrganizations != nil && !*o.AllowedByOrganizations {
+			d.Cause = CauseGatewaySCP
+			d.Advice = "A service control policy denies sts:AssumeRole in " +
+				"gateway account " + c.proxy.Ident.Account + ". Ask the " +
+				"organization administrator to allow it."
+			return
+		}
+		if r.EvalDecision != iam.PolicyEvaluationDecisionTypeAllowed {
+			d.Cause = CauseGatewayPolicy
+			d.Advice = fmt.Sprintf("Gateway policy decision is %q. Allow "+
+				"sts:AssumeRole on %s for %s.", r.EvalDecision, d.Role, pr)
+			return
+		}
+	}
+
+	// Target account role
+	role, err := c.probeRole(ac.ID, d.Role)
+	switch {
+	case err != nil:
+		d.Cause = CauseRoleAccess
+		d.Advice = "The role may not exist or may not trust the gateway. " +
+			authz
+	case role == nil:
+		d.Cause = CauseNoRole
+		d.Advice = authz
+	case !c.trusted(role, pr):
+		d.Cause = CauseTrustPolicy
+		d.Advice = "The role exists, but its trust policy does not allow " +
+			string(pr) + ". " + authz
+	default:
+		d.Cause = CauseTargetPolicy
+		d.Advice = "The role exists and trusts the gateway. Check for a " +
+			"service control policy in account " + ac.ID + " or an external " +
+			"ID mismatch."
+	}
+}
+
+// principal returns the ARN of the gateway IAM user or role.
+func (c *Ctx) principal() arn.ARN {
+	id := c.proxy.Ident
+	if id.Type() != "assumed-role" {
+		return id.ARN
+	}
+	name := strings.Split(id.Resource(), "/")[1] // assumed-role/name/sess
+	role := c.proxy.Role(id.Account, name)
+	in := &iam.GetRoleInput{RoleName: aws.String(name)}
+	if out, err := iam.New(c.cfg).GetRoleRequest(in).Send(); err == nil {
+		role = arn.Value(out.Role.Arn)
+	}
+	return role
+}
+
+// simulate evaluates whether the policies of gateway principal pr allow
+// sts:AssumeRole on the specified role.
+func (c *Ctx) simulate(pr, role arn.ARN) (*iam.EvaluationResult, error) {
+	in := &iam.SimulatePrincipalPolicyInput{
+		ActionNames:     []string{"sts:AssumeRole"},
+		PolicySourceArn: arn.String(pr),
+		ResourceArns:    []string{string(role)},
+	}
+	out, err := iam.New(c.cfg).SimulatePrincipalPolicyRequest(in).Send()
+	if err != nil || len(out.EvaluationResults) == 0 {
+		return nil, err
+	}
+	return &out.EvaluationResults[0], nil
+}
+
+// probeRole uses the organization access role to get the specified role from
+// the target account. It returns nil if the role does not exist.
+func (c *Ctx) probeRole(accountID string, role arn.ARN) (*iam.Role, error) {
+	if c.dir.Org.ID == "" {
+		return nil, ErrNoAccess
+	}
+	p := creds.Proxy{
+		Client:   creds.NewClient(&c.dir.Client.Config),
+		Ident:    c.proxy.Ident,
+		SessName: c.proxy.SessName,
+	}
+	cfg := c.cfg.Copy()
+	cfg.Credentials = p.AssumeRole(p.Role(accountID, OrgAccessRole), 0)
+	in := &iam.GetRoleInput{RoleName: aws.String(role.Name())}
+	out, err := iam.New(cfg).GetRoleRequest(in).Send()
+	if err != nil {
+		if awsx.ErrCode(err) == iam.ErrCodeNoSuchEntityException {
+			err = nil
+		}
+		return nil, err
+	}
+	return out.Role, nil
+}
+
+// trusted returns true if an Allow statement in the trust policy of role names
+// gateway principal pr or its account as an AWS principal. Deny statements,
+// NotPrincipal, and conditions are not evaluated.
+func (c *Ctx) trusted(role *iam.Role, pr arn.ARN) bool {
+	pol, err := iamx.ParsePolicy(role.AssumeRolePolicyDocument)
+	if err != nil {
+		return false
+	}
+	acct := c.proxy.Ident.Account
+	root := "arn:" + pr.Partition() + ":iam::" + acct + ":root"
+	for _, s := range pol.Statement {
+		if s.Effect != iamx.Allow || s.Principal == nil {
+			continue
+		}
+		if s.Principal.Any {
+			return true
+		}
+		for _, id := range s.Principal.AWS {
+			if id == string(pr) || id == acct || id == root || id == "*" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// encodedMsg matches encoded authorization failure messages.
+var encodedMsg = regexp.MustCompile(
+	`Encoded authorization failure message: ([\w-]+)`)
+
+// decodeError returns the error message. Encoded authorization failure
+// messages are decoded via sts:DecodeAuthorizationMessage, if allowed.
+func (c *Ctx) decodeError(err error) string {
+	msg := err.Error()
+	e, ok := err.(awserr.Error)
+	if !ok {
+		return msg
+	}
+	m := encodedMsg.FindStringSubmatch(e.Message())
+	if m == nil {
+		return msg
+	}
+	in := &sts.DecodeAuthorizationMessageInput{EncodedMessage: aws.String(m[1])}
+	out, err := c.proxy.Client.DecodeAuthorizationMessageRequest(in).Send()
+	if err != nil {
+		return msg
+	}
+	return aws.StringValue(out.DecodedMessage)
+}
@@ -0,0 +1,97 @@
+package op
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/mxk/oktapus/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnose(t *testing.T) {
+	w := mock.NewAWS(mock.Ctx,
+		mock.NewOrg(mock.Ctx, "master", "test1", "test2", "test3"))
+	for id := range w.Root().OrgRouter().Accounts {
+		*w.Account(id) = mock.ChainRouter{mock.RoleRouter{}}
+	}
+	deny := mock.RouterFunc(func(q *mock.Request) bool {
+		switch in := q.Params.(type) {
+		case *sts.AssumeRoleInput:
+			role := arn.Value(in.RoleArn)
+			if role.Name() == "alice" && role.Account() != mock.Ctx.Account {
+				err := awserr.New("AccessDenied", "access denied", nil)
+				q.Error = awserr.NewRequestFailure(err, http.StatusForbidden, "")
+				return true
+			}
+		case *iam.SimulatePrincipalPolicyInput:
+			d := iam.PolicyEvaluationDecisionTypeAllowed
+			if arn.ARN(in.ResourceArns[0]).Account() == "000000000003" {
+				d = iam.PolicyEvaluationDecisionTypeImplicitDeny
+			}
+			out := q.Data.(*iam.SimulatePrincipalPolicyOutput)
+			out.EvaluationResults = []iam.EvaluationResult{{EvalDecision: d}}
+			return true
+		}
+		return false
+	})
+	w.Root().Add(deny)
+	trust := `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123456789012:root"}}]}`
+	w.Account("2").RoleRouter()["alice"] = &mock.Role{Role: iam.Role{
+		Arn:                      aws.String("arn:aws:iam::000000000002:role/oktapus/alice"),
+		AssumeRolePolicyDocument: aws.String(url.QueryEscape(trust)),
+		Path:                     aws.String(IAMPath),
+		RoleName:                 aws.String("alice"),
+	}}
+
+	ctx := NewCtx()
+	require.NoError(t, ctx.Init(&w.Cfg))
+	acs, err := ctx.Match("all")
+	require.NoError(t, err)
+	causes := make(map[string]string)
+	for _, ac := range acs.EnsureCreds(0) {
+		if d := ctx.Diagnose(ac); d != nil {
+			causes[ac.ID] = d.Cause
+			assert.Equal(t, ctx.accountRole(ac.ID), d.Role)
+			assert.NotEmpty(t, d.Advice)
+		} else {
+			causes[ac.ID] = ""
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"000000000000": "",
+		"000000000001": CauseNoRole,
+		"000000000002": CauseTrustPolicy,
+		"000000000003": CauseGatewayPolicy,
+	}, causes)
+}
+
+func TestTrusted(t *testing.T) {
+	var c Ctx
+	c.proxy.Ident.Account = "000000000000"
+	pr := arn.ARN("arn:aws:iam::000000000000:user/alice")
+	tests := []*struct {
+		doc  string
+		want bool
+	}{
+		{`{"Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::000000000000:user/alice"}}]}`, true},
+		{`{"Statement":[{"Effect":"Allow","Principal":{"AWS":["arn:aws:iam::000000000000:root"]}}]}`, true},
+		{`{"Statement":[{"Effect":"Allow","Principal":{"AWS":"000000000000"}}]}`, true},
+		{`{"Statement":[{"Effect":"Allow","Principal":"*"}]}`, true},
+		{`{"Statement":[{"Effect":"Deny","Principal":{"AWS":"arn:aws:iam::000000000000:user/alice"}}]}`, false},
+		{`{"Statement":[{"Effect":"Allow","NotPrincipal":{"AWS":"arn:aws:iam::000000000000:root"}}]}`, false},
+		{`{"Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123456789012:root"},"Condition":{"StringEquals":{"aws:PrincipalArn":"arn:aws:iam::000000000000:user/alice"}}}]}`, false},
+		{`{"Statement":[{"Effect":"Allow","Principal":{"Federated":"000000000000"}}]}`, false},
+		{`not a policy`, false},
+	}
+	for _, tc := range tests {
+		role := &iam.Role{AssumeRolePolicyDocument: aws.String(url.QueryEscape(tc.doc))}
+		assert.Equal(t, tc.want, c.trusted(role, pr), "%s", tc.doc)
+	}
+}
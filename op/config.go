@@ -0,0 +1,176 @@
+package op
+
+import (
+	"os"
+	"sort"
+	"time"
+
+	"github.com/mxk/oktapus/toml"
+	"github.com/pkg/errors"
+)
+
+// DefaultProfile is the config profile that is used if one is not selected
+// explicitly.
+const DefaultProfile = "default"
+
+// LoadConfig applies context settings from ConfigFile. Top-level keys apply to
+// all profiles. Profile keys are specified in "[profile.<name>]" tables and
+// override top-level ones. It is not an error for the file or the default
+// profile to be missing, unless ConfigProfile was set explicitly.
+func (c *Ctx) LoadConfig() error {
+	c.requireLocal()
+	if c.ConfigFile == "" {
+		return nil
+	}
+	t, err := toml.Load(c.ConfigFile)
+	if err != nil {
+		if os.IsNotExist(err) && c.ConfigProfile == "" {
+			return nil
+		}
+		return errors.Wrap(err, "failed to load config")
+	}
+	profiles := t.Table("profile")
+	if profiles == nil && t["profile"] != nil {
+		return errors.Errorf("invalid config: profile must be a table (%s)",
+			c.ConfigFile)
+	}
+	delete(t, "profile")
+	if err = t.Decode(c); err != nil {
+		return errors.Wrapf(err, "invalid config (%s)", c.ConfigFile)
+	}
+	name := c.ConfigProfile
+	if name == "" {
+		name = DefaultProfile
+	}
+	p, ok := profiles[name].(toml.Table)
+	if !ok {
+		if c.ConfigProfile == "" && profiles[name] == nil {
+			return nil
+		}
+		return errors.Errorf("profile %q not found in %s", name, c.ConfigFile)
+	}
+	return errors.Wrapf(p.Decode(c), "invalid profile %q (%s)", name,
+		c.ConfigFile)
+}
+
+// loadGateways creates a context for each additional gateway in Gateways,
+// enabling aggregate mode. Each entry is the name of another config profile,
+// which is also used to label its accounts. Environment variables only apply to
+// the primary context.
+func (c *Ctx) loadGateways() error {
+	if len(c.Gateways) == 0 {
+		return nil
+	}
+	c.label = c.ConfigProfile
+	if c.label == "" {
+		c.label = DefaultProfile
+	}
+	seen := map[string]bool{c.label: true}
+	for _, name := range c.Gateways {
+		if seen[name] {
+			return errors.Errorf("duplicate gateway %q", name)
+		}
+		seen[name] = true
+		p := newEnvCtx(name)
+		p.ConfigFile = c.ConfigFile
+		if err := p.LoadConfig(); err != nil {
+			return errors.Wrapf(err, "gateway %q", name)
+		}
+		p.Gateways = nil
+		p.label = name
+		c.peers = append(c.peers, p)
+	}
+	return nil
+}
+
+// parseSessionDuration validates SessionDuration and TagSessionDuration.
+func (c *Ctx) parseSessionDuration() error {
+	if c.SessionDuration != "" {
+		d, err := time.ParseDuration(c.SessionDuration)
+		if err != nil || d < 0 {
+			return errors.Errorf("invalid %s: %q", SessionDurationEnv,
+				c.SessionDuration)
+		}
+		c.dur = d
+	}
+	for tag, d := range c.TagSessionDuration {
+		if d < 0 {
+			return errors.Errorf("invalid session duration for tag %q", tag)
+		}
+	}
+	return nil
+}
+
+// sessionDuration returns the role session duration for the specified account.
+// If any account tags have a session duration, the longest one is used.
+// Otherwise, the global setting applies. Zero means the default duration.
+func (c *Ctx) sessionDuration(accountID string) time.Duration {
+	if ac := c.acs[accountID]; ac != nil && len(c.TagSessionDuration) > 0 {
+		d, ok := time.Duration(0), false
+		for _, tag := range ac.Ctl.Tags {
+			if td, match := c.TagSessionDuration[tag]; match {
+				if ok = true; td > d {
+					d = td
+				}
+			}
+		}
+		if ok {
+			return d
+		}
+	}
+	return c.dur
+}
+
+// Hooks are external commands that are run with account credentials when an
+// account with a matching tag is allocated or freed. Each command is an array
+// containing the program name followed by its arguments.
+type Hooks struct {
+	PostAlloc map[string][]string `toml:"post_alloc"`
+	PreFree   map[string][]string `toml:"pre_free"`
+}
+
+// validate ensures that all hook commands are non-empty.
+func (h *Hooks) validate() error {
+	for kind, hooks := range map[string]map[string][]string{
+		"post_alloc": h.PostAlloc,
+		"pre_free":   h.PreFree,
+	} {
+		for tag, cmd := range hooks {
+			if len(cmd) == 0 || cmd[0] == "" {
+				return errors.Errorf("invalid %s hook for tag %q", kind, tag)
+			}
+		}
+	}
+	return nil
+}
+
+// HookCmds returns the commands from hooks that apply to an account with the
+// specified tags, ordered by tag.
+func HookCmds(hooks map[string][]string, tags Tags) [][]string {
+	var cmds [][]string
+	if len(hooks) > 0 {
+		for _, tag := range tags {
+			if cmd, ok := hooks[tag]; ok {
+				cmds = append(cmds, cmd)
+			}
+		}
+	}
+	return cmds
+}
+
+// UserTeams returns the sorted names of all teams that user is a member of.
+func (c *Ctx) UserTeams(user string) []string {
+	var teams []string
+	if user != "" {
+		for team, members := range c.Teams {
+			for _, m := range members {
+				if m == user {
+					teams = append(teams, team)
+					break
+				}
+			}
+		}
+		sort.Strings(teams)
+	}
+	return teams
+}
@@ -0,0 +1,223 @@
+package op
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mxk/oktapus/daemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "config_test.")
+	require.NoError(t, err)
+	defer func() {
+		tmp.Close()
+		assert.NoError(t, os.Remove(tmp.Name()))
+	}()
+	tmp.WriteString(`
+common_role = "/oktapus/common"
+okta_username = "alice"
+admins = ["alice"]
+
+[hooks.pre_free]
+sandbox = ["empty-buckets", "--all"]
+
+[teams]
+infra = ["alice", "bob"]
+
+[profile.default]
+aws_profile = "prod"
+okta_org = "prod.okta.com"
+
+[profile.sandbox]
+aws_profile = "sandbox"
+daemon = "localhost:12345"
+alias_file = "/tmp/sandbox.accounts"
+master_role = "/oktapus/proxy"
+okta_org = "sandbox.okta.com"
+okta_aws_app_url = "https://sandbox.okta.com/home/amazon_aws/x/272"
+okta_aws_role = "arn:aws:iam::000000000000:role/Admin"
+
+[profile.sandbox.hooks.post_alloc]
+sandbox = ["baseline.sh"]
+
+[profile.broken]
+common = "x"
+`)
+	require.NoError(t, tmp.Close())
+
+	c := NewCtx()
+	c.ConfigFile = tmp.Name()
+	require.NoError(t, c.LoadConfig())
+	assert.Equal(t, "/oktapus/common", c.CommonRole)
+	assert.Equal(t, "alice", c.OktaUser)
+	assert.Equal(t, "prod", c.Profile)
+	assert.Equal(t, "prod.okta.com", c.OktaHost)
+
+	c = NewCtx()
+	c.ConfigFile = tmp.Name()
+	c.ConfigProfile = "sandbox"
+	require.NoError(t, c.LoadConfig())
+	want := &Ctx{
+		ConfigFile:    tmp.Name(),
+		ConfigProfile: "sandbox",
+		Daemon:        daemon.Addr("localhost:12345"),
+		AliasFile:     "/tmp/sandbox.accounts",
+		Profile:       "sandbox",
+		MasterRole:    "/oktapus/proxy",
+		CommonRole:    "/oktapus/common",
+		OktaHost:      "sandbox.okta.com",
+		OktaUser:      "alice",
+		OktaAWSApp:    "https://sandbox.okta.com/home/amazon_aws/x/272",
+		OktaAWSRole:   "arn:aws:iam::000000000000:role/Admin",
+		Hooks: Hooks{
+			PostAlloc: map[string][]string{"sandbox": {"baseline.sh"}},
+			PreFree:   map[string][]string{"sandbox": {"empty-buckets", "--all"}},
+		},
+		Teams:  map[string][]string{"infra": {"alice", "bob"}},
+		Admins: []string{"alice"},
+		local:  true,
+	}
+	assert.Equal(t, want, c)
+
+	c.ConfigProfile = "none"
+	assert.EqualError(t, c.LoadConfig(),
+		`profile "none" not found in `+tmp.Name())
+
+	c.ConfigProfile = "broken"
+	assert.EqualError(t, c.LoadConfig(),
+		`invalid profile "broken" (`+tmp.Name()+`): toml: unknown key "common"`)
+
+	c.ConfigFile = tmp.Name() + ".none"
+	c.ConfigProfile = ""
+	assert.NoError(t, c.LoadConfig())
+	c.ConfigProfile = "sandbox"
+	assert.Error(t, c.LoadConfig())
+}
+
+func TestLoadGateways(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "config_test.")
+	require.NoError(t, err)
+	defer func() {
+		tmp.Close()
+		assert.NoError(t, os.Remove(tmp.Name()))
+	}()
+	tmp.WriteString(`
+gateways = ["sandbox", "labs"]
+[profile.default]
+aws_profile = "prod"
+[profile.sandbox]
+aws_profile = "sandbox"
+[profile.labs]
+aws_profile = "labs"
+[profile.dup]
+gateways = ["labs", "labs"]
+`)
+	require.NoError(t, tmp.Close())
+
+	c := NewCtx()
+	c.ConfigFile = tmp.Name()
+	require.NoError(t, c.LoadConfig())
+	require.NoError(t, c.loadGateways())
+	assert.Equal(t, "default", c.label)
+	require.Len(t, c.peers, 2)
+	for i, name := range []string{"sandbox", "labs"} {
+		p := c.peers[i]
+		assert.Equal(t, name, p.label)
+		assert.Equal(t, name, p.ConfigProfile)
+		assert.Equal(t, name, p.Profile)
+		assert.Nil(t, p.Gateways)
+	}
+
+	c = NewCtx()
+	c.ConfigFile = tmp.Name()
+	c.ConfigProfile = "dup"
+	require.NoError(t, c.LoadConfig())
+	assert.EqualError(t, c.loadGateways(), `duplicate gateway "labs"`)
+}
+
+func TestEnvCtx(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "config_test.")
+	require.NoError(t, err)
+	defer func() {
+		tmp.Close()
+		assert.NoError(t, os.Remove(tmp.Name()))
+	}()
+	tmp.WriteString("[profile.test]\ncommon_role = 'file'\nmaster_role = 'file'\n")
+	require.NoError(t, tmp.Close())
+
+	env := map[string]string{
+		ConfigFileEnv:    tmp.Name(),
+		ConfigProfileEnv: "test",
+		CommonRoleEnv:    "env",
+	}
+	for k, v := range env {
+		if old, ok := os.LookupEnv(k); ok {
+			defer os.Setenv(k, old)
+		} else {
+			defer os.Unsetenv(k)
+		}
+		os.Setenv(k, v)
+	}
+	c, err := EnvCtx()
+	require.NoError(t, err)
+	assert.Equal(t, "test", c.ConfigProfile)
+	assert.Equal(t, "env", c.CommonRole)
+	assert.Equal(t, "file", c.MasterRole)
+}
+
+func TestHooks(t *testing.T) {
+	h := Hooks{PreFree: map[string][]string{
+		"a": {"cmd1"},
+		"c": {"cmd2", "arg"},
+	}}
+	require.NoError(t, h.validate())
+	assert.Nil(t, HookCmds(h.PostAlloc, Tags{"a"}))
+	assert.Nil(t, HookCmds(h.PreFree, Tags{"b"}))
+	assert.Equal(t, [][]string{{"cmd1"}, {"cmd2", "arg"}},
+		HookCmds(h.PreFree, Tags{"a", "b", "c"}))
+
+	h.PostAlloc = map[string][]string{"b": {}}
+	assert.EqualError(t, h.validate(), `invalid post_alloc hook for tag "b"`)
+}
+
+func TestUserTeams(t *testing.T) {
+	c := NewCtx()
+	assert.Nil(t, c.UserTeams("alice"))
+	c.Teams = map[string][]string{
+		"infra": {"alice", "bob"},
+		"dev":   {"bob"},
+		"ops":   {"alice"},
+	}
+	assert.Equal(t, []string{"infra", "ops"}, c.UserTeams("alice"))
+	assert.Equal(t, []string{"dev", "infra"}, c.UserTeams("bob"))
+	assert.Nil(t, c.UserTeams("carol"))
+	assert.Nil(t, c.UserTeams(""))
+}
+
+func TestSessionDuration(t *testing.T) {
+	c := NewCtx()
+	c.SessionDuration = "2h"
+	c.TagSessionDuration = map[string]time.Duration{
+		"prod": time.Hour,
+		"long": 8 * time.Hour,
+	}
+	require.NoError(t, c.parseSessionDuration())
+	c.acs = map[string]*Account{
+		"000000000001": {Ctl: Ctl{Tags: Tags{"test"}}},
+		"000000000002": {Ctl: Ctl{Tags: Tags{"prod"}}},
+		"000000000003": {Ctl: Ctl{Tags: Tags{"long", "prod"}}},
+	}
+	assert.Equal(t, 2*time.Hour, c.sessionDuration("000000000000"))
+	assert.Equal(t, 2*time.Hour, c.sessionDuration("000000000001"))
+	assert.Equal(t, time.Hour, c.sessionDuration("000000000002"))
+	assert.Equal(t, 8*time.Hour, c.sessionDuration("000000000003"))
+
+	c.SessionDuration = "2"
+	assert.EqualError(t, c.parseSessionDuration(),
+		`invalid OKTAPUS_SESSION_DURATION: "2"`)
+}
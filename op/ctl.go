@@ -4,8 +4,11 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
@@ -20,10 +23,93 @@ const CtlRole = "OktapusAccountControl"
 // Ctl contains account control information.
 type Ctl struct {
 	Owner string `json:"owner,omitempty"`
+	Team  string `json:"team,omitempty"`
 	Desc  string `json:"desc,omitempty"`
 	Tags  Tags   `json:"tags,omitempty"`
+	Maint string `json:"maint,omitempty"`
+
+	// Users allowed to allocate the account for others and to free or
+	// transfer it without being the owner (see IsAdmin)
+	Admins []string `json:"admins,omitempty"`
+
+	// Ownership transfer audit information (see Chown)
+	PrevOwner string `json:"prev,omitempty"`
+	ChownTime int64  `json:"chown,omitempty"`
+}
+
+// Chown transfers account ownership to owner, recording the previous owner and
+// the time of transfer. Team ownership is not transferred.
+func (ctl *Ctl) Chown(owner string, t time.Time) {
+	ctl.PrevOwner, ctl.Owner, ctl.Team = ctl.Owner, owner, ""
+	ctl.ChownTime = t.Unix()
+}
+
+// OwnedBy returns true if the account is owned by user or by one of the
+// specified teams.
+func (ctl *Ctl) OwnedBy(user string, teams []string) bool {
+	if ctl.Owner == "" {
+		return false
+	} else if ctl.Owner == user {
+		return true
+	}
+	return ctl.Team != "" && hasString(teams, ctl.Team)
+}
+
+// IsAdmin returns true if user is an account admin. Accounts without an admins
+// list are administered by orgAdmins. If neither list exists, everyone is an
+// admin. Admin checks are performed by the client, so they protect against
+// mistakes rather than malicious users, who can modify control information
+// directly.
+func (ctl *Ctl) IsAdmin(user string, orgAdmins []string) bool {
+	if user == "" {
+		return false
+	} else if len(ctl.Admins) > 0 {
+		return hasString(ctl.Admins, user)
+	} else if len(orgAdmins) > 0 {
+		return hasString(orgAdmins, user)
+	}
+	return true
+}
+
+// SetAdmins sets the account admins list, removing empty and duplicate names.
+func (ctl *Ctl) SetAdmins(names []string) {
+	var admins []string
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			admins = append(admins, name)
+		}
+	}
+	sort.Strings(admins)
+	ctl.Admins = nil
+	for i, name := range admins {
+		if i == 0 || name != admins[i-1] {
+			ctl.Admins = append(ctl.Admins, name)
+		}
+	}
+}
+
+// MaxMaintLen is the maximum length of the maintenance reason. It leaves room for
+// other control information, but only Encode enforces the total size limit.
+const MaxMaintLen = 128
+
+// SetMaint puts the account into maintenance with the specified reason or takes
+// it out of maintenance if the reason is empty. Accounts in maintenance cannot
+// be allocated. Long reasons are truncated to MaxMaintLen bytes.
+func (ctl *Ctl) SetMaint(reason string) {
+	reason = strings.Join(strings.Fields(reason), " ")
+	if len(reason) > MaxMaintLen {
+		i := MaxMaintLen - 3
+		for i > 0 && !utf8.RuneStart(reason[i]) {
+			i--
+		}
+		reason = reason[:i] + "..."
+	}
+	ctl.Maint = reason
 }
 
+// InMaint returns true if the account is in maintenance.
+func (ctl *Ctl) InMaint() bool { return ctl.Maint != "" }
+
 // Init creates account control information in an uncontrolled account.
 func (ctl *Ctl) Init(c iamx.Client) error {
 	return ctl.exec(c, func(c iamx.Client, b64 string) (*iam.Role, error) {
@@ -77,21 +163,46 @@ func (ctl *Ctl) Store(c iamx.Client) error {
 	})
 }
 
-const ctlVer = "1#"
+// Control information versions. Version 2 adds fields that version 1 clients
+// would drop when storing changes, so it is only used when one of them is set.
+// Version 1 clients refuse to modify version 2 control information.
+const (
+	ctlVer1 = "1#"
+	ctlVer  = "2#"
+)
+
+// maxCtlLen is the maximum length of encoded control information, which is
+// limited by the IAM role description.
+const maxCtlLen = 1000
 
-// Encode encodes account control information into a base64 string.
+// Encode encodes account control information into a base64 string. It returns
+// ErrCtlTooLong if the result does not fit in the IAM role description.
 func (ctl *Ctl) Encode() (string, error) {
 	ctl.Tags.Sort()
 	b, err := json.Marshal(ctl)
 	if err != nil {
 		return "", err
 	}
+	ver := ctlVer1
+	if ctl.isV2() {
+		ver = ctlVer
+	}
 	enc := base64.StdEncoding
-	b64 := make([]byte, len(ctlVer)+enc.EncodedLen(len(b)))
-	enc.Encode(b64[copy(b64, ctlVer):], b)
+	n := len(ver) + enc.EncodedLen(len(b))
+	if n > maxCtlLen {
+		return "", ErrCtlTooLong
+	}
+	b64 := make([]byte, n)
+	enc.Encode(b64[copy(b64, ver):], b)
 	return string(b64), nil
 }
 
+// isV2 returns true if ctl has fields that require version 2 encoding.
+func (ctl *Ctl) isV2() bool {
+	return ctl.Team != "" || ctl.Maint != "" || len(ctl.Admins) > 0 ||
+		ctl.PrevOwner != "" || ctl.ChownTime != 0
+}
+
 // Decode decodes account control information from a base64 string.
 func (ctl *Ctl) Decode(b64 string) error {
 	if *ctl = (Ctl{}); b64 == "" {
@@ -105,7 +216,7 @@ func (ctl *Ctl) Decode(b64 string) error {
 	}
 	b, err := base64.StdEncoding.DecodeString(b64)
 	if err == nil {
-		if ver == 1 {
+		if ver == 1 || ver == 2 {
 			if err = json.Unmarshal(b, ctl); err != nil {
 				*ctl = Ctl{}
 			}
@@ -120,8 +231,11 @@ func (ctl *Ctl) Decode(b64 string) error {
 // eq returns true if ctl == other.
 func (ctl *Ctl) eq(other *Ctl) bool {
 	return ctl == other || (ctl != nil && other != nil &&
-		ctl.Owner == other.Owner && ctl.Desc == other.Desc &&
-		ctl.Tags.eq(other.Tags))
+		ctl.Owner == other.Owner && ctl.Team == other.Team &&
+		ctl.Desc == other.Desc && ctl.Maint == other.Maint &&
+		ctl.PrevOwner == other.PrevOwner &&
+		ctl.ChownTime == other.ChownTime && ctl.Tags.eq(other.Tags) &&
+		stringsEq(ctl.Admins, other.Admins))
 }
 
 // copy performs a deep copy of other to ctl.
@@ -133,6 +247,7 @@ func (ctl *Ctl) copy(other *Ctl) {
 		tags := append(ctl.Tags[:0], other.Tags...)
 		*ctl = *other
 		ctl.Tags = tags
+		ctl.Admins = append([]string(nil), other.Admins...)
 	}
 }
 
@@ -145,14 +260,50 @@ func (ctl *Ctl) merge(cur, ref *Ctl) {
 	if ctl.Owner == ref.Owner {
 		ctl.Owner = cur.Owner
 	}
+	if ctl.Team == ref.Team {
+		ctl.Team = cur.Team
+	}
 	if ctl.Desc == ref.Desc {
 		ctl.Desc = cur.Desc
 	}
+	if ctl.Maint == ref.Maint {
+		ctl.Maint = cur.Maint
+	}
+	if ctl.PrevOwner == ref.PrevOwner && ctl.ChownTime == ref.ChownTime {
+		ctl.PrevOwner, ctl.ChownTime = cur.PrevOwner, cur.ChownTime
+	}
+	if stringsEq(ctl.Admins, ref.Admins) {
+		ctl.Admins = append([]string(nil), cur.Admins...)
+	}
 	set, clr := ctl.Tags.Diff(ref.Tags)
 	ctl.Tags = append(ctl.Tags[:0], cur.Tags...)
 	ctl.Tags.Apply(set, clr)
 }
 
+// hasString returns true if v contains s.
+func hasString(v []string, s string) bool {
+	for _, e := range v {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// stringsEq returns true if a and b contain the same strings in the same
+// order.
+func stringsEq(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // exec executes init or set operations.
 func (ctl *Ctl) exec(c iamx.Client, fn func(c iamx.Client, b64 string) (*iam.Role, error)) error {
 	b64, err := ctl.Encode()
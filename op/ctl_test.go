@@ -1,7 +1,10 @@
 package op
 
 import (
+	"encoding/base64"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/aws/awserr"
@@ -52,6 +55,11 @@ func TestCtl(t *testing.T) {
 	c.desc = aws.String("abc=")
 	assert.Error(t, get.Load(c.iam))
 	assert.Equal(t, Ctl{}, get)
+
+	set = Ctl{Owner: "alice", Desc: strings.Repeat("x", maxCtlLen)}
+	_, err := set.Encode()
+	assert.Equal(t, ErrCtlTooLong, err)
+	assert.Equal(t, ErrCtlTooLong, set.Store(c.iam))
 }
 
 func TestCtlEq(t *testing.T) {
@@ -62,8 +70,18 @@ func TestCtlEq(t *testing.T) {
 		{Ctl{}, Ctl{}, true},
 		{Ctl{Owner: "a"}, Ctl{}, false},
 		{Ctl{Owner: "a"}, Ctl{Owner: "a"}, true},
+		{Ctl{Team: "t"}, Ctl{}, false},
+		{Ctl{Team: "t"}, Ctl{Team: "t"}, true},
+		{Ctl{Admins: []string{"a"}}, Ctl{}, false},
+		{Ctl{Admins: []string{"a"}}, Ctl{Admins: []string{"b"}}, false},
+		{Ctl{Admins: []string{"a"}}, Ctl{Admins: []string{"a"}}, true},
 		{Ctl{Desc: "b"}, Ctl{}, false},
 		{Ctl{Desc: "b"}, Ctl{Desc: "b"}, true},
+		{Ctl{Maint: "m"}, Ctl{}, false},
+		{Ctl{Maint: "m"}, Ctl{Maint: "m"}, true},
+		{Ctl{PrevOwner: "p"}, Ctl{}, false},
+		{Ctl{ChownTime: 1}, Ctl{}, false},
+		{Ctl{PrevOwner: "p", ChownTime: 1}, Ctl{PrevOwner: "p", ChownTime: 1}, true},
 		{Ctl{Tags: Tags{"c"}}, Ctl{}, false},
 		{Ctl{Tags: Tags{"c"}}, Ctl{Tags: Tags{"c"}}, true},
 		{Ctl{Tags: Tags{"c", "d"}}, Ctl{Tags: Tags{"c"}}, false},
@@ -114,6 +132,36 @@ func TestCtlMerge(t *testing.T) {
 		cur:  Ctl{Desc: "d"},
 		ref:  Ctl{Desc: "c"},
 		want: Ctl{Desc: "d"},
+	}, {
+		ctl:  Ctl{Maint: "a"},
+		cur:  Ctl{Maint: "b"},
+		ref:  Ctl{},
+		want: Ctl{Maint: "a"},
+	}, {
+		ctl:  Ctl{Maint: "a"},
+		cur:  Ctl{},
+		ref:  Ctl{Maint: "a"},
+		want: Ctl{},
+	}, {
+		ctl:  Ctl{Team: "a"},
+		cur:  Ctl{Team: "b"},
+		ref:  Ctl{},
+		want: Ctl{Team: "a"},
+	}, {
+		ctl:  Ctl{Team: "a"},
+		cur:  Ctl{Team: "b"},
+		ref:  Ctl{Team: "a"},
+		want: Ctl{Team: "b"},
+	}, {
+		ctl:  Ctl{Admins: []string{"a"}},
+		cur:  Ctl{Admins: []string{"b"}},
+		ref:  Ctl{},
+		want: Ctl{Admins: []string{"a"}},
+	}, {
+		ctl:  Ctl{Admins: []string{"a"}},
+		cur:  Ctl{Admins: []string{"b"}},
+		ref:  Ctl{Admins: []string{"a"}},
+		want: Ctl{Admins: []string{"b"}},
 	}, {
 		ctl:  Ctl{Tags: Tags{"a"}},
 		cur:  Ctl{Tags: Tags{"b", "c"}},
@@ -126,6 +174,96 @@ func TestCtlMerge(t *testing.T) {
 	}
 }
 
+func TestCtlMaint(t *testing.T) {
+	var ctl Ctl
+	assert.False(t, ctl.InMaint())
+	ctl.SetMaint(" cleanup\n failed ")
+	assert.True(t, ctl.InMaint())
+	assert.Equal(t, "cleanup failed", ctl.Maint)
+	ctl.SetMaint(strings.Repeat("x", MaxMaintLen-1) + "\u00e9")
+	assert.Equal(t, strings.Repeat("x", MaxMaintLen-3)+"...", ctl.Maint)
+	ctl.SetMaint("")
+	assert.False(t, ctl.InMaint())
+}
+
+func TestCtlVersion(t *testing.T) {
+	ctl := Ctl{Owner: "alice", Tags: Tags{"a"}}
+	b64, err := ctl.Encode()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(b64, ctlVer1), "%s", b64)
+	var get Ctl
+	require.NoError(t, get.Decode(b64))
+	assert.Equal(t, ctl, get)
+
+	for _, ctl := range []Ctl{
+		{Team: "infra"},
+		{Maint: "broken"},
+		{Admins: []string{"bob"}},
+		{PrevOwner: "bob", ChownTime: 1},
+	} {
+		b64, err := ctl.Encode()
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(b64, ctlVer), "%s", b64)
+		require.NoError(t, get.Decode(b64))
+		assert.Equal(t, ctl, get)
+	}
+	assert.Error(t, get.Decode("3#e30="))
+
+	// Control information written by older clients is stored unchanged
+	old := ctlVer1 + base64.StdEncoding.EncodeToString(
+		[]byte(`{"owner":"alice","desc":"d","tags":["a"]}`))
+	require.NoError(t, get.Decode(old))
+	b64, err = get.Encode()
+	require.NoError(t, err)
+	assert.Equal(t, old, b64)
+}
+
+func TestCtlChown(t *testing.T) {
+	ctl := Ctl{Owner: "alice"}
+	ctl.Chown("bob", time.Unix(1000, 0))
+	assert.Equal(t, Ctl{Owner: "bob", PrevOwner: "alice", ChownTime: 1000}, ctl)
+
+	cur := Ctl{Owner: "alice", Desc: "x"}
+	ref := Ctl{Owner: "alice"}
+	ctl.merge(&cur, &ref)
+	assert.Equal(t, Ctl{Owner: "bob", Desc: "x", PrevOwner: "alice",
+		ChownTime: 1000}, ctl)
+}
+
+func TestCtlTeam(t *testing.T) {
+	ctl := Ctl{Owner: "alice", Team: "infra"}
+	assert.True(t, ctl.OwnedBy("alice", nil))
+	assert.True(t, ctl.OwnedBy("bob", []string{"dev", "infra"}))
+	assert.False(t, ctl.OwnedBy("bob", []string{"dev"}))
+	ctl.Chown("carol", time.Unix(1000, 0))
+	assert.Equal(t, "", ctl.Team)
+	assert.False(t, ctl.OwnedBy("bob", []string{"infra"}))
+	ctl = Ctl{Team: "infra"}
+	assert.False(t, ctl.OwnedBy("bob", []string{"infra"}))
+}
+
+func TestCtlAdmins(t *testing.T) {
+	var ctl Ctl
+	org := []string{"carol"}
+	assert.True(t, ctl.IsAdmin("alice", nil))
+	assert.False(t, ctl.IsAdmin("alice", org))
+	assert.True(t, ctl.IsAdmin("carol", org))
+	assert.False(t, ctl.IsAdmin("", []string{""}))
+	ctl.SetAdmins([]string{"bob", " alice", "", "bob"})
+	assert.Equal(t, []string{"alice", "bob"}, ctl.Admins)
+	assert.True(t, ctl.IsAdmin("alice", org))
+	assert.False(t, ctl.IsAdmin("carol", org))
+	ctl.SetAdmins([]string{""})
+	assert.Nil(t, ctl.Admins)
+	assert.True(t, ctl.IsAdmin("carol", org))
+
+	ctl.Admins = []string{"a"}
+	var cpy Ctl
+	cpy.copy(&ctl)
+	cpy.Admins[0] = "b"
+	assert.Equal(t, []string{"a"}, ctl.Admins)
+}
+
 func TestCtlAlias(t *testing.T) {
 	ctl := Ctl{Tags: Tags{"a", "b", "c"}}
 	cur := Ctl{}
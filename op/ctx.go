@@ -11,6 +11,8 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -25,12 +27,14 @@ import (
 	"github.com/mxk/oktapus/creds"
 	"github.com/mxk/oktapus/daemon"
 	"github.com/mxk/oktapus/okta"
+	"github.com/mxk/oktapus/saml"
 	"github.com/pkg/errors"
 )
 
 func init() {
 	gob.Register((*GetCtx)(nil))
 	gob.Register((*SavedCtx)(nil))
+	gob.Register((*DelCtx)(nil))
 	gob.Register(Error(""))
 }
 
@@ -40,6 +44,10 @@ const (
 	IAMTmpPath = IAMPath + "tmp/"
 )
 
+// IAMTmpPrefix is the name prefix of temporary IAM entities that do not have a
+// path, such as SAML providers.
+const IAMTmpPrefix = "oktapus-tmp-"
+
 // cmd is a CLI command that requires a context.
 type cmd interface {
 	cli.Cmd
@@ -54,8 +62,18 @@ type printCmd interface {
 
 // Run executes the specified command with a local context.
 func Run(c cmd) (interface{}, error) {
-	ctx := EnvCtx()
-	if err := ctx.Init(nil); err != nil {
+	ctx, err := EnvCtx()
+	if err != nil {
+		return nil, err
+	}
+	return run(ctx, nil, c)
+}
+
+// run initializes ctx for command c and executes it. The action must be set
+// before Init because it becomes a session tag of all assumed roles.
+func run(ctx *Ctx, cfg *aws.Config, c cmd) (interface{}, error) {
+	ctx.action = c.Info().PrimaryName()
+	if err := ctx.Init(cfg); err != nil {
 		return nil, err
 	}
 	out, err := c.Run(ctx)
@@ -79,12 +97,34 @@ func RunAndPrint(c printCmd) error {
 type AuthMode int
 
 const (
-	Unknown AuthMode = iota // Context not initialized
-	IAM                     // IAM user access key
-	STS                     // STS session (single-account mode)
-	Okta                    // Okta-federated IAM role
+	Unknown     AuthMode = iota // Context not initialized
+	IAM                         // IAM user access key
+	STS                         // STS session (single-account mode)
+	Okta                        // SAML-federated IAM role (Okta or other IdP)
+	WebIdentity                 // OIDC-federated IAM role (CI runners)
+	SAML                        // SAML-federated IAM roles without a gateway
 )
 
+var authModeNames = [...]string{
+	Unknown:     "Unknown",
+	IAM:         "IAM",
+	STS:         "STS",
+	Okta:        "Okta",
+	WebIdentity: "WebIdentity",
+	SAML:        "SAML",
+}
+
+// String implements fmt.Stringer.
+func (m AuthMode) String() string {
+	if 0 <= m && int(m) < len(authModeNames) {
+		return authModeNames[m]
+	}
+	return "AuthMode(" + strconv.Itoa(int(m)) + ")"
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (m AuthMode) MarshalText() ([]byte, error) { return []byte(m.String()), nil }
+
 // Ver identifies the version of a type sent over a gob stream.
 type Ver int
 
@@ -93,7 +133,7 @@ func (v Ver) Version() Ver { return v }
 
 // CtxVer identifies Ctx and SavedCtx struct versions. It should be incremented
 // for any incompatible changes to force the daemon to restart.
-const CtxVer = Ver(1)
+const CtxVer = Ver(3)
 
 // GetCtx is a daemon message requesting the context with the specified
 // signature. The daemon either sends the matching *SavedCtx or closes the
@@ -103,6 +143,13 @@ type GetCtx struct {
 	Sig string
 }
 
+// DelCtx is a daemon message requesting removal of the context with the
+// specified signature.
+type DelCtx struct {
+	Ver
+	Sig string
+}
+
 // Error is an error type that can be encoded by gob.
 type Error string
 
@@ -112,17 +159,38 @@ func (e Error) Error() string { return string(e) }
 // Oktapus environment variables. Okta variables use same names as:
 // https://github.com/oktadeveloper/okta-aws-cli-assume-role/
 const (
-	DaemonEnv     = "OKTAPUS_DAEMON"
-	SecretFileEnv = "OKTAPUS_SECRET_FILE"
-	AliasFileEnv  = "OKTAPUS_ALIAS_FILE"
-	ProfileEnv    = "OKTAPUS_AWS_PROFILE"
-	MasterRoleEnv = "OKTAPUS_MASTER_ROLE"
-	CommonRoleEnv = "OKTAPUS_COMMON_ROLE"
-
-	OktaHostEnv    = "OKTA_ORG"
-	OktaUserEnv    = "OKTA_USERNAME"
-	OktaAWSAppEnv  = "OKTA_AWS_APP_URL"
-	OktaAWSRoleEnv = "OKTA_AWS_ROLE_TO_ASSUME"
+	ConfigFileEnv    = "OKTAPUS_CONFIG_FILE"
+	ConfigProfileEnv = "OKTAPUS_PROFILE"
+
+	DaemonEnv          = "OKTAPUS_DAEMON"
+	SecretFileEnv      = "OKTAPUS_SECRET_FILE"
+	AliasFileEnv       = "OKTAPUS_ALIAS_FILE"
+	ProfileEnv         = "OKTAPUS_AWS_PROFILE"
+	MasterRoleEnv      = "OKTAPUS_MASTER_ROLE"
+	CommonRoleEnv      = "OKTAPUS_COMMON_ROLE"
+	SessionDurationEnv = "OKTAPUS_SESSION_DURATION"
+	SessionTagsEnv     = "OKTAPUS_SESSION_TAGS"
+	SourceIdentityEnv  = "OKTAPUS_SOURCE_IDENTITY"
+	MFASerialEnv       = "OKTAPUS_MFA_SERIAL"
+	KeyMaxAgeEnv       = "OKTAPUS_KEY_MAX_AGE"
+
+	OktaHostEnv        = "OKTA_ORG"
+	OktaUserEnv        = "OKTA_USERNAME"
+	OktaAWSAppEnv      = "OKTA_AWS_APP_URL"
+	OktaAWSRoleEnv     = "OKTA_AWS_ROLE_TO_ASSUME"
+	OktaAWSDurationEnv = "OKTA_AWS_SESSION_DURATION"
+
+	SAMLAppURLEnv = "OKTAPUS_SAML_APP_URL"
+	SAMLUserEnv   = "OKTAPUS_SAML_USERNAME"
+	SAMLRoleEnv   = "OKTAPUS_SAML_ROLE"
+	SAMLDirectEnv = "OKTAPUS_SAML_DIRECT"
+
+	SAMLCertEnv     = "OKTAPUS_SAML_CERT"
+	SAMLMetadataEnv = "OKTAPUS_SAML_METADATA"
+
+	WebIdentityTokenFileEnv = "AWS_WEB_IDENTITY_TOKEN_FILE"
+	RoleARNEnv              = "AWS_ROLE_ARN"
+	RoleSessionNameEnv      = "AWS_ROLE_SESSION_NAME"
 )
 
 // Ctx provides global config information and account access. A context can be
@@ -131,49 +199,113 @@ const (
 // functions. Non-local contexts, maintained by the daemon, are only allowed to
 // make API calls to keep account credentials and control information current.
 type Ctx struct {
+	// Config file and the selected profile
+	ConfigFile    string
+	ConfigProfile string
+
+	// Additional gateway profiles (aggregate mode)
+	Gateways []string `toml:"gateways"`
+
 	// Oktapus environment config
-	Daemon     daemon.Addr `env:"OKTAPUS_DAEMON"`
-	SecretFile string      `env:"OKTAPUS_SECRET_FILE"`
-	AliasFile  string      `env:"OKTAPUS_ALIAS_FILE"`
-	Profile    string      `env:"OKTAPUS_AWS_PROFILE"`
-	MasterRole string      `env:"OKTAPUS_MASTER_ROLE"`
-	CommonRole string      `env:"OKTAPUS_COMMON_ROLE"`
+	Daemon          daemon.Addr `env:"OKTAPUS_DAEMON" toml:"daemon"`
+	SecretFile      string      `env:"OKTAPUS_SECRET_FILE" toml:"secret_file"`
+	AliasFile       string      `env:"OKTAPUS_ALIAS_FILE" toml:"alias_file"`
+	Profile         string      `env:"OKTAPUS_AWS_PROFILE" toml:"aws_profile"`
+	MasterRole      string      `env:"OKTAPUS_MASTER_ROLE" toml:"master_role"`
+	CommonRole      string      `env:"OKTAPUS_COMMON_ROLE" toml:"common_role"`
+	SessionDuration string      `env:"OKTAPUS_SESSION_DURATION" toml:"session_duration"`
+	SessionTags     bool        `env:"OKTAPUS_SESSION_TAGS" toml:"session_tags"`
+	SourceIdentity  bool        `env:"OKTAPUS_SOURCE_IDENTITY" toml:"source_identity"`
+	MFASerial       string      `env:"OKTAPUS_MFA_SERIAL" toml:"mfa_serial"`
+	KeyMaxAge       string      `env:"OKTAPUS_KEY_MAX_AGE" toml:"key_max_age"`
+
+	// Account role session durations by tag (overrides SessionDuration)
+	TagSessionDuration map[string]time.Duration `toml:"tag_session_duration"`
+
+	// External commands run for accounts with matching tags
+	Hooks Hooks `toml:"hooks"`
+
+	// Team names mapped to member names (see Ctl.Team)
+	Teams map[string][]string `toml:"teams"`
+
+	// Organization admins for accounts without an admins list (see Ctl.IsAdmin)
+	Admins []string `toml:"admins"`
 
 	// Okta environment config
-	OktaHost    string `env:"OKTA_ORG"`
-	OktaUser    string `env:"OKTA_USERNAME"`
-	OktaAWSApp  string `env:"OKTA_AWS_APP_URL"`
-	OktaAWSRole string `env:"OKTA_AWS_ROLE_TO_ASSUME"`
+	OktaHost        string `env:"OKTA_ORG" toml:"okta_org"`
+	OktaUser        string `env:"OKTA_USERNAME" toml:"okta_username"`
+	OktaAWSApp      string `env:"OKTA_AWS_APP_URL" toml:"okta_aws_app_url"`
+	OktaAWSRole     string `env:"OKTA_AWS_ROLE_TO_ASSUME" toml:"okta_aws_role"`
+	OktaAWSDuration string `env:"OKTA_AWS_SESSION_DURATION" toml:"okta_aws_session_duration"`
+
+	// Generic SAML IdP config (used if OktaHost is not set)
+	SAMLAppURL string `env:"OKTAPUS_SAML_APP_URL" toml:"saml_app_url"`
+	SAMLUser   string `env:"OKTAPUS_SAML_USERNAME" toml:"saml_username"`
+	SAMLRole   string `env:"OKTAPUS_SAML_ROLE" toml:"saml_role"`
+	SAMLDirect bool   `env:"OKTAPUS_SAML_DIRECT" toml:"saml_direct"`
+
+	// SAML assertion signature verification (Okta or generic IdP)
+	SAMLCert     string `env:"OKTAPUS_SAML_CERT" toml:"saml_cert"`
+	SAMLMetadata string `env:"OKTAPUS_SAML_METADATA" toml:"saml_metadata"`
 
 	// AWS environment config
-	EnvCfg external.EnvConfig
+	EnvCfg               external.EnvConfig
+	WebIdentityTokenFile string `env:"AWS_WEB_IDENTITY_TOKEN_FILE" toml:"web_identity_token_file"`
+	WebIdentityRole      string `env:"AWS_ROLE_ARN" toml:"role_arn"`
+	WebIdentitySessName  string `env:"AWS_ROLE_SESSION_NAME" toml:"role_session_name"`
 
 	local  bool
+	cached bool
 	secret string
+	dur    time.Duration
+	action string
+	iamKey *creds.Provider
 	mode   AuthMode
-	okta   *okta.Client
+	idp    saml.IdP
+	sso    *samlAuth
 	cfg    aws.Config
 	proxy  creds.Proxy
 	dir    account.Directory
 	role   arn.ARN
 	creds  map[string]*creds.Provider
 	acs    map[string]*Account
+	label  string
+	peers  []*Ctx
 }
 
 // NewCtx returns an empty local context.
 func NewCtx() *Ctx { return &Ctx{local: true} }
 
-// EnvCtx returns a local context populated from the environment variables.
-func EnvCtx() *Ctx {
+// EnvCtx returns a local context populated from the config file and
+// environment variables. Environment variables override config file values.
+func EnvCtx() (*Ctx, error) {
+	c := newEnvCtx(os.Getenv(ConfigProfileEnv))
+	if err := c.LoadConfig(); err != nil {
+		return nil, err
+	}
+	if err := c.loadGateways(); err != nil {
+		return nil, err
+	}
+	if err := cli.SetEnvFields(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// newEnvCtx returns a local context with default settings for the specified
+// config profile.
+func newEnvCtx(profile string) *Ctx {
 	awsDir := filepath.Dir(external.DefaultSharedConfigFiles[0])
 	c := &Ctx{
-		Daemon:     daemon.DefaultAddr,
-		SecretFile: filepath.Join(awsDir, "oktapus.secret"),
-		AliasFile:  filepath.Join(awsDir, "oktapus.accounts"),
-		local:      true,
+		ConfigFile:    filepath.Join(awsDir, "oktapus.toml"),
+		ConfigProfile: profile,
+		Daemon:        daemon.DefaultAddr,
+		SecretFile:    filepath.Join(awsDir, "oktapus.secret"),
+		AliasFile:     filepath.Join(awsDir, "oktapus.accounts"),
+		local:         true,
 	}
-	if err := cli.SetEnvFields(c); err != nil {
-		panic(err)
+	if file, ok := os.LookupEnv(ConfigFileEnv); ok {
+		c.ConfigFile = file
 	}
 	c.EnvCfg, _ = external.NewEnvConfig()
 	return c
@@ -188,33 +320,56 @@ func (c *Ctx) Init(cfg *aws.Config) error {
 	if err := c.loadSecret(); err != nil {
 		return err
 	}
+	if err := c.parseSessionDuration(); err != nil {
+		return err
+	}
+	if err := c.Hooks.validate(); err != nil {
+		return err
+	}
 	if err := c.resolveCfg(cfg); err != nil {
 		return err
 	}
 	if err, ok := c.restoreState(); err != nil {
 		return err
-	} else if !ok {
-		if c.mode == Okta {
-			if err := c.oktaAuth(); err != nil {
+	} else if c.cached = ok; !ok {
+		if c.idp != nil {
+			if err := c.idpAuth(); err != nil {
+				return err
+			}
+		} else if c.iamKey != nil {
+			if _, err := c.cfg.Credentials.Retrieve(); err != nil {
 				return err
 			}
 		}
 		c.newClients()
-		err := fast.Call(c.proxy.Init, c.dir.Init)
+		fns := []func() error{c.proxy.Init, c.dir.Init}
+		if c.mode == SAML {
+			fns = fns[:1] // No organization access without a gateway
+		}
+		err := fast.Call(fns...)
 		if err != nil && !account.IsErrorNoOrg(err) {
 			return errors.Wrap(err, "client init failed")
 		}
 		c.setCommonRole()
 	}
+	c.setSessionAttrs()
 	c.setMasterCreds()
+	for _, p := range c.peers {
+		if p.mode == Unknown {
+			p.action = c.action
+			if err := p.Init(nil); err != nil {
+				return errors.Wrapf(err, "gateway %q", p.label)
+			}
+		}
+	}
 	return nil
 }
 
 // AuthMode returns the context authentication mode.
 func (c *Ctx) AuthMode() AuthMode { return c.mode }
 
-// Okta returns the Okta client if the current AuthMode is Okta.
-func (c *Ctx) Okta() *okta.Client { return c.okta }
+// IdP returns the SAML IdP client if the current AuthMode is Okta or SAML.
+func (c *Ctx) IdP() saml.IdP { return c.idp }
 
 // Cfg returns the active AWS client config.
 func (c *Ctx) Cfg() aws.Config { return c.cfg }
@@ -232,44 +387,69 @@ func (c *Ctx) Role() arn.ARN { return c.role }
 func (c *Ctx) Save() *SavedCtx { return newSavedCtx(c) }
 
 // Refresh updates the list of known accounts from the alias file and/or AWS
-// Organizations API.
+// Organizations API. In SAML mode, accounts come from the SAML assertion. In
+// aggregate mode, accounts of all gateways are refreshed.
 func (c *Ctx) Refresh() error {
 	c.requireInit()
 	c.requireLocal()
+	if err := c.refresh(); err != nil {
+		return err
+	}
+	for _, p := range c.peers {
+		if err := p.refresh(); err != nil {
+			return errors.Wrapf(err, "gateway %q", p.label)
+		}
+	}
+	return nil
+}
+
+// refresh updates the list of accounts known to the current gateway.
+func (c *Ctx) refresh() error {
 	// TODO: Handle STS single-account and EC2 instance role modes
-	// TODO: Allow using "-" in alias file to remove org accounts?
 	// TODO: Reuse accounts?
 	c.acs = make(map[string]*Account)
+	var m map[string]account.Alias
 	set := func(ac *Account, id, name string) *Account {
+		a := m[id]
 		ac.ID = id
 		ac.Name = name
+		ac.Role = a.Role
+		ac.ExternalID = a.ExternalID
 		return ac
 	}
 	if c.AliasFile != "" {
-		m, err := account.LoadAliases(c.AliasFile, c.proxy.Ident.Partition())
+		var err error
+		m, err = account.LoadAliases(c.AliasFile, c.proxy.Ident.Partition())
 		if err != nil {
 			if !os.IsNotExist(err) {
 				return errors.Wrap(err, "failed to load account aliases")
 			}
-		} else if len(m) > 0 {
+		} else if len(m) > 0 && c.mode != SAML {
 			i, acs := 0, make([]Account, len(m))
-			for id, name := range m {
-				set(&acs[i], id, name)
-				i++
+			for id, a := range m {
+				if !a.Hidden() {
+					set(&acs[i], id, a.Name)
+					i++
+				}
 			}
-			c.Register(initAccounts(acs))
+			c.Register(initAccounts(acs[:i]))
 		}
 	}
+	if c.mode == SAML {
+		return c.refreshSAML(m)
+	}
 	if err := c.dir.Refresh(); err != nil && !account.IsErrorNoOrg(err) {
 		return errors.Wrap(err, "failed to refresh accounts")
 	}
 	if len(c.dir.Accounts) > 0 {
 		i, acs := 0, make([]Account, len(c.dir.Accounts))
 		for _, info := range c.dir.Accounts {
-			set(&acs[i], info.ID, info.Name).Set(OrgFlag)
-			i++
+			if a, ok := m[info.ID]; !ok || !a.Hidden() {
+				set(&acs[i], info.ID, info.Name).Set(OrgFlag)
+				i++
+			}
 		}
-		c.Register(initAccounts(acs))
+		c.Register(initAccounts(acs[:i]))
 	}
 	if c.acs[c.proxy.Ident.Account] == nil {
 		// TODO: Add implicit proxy account
@@ -293,50 +473,101 @@ func (c *Ctx) Register(acs Accounts) Accounts {
 		if !account.IsID(ac.ID) {
 			panic("op: invalid account id: " + ac.ID)
 		}
+		ac.Gateway = c.label
 		ac.IAM = iamx.New(&c.cfg)
-		creds.Set(ac.IAM.Client, c.CredsProvider(ac.ID))
 		c.acs[ac.ID] = ac
+		creds.Set(ac.IAM.Client, c.CredsProvider(ac.ID))
 	}
 	return acs
 }
 
-// Accounts returns all registered accounts sorted by name.
+// Accounts returns all registered accounts sorted by name. In aggregate mode,
+// accounts of all gateways are returned. If the same account is known to
+// multiple gateways, the first gateway in the config takes precedence.
 func (c *Ctx) Accounts() Accounts {
 	c.requireInit()
-	if len(c.acs) == 0 {
+	n := len(c.acs)
+	for _, p := range c.peers {
+		n += len(p.acs)
+	}
+	if n == 0 {
 		return nil
 	}
-	i, acs := 0, make(Accounts, len(c.acs))
-	for _, ac := range c.acs {
-		acs[i] = ac
-		i++
+	acs := make(Accounts, 0, n)
+	if len(c.peers) == 0 {
+		for _, ac := range c.acs {
+			acs = append(acs, ac)
+		}
+		return acs.SortByName()
+	}
+	seen := make(map[string]struct{}, n)
+	for _, g := range c.group() {
+		for id, ac := range g.acs {
+			if _, dup := seen[id]; !dup {
+				seen[id] = struct{}{}
+				acs = append(acs, ac)
+			}
+		}
 	}
 	return acs.SortByName()
 }
 
 // Match returns all accounts that match the spec.
 func (c *Ctx) Match(spec string) (Accounts, error) {
-	if c.acs == nil && c.local {
-		if err := c.Refresh(); err != nil {
-			return nil, err
+	if c.local {
+		for _, g := range c.group() {
+			if g.acs == nil {
+				if err := c.Refresh(); err != nil {
+					return nil, err
+				}
+				break
+			}
 		}
 	}
 	all := c.Accounts().LoadCtl(false)
-	return ParseAccountSpec(spec, c.role.Name()).Filter(all)
+	me := c.role.Name()
+	return ParseAccountSpec(spec, me, c.UserTeams(me)...).Filter(all)
 }
 
 // CredsProvider returns a credentials provider for the specified account ID.
+// The common role is used unless the account has a role override from the
+// alias file. In SAML mode, the role is assumed with the SAML assertion.
+// Otherwise, session duration and tags are determined each time the credentials
+// are renewed.
 func (c *Ctx) CredsProvider(accountID string) *creds.Provider {
 	c.requireInit()
 	cp := c.creds[accountID]
 	if cp != nil {
 		return cp
 	}
-	cp = c.proxy.AssumeRole(c.proxy.Role(accountID, c.CommonRole), 0)
+	if c.acs[accountID] == nil {
+		for _, p := range c.peers {
+			if p.acs[accountID] != nil {
+				return p.CredsProvider(accountID)
+			}
+		}
+	}
+	role := c.accountRole(accountID)
+	if c.mode == SAML {
+		cp = c.sso.provider(role, func() time.Duration {
+			return c.sessionDuration(accountID)
+		})
+	} else {
+		in := &sts.AssumeRoleInput{
+			RoleArn:         arn.String(role),
+			RoleSessionName: aws.String(c.proxy.SessName),
+		}
+		if ac := c.acs[accountID]; ac != nil && ac.ExternalID != "" {
+			in.ExternalId = aws.String(ac.ExternalID)
+		}
+		cp = c.proxy.SessionProvider(in, func() creds.Session {
+			return c.session(accountID)
+		})
+	}
 
 	// For the gateway account, try to assume the common role first, but fall
 	// back to original creds if that role does not exist.
-	if accountID == c.proxy.Ident.Account {
+	if accountID == c.proxy.Ident.Account && c.mode != SAML {
 		commonRole := cp
 		proxyCreds := c.cfg.Credentials.(*creds.Provider)
 		var src *creds.Provider
@@ -359,6 +590,17 @@ func (c *Ctx) CredsProvider(accountID string) *creds.Provider {
 	return cp
 }
 
+// accountRole returns the ARN of the role that is used to access the specified
+// account. The common role is used unless the account has a role override from
+// the alias file.
+func (c *Ctx) accountRole(accountID string) arn.ARN {
+	role := c.CommonRole
+	if ac := c.acs[accountID]; ac != nil && ac.Role != "" {
+		role = ac.Role
+	}
+	return c.proxy.Role(accountID, role)
+}
+
 // MasterExternalID derives the external id for the master role.
 func (c *Ctx) MasterExternalID() *string {
 	c.requireInit()
@@ -377,6 +619,12 @@ func (c *Ctx) MasterExternalID() *string {
 	return aws.String(hex.EncodeToString(b))
 }
 
+// group returns the current context followed by the contexts of all additional
+// gateways.
+func (c *Ctx) group() []*Ctx {
+	return append([]*Ctx{c}, c.peers...)
+}
+
 // requireInit panics if the context was not initialized.
 func (c *Ctx) requireInit() {
 	if c.mode == Unknown {
@@ -443,13 +691,20 @@ func (c *Ctx) resolveCfg(cfg *aws.Config) error {
 		c.cfg = *cfg
 	}
 
+	// Web identity tokens take priority over shared config credentials
+	if !c.federated() && c.WebIdentityTokenFile != "" {
+		return c.webIdentityCfg()
+	}
+
 	// Ensure that c.cfg.Credentials is a *creds.Provider and detect creds type
-	if c.OktaHost == "" {
+	if !c.federated() {
 		cp := creds.WrapProvider(c.cfg.Credentials)
 		c.cfg.Credentials = cp
 		cr, err := cp.Creds()
 		if err == nil && iamx.Is(cr.AccessKeyID, iamx.UserKey) {
-			c.mode = IAM
+			if c.mode = IAM; c.MFASerial != "" {
+				c.mfaCfg()
+			}
 		} else {
 			// TODO: How to handle EC2 instance role creds?
 			c.mode = STS
@@ -457,59 +712,37 @@ func (c *Ctx) resolveCfg(cfg *aws.Config) error {
 		return nil
 	}
 
-	// Create Okta client and *creds.Provider
-	if c.OktaUser == "" {
-		return errors.New(OktaUserEnv + " not set")
-	}
-	if c.OktaAWSApp == "" {
-		return errors.New(OktaAWSAppEnv + " not set")
-	}
-	c.okta = okta.NewClient(c.OktaHost)
-	stsc := sts.New(c.cfg)
-	creds.Set(stsc.Client, aws.AnonymousCredentials)
-	c.cfg.Credentials = creds.RenewableProvider(func() (cr aws.Credentials, err error) {
-		auth, err := c.okta.OpenAWS(c.OktaAWSApp, arn.ARN(c.OktaAWSRole))
-		if err != nil {
-			return
-		}
-		r := auth.Roles[0]
-		if part := r.Role.Partition(); part != region.Partition(c.cfg.Region) {
-			err = errors.Errorf("invalid region %q for %q partition",
-				c.cfg.Region, part)
-			return
-		}
-		in := sts.AssumeRoleWithSAMLInput{
-			PrincipalArn:  arn.String(r.Principal),
-			RoleArn:       arn.String(r.Role),
-			SAMLAssertion: aws.String(auth.Assertion.Encode()),
-		}
-		out, err := stsc.AssumeRoleWithSAMLRequest(&in).Send()
-		if err == nil {
-			cr = creds.FromSTS(out.Credentials)
-			cr.Source = "Okta"
-		}
-		return
-	})
-	c.mode = Okta
-	return nil
+	return c.idpCfg()
 }
 
-// oktaAuth performs Okta authentication and validates AWS app selection.
-func (c *Ctx) oktaAuth() error {
-	c.requireLocal()
-	if err := c.okta.Authenticate(newTermAuthn(c.OktaUser)); err != nil {
-		return errors.Wrap(err, "Okta authentication failed")
-	}
-	apps, err := c.okta.AppLinks()
-	if err != nil {
-		return errors.Wrap(err, "failed to get Okta apps")
-	}
-	for _, app := range apps {
-		if app.LinkURL == c.OktaAWSApp && app.AppName == "amazon_aws" {
-			return nil
-		}
-	}
-	return errors.Errorf("AWS app not found: %s", c.OktaAWSApp)
+// federated returns true if a SAML IdP is configured.
+func (c *Ctx) federated() bool {
+	return c.OktaHost != "" || c.SAMLAppURL != ""
+}
+
+// webIdentityCfg configures the context to use a web identity token file for
+// gateway credentials.
+func (c *Ctx) webIdentityCfg() error {
+	role := arn.ARN(c.WebIdentityRole)
+	if role == "" {
+		return errors.New(RoleARNEnv + " not set")
+	} else if !role.Valid() || role.Type() != "role" {
+		return errors.Errorf("invalid %s: %q", RoleARNEnv, role)
+	}
+	if part := role.Partition(); part != region.Partition(c.cfg.Region) {
+		return errors.Errorf("invalid region %q for %q partition",
+			c.cfg.Region, part)
+	}
+	sessName := c.WebIdentitySessName
+	if sessName == "" {
+		sessName = "oktapus"
+	}
+	stsc := creds.NewClient(&c.cfg)
+	creds.Set(stsc.Client, aws.AnonymousCredentials)
+	c.cfg.Credentials = stsc.WebIdentityProvider(role, sessName,
+		c.WebIdentityTokenFile)
+	c.mode = WebIdentity
+	return nil
 }
 
 // newClients creates new AWS service clients.
@@ -550,6 +783,11 @@ func (c *Ctx) saveState() error {
 	if c.Daemon == "" || !c.local {
 		return nil
 	}
+	for _, p := range c.peers {
+		if err := p.saveState(); err != nil {
+			return errors.Wrapf(err, "gateway %q", p.label)
+		}
+	}
 	sc := c.Save()
 	if sc == nil {
 		return nil
@@ -567,6 +805,20 @@ func (c *Ctx) saveState() error {
 	return errors.Wrap(err, "failed to save state to daemon")
 }
 
+// forget removes the current context from the daemon and prevents it from
+// being saved again.
+func (c *Ctx) forget() error {
+	sig := c.sig()
+	if c.secret = ""; c.Daemon == "" || sig == "" {
+		return nil
+	}
+	_, err := c.Daemon.Send(&DelCtx{CtxVer, sig})
+	if err == io.EOF || daemon.IsNotRunning(err) {
+		err = nil
+	}
+	return errors.Wrap(err, "failed to clear daemon state")
+}
+
 // sig returns a hash of context config and client credentials. Two contexts
 // with identical signatures have access to the same accounts.
 func (c *Ctx) sig() string {
@@ -580,18 +832,47 @@ func (c *Ctx) sig() string {
 	}
 	switch c.mode {
 	case IAM:
-		cr, _ := c.cfg.Credentials.(*creds.Provider).Creds()
+		cp := c.cfg.Credentials.(*creds.Provider)
+		if c.iamKey != nil {
+			cp = c.iamKey
+			sig[MFASerialEnv] = c.MFASerial
+		}
+		cr, _ := cp.Creds()
 		sig[external.AWSAccessKeyIDEnvVar] = cr.AccessKeyID
 		sig[external.AWSSecreteAccessKeyEnvVar] = cr.SecretAccessKey
-	case Okta:
-		sig[OktaHostEnv] = c.OktaHost
-		sig[OktaUserEnv] = c.OktaUser
-		sig[OktaAWSAppEnv] = c.OktaAWSApp
-		sig[OktaAWSRoleEnv] = c.OktaAWSRole
+	case Okta, SAML:
+		if c.OktaHost != "" {
+			sig[OktaHostEnv] = c.OktaHost
+			sig[OktaUserEnv] = c.OktaUser
+			sig[OktaAWSAppEnv] = c.OktaAWSApp
+			sig[OktaAWSRoleEnv] = c.OktaAWSRole
+		} else {
+			sig[SAMLAppURLEnv] = c.SAMLAppURL
+			sig[SAMLUserEnv] = c.SAMLUser
+			sig[SAMLRoleEnv] = c.SAMLRole
+		}
+		if c.OktaAWSDuration != "" {
+			sig[OktaAWSDurationEnv] = c.OktaAWSDuration
+		}
+		if c.mode == SAML {
+			sig[SAMLDirectEnv] = "true"
+		}
+	case WebIdentity:
+		sig[WebIdentityTokenFileEnv] = c.WebIdentityTokenFile
+		sig[RoleARNEnv] = c.WebIdentityRole
+		sig[RoleSessionNameEnv] = c.WebIdentitySessName
 	default:
 		// TODO: How to handle EC2 instance role?
 		return ""
 	}
+	// Session attributes identify the user, so cached creds must not be shared
+	// between contexts that disagree on them.
+	if c.SessionTags {
+		sig[SessionTagsEnv] = "true"
+	}
+	if c.SourceIdentity {
+		sig[SourceIdentityEnv] = "true"
+	}
 	i, keys := 0, make([]string, len(sig))
 	for k := range sig {
 		keys[i] = k
@@ -639,10 +920,90 @@ func (c *Ctx) setMasterCreds() {
 	}
 }
 
+// Session tag keys. The command is not tagged because cached credentials are
+// reused by other commands.
+const (
+	tagKeyLogin = "oktapus:login"
+	tagKeyOwner = "oktapus:owner"
+)
+
+// setSessionAttrs configures SourceIdentity and session tags for all AssumeRole
+// calls. Both are derived from the IdP username or gateway role session name.
+func (c *Ctx) setSessionAttrs() {
+	c.proxy.SourceIdentity, c.proxy.Tags = "", nil
+	login := c.OktaUser
+	if c.OktaHost == "" {
+		login = c.SAMLUser
+	}
+	if login == "" {
+		login = c.proxy.SessName
+	}
+	if c.SourceIdentity && len(login) >= 2 {
+		c.proxy.SourceIdentity = sessionAttr(login, "_+=,.@-", 64)
+	}
+	if c.SessionTags {
+		c.proxy.Tags = map[string]string{
+			tagKeyLogin: sessionAttr(login, tagValueChars, 256),
+		}
+	}
+}
+
+// session returns role session parameters for the specified account.
+func (c *Ctx) session(accountID string) creds.Session {
+	s := creds.Session{Duration: c.sessionDuration(accountID)}
+	if ac := c.acs[accountID]; ac != nil {
+		if ac.owner = ac.Ctl.Owner; c.SessionTags && ac.owner != "" {
+			s.Tags = map[string]string{
+				tagKeyOwner: sessionAttr(ac.owner, tagValueChars, 256),
+			}
+		}
+	}
+	return s
+}
+
+// sessionSig returns a string that identifies the SourceIdentity and session
+// tags of account credentials issued while the account was owned by owner.
+// Saved credentials are only restored if their signature is still current.
+func (c *Ctx) sessionSig(owner string) string {
+	if c.mode == SAML || (c.proxy.SourceIdentity == "" && !c.SessionTags) {
+		return ""
+	}
+	tags := make([]string, 0, len(c.proxy.Tags)+1)
+	for k, v := range c.proxy.Tags {
+		tags = append(tags, k+"="+v)
+	}
+	if c.SessionTags && owner != "" {
+		tags = append(tags, tagKeyOwner+"="+
+			sessionAttr(owner, tagValueChars, 256))
+	}
+	sort.Strings(tags)
+	return c.proxy.SourceIdentity + "\x00" + strings.Join(tags, "\x00")
+}
+
+// tagValueChars are the non-alphanumeric characters allowed in session tags.
+const tagValueChars = " _.:/=+-@"
+
+// sessionAttr replaces all characters in s that are not alphanumeric or in
+// allow with '_' and truncates the result to n bytes.
+func sessionAttr(s, allow string, n int) string {
+	b := []byte(s)
+	for i, c := range b {
+		if !('0' <= c && c <= '9' || 'A' <= c && c <= 'Z' ||
+			'a' <= c && c <= 'z' || strings.IndexByte(allow, c) >= 0) {
+			b[i] = '_'
+		}
+	}
+	if len(b) > n {
+		b = b[:n]
+	}
+	return string(b)
+}
+
 type savedCreds struct {
 	Account string
 	Creds   aws.Credentials
 	Err     error
+	Attrs   string
 }
 
 // saveCreds returns serializable copies of all credentials that are either
@@ -659,7 +1020,12 @@ func (c *Ctx) saveCreds(t time.Time) []savedCreds {
 		} else if !creds.ValidUntil(&sc.Creds, t) {
 			continue
 		}
+		var owner string
+		if ac := c.acs[id]; ac != nil {
+			owner = ac.owner
+		}
 		sc.Account = id
+		sc.Attrs = c.sessionSig(owner)
 		i++
 	}
 	if i == 0 {
@@ -679,6 +1045,9 @@ func (c *Ctx) saveAccounts() []Account {
 		ac.Flags = src.Flags
 		ac.ID = src.ID
 		ac.Name = src.Name
+		ac.Gateway = src.Gateway
+		ac.Role = src.Role
+		ac.ExternalID = src.ExternalID
 		if src.CtlValid() {
 			ac.Ctl.copy(&src.ref)
 		}
@@ -693,8 +1062,11 @@ type SavedCtx struct {
 	Ctx           Ctx
 	Sig           string
 	Secret        string
+	Action        string
 	OktaSess      *okta.Session
-	OktaCreds     *aws.Credentials // TODO: Save creds in other modes?
+	FormSess      *saml.FormSession
+	IdPCreds      *aws.Credentials // TODO: Save creds in other modes?
+	MFACreds      *aws.Credentials
 	ProxyIdent    creds.Ident
 	ProxySessName string
 	DirOrg        account.Org
@@ -713,6 +1085,7 @@ func newSavedCtx(c *Ctx) *SavedCtx {
 		Ctx:           *c,
 		Sig:           sig,
 		Secret:        c.secret,
+		Action:        c.action,
 		ProxyIdent:    c.proxy.Ident,
 		ProxySessName: c.proxy.SessName,
 		DirOrg:        c.dir.Org,
@@ -720,22 +1093,39 @@ func newSavedCtx(c *Ctx) *SavedCtx {
 		Accounts:      c.saveAccounts(),
 	}
 	c = &sc.Ctx
-	if c.okta != nil {
-		if c.okta == nil || !c.okta.ValidSession() {
+	if c.idp != nil {
+		if !c.idp.ValidSession() {
 			return nil
 		}
-		sess := c.okta.Sess
-		sc.OktaSess = &sess
+		switch idp := c.idp.(type) {
+		case *okta.Client:
+			sess := idp.Sess
+			sc.OktaSess = &sess
+		case *saml.FormIdP:
+			sess := idp.Sess
+			sc.FormSess = &sess
+		}
 		if cr, err := c.cfg.Credentials.(*creds.Provider).Creds(); err == nil {
-			sc.OktaCreds = &cr
+			sc.IdPCreds = &cr
 		}
-		c.okta = nil
+		c.idp = nil
+		c.sso = nil
+	}
+	cfg := c.cfg
+	if c.iamKey != nil {
+		if cr, err := c.cfg.Credentials.(*creds.Provider).Creds(); err == nil &&
+			cr.HasKeys() {
+			sc.MFACreds = &cr
+		}
+		cfg.Credentials = c.iamKey
+		c.iamKey = nil
 	}
-	envFromCfg(&c.EnvCfg, &c.cfg)
+	envFromCfg(&c.EnvCfg, &cfg)
 	c.local = false
 	c.mode = Unknown
 	c.creds = nil
 	c.acs = nil
+	c.peers = nil
 	return sc
 }
 
@@ -744,6 +1134,7 @@ func (sc *SavedCtx) Restore() (*Ctx, error) {
 	c := sc.Ctx
 	c.local = false
 	c.secret = sc.Secret
+	c.action = sc.Action
 	if err := c.resolveCfg(nil); err != nil {
 		return nil, err
 	}
@@ -760,17 +1151,29 @@ func (sc *SavedCtx) Restore() (*Ctx, error) {
 // but this means that the cached accounts and creds may no longer be 100%
 // correct for the current config.
 func (sc *SavedCtx) restore(c *Ctx) {
-	if c.mode == Okta {
-		c.okta.Sess = *sc.OktaSess
-		if sc.OktaCreds != nil {
-			c.cfg.Credentials.(*creds.Provider).Store(*sc.OktaCreds, nil)
+	if c.idp != nil {
+		switch idp := c.idp.(type) {
+		case *okta.Client:
+			if sc.OktaSess != nil {
+				idp.Sess = *sc.OktaSess
+			}
+		case *saml.FormIdP:
+			if sc.FormSess != nil {
+				idp.SetSession(*sc.FormSess)
+			}
+		}
+		if sc.IdPCreds != nil {
+			c.cfg.Credentials.(*creds.Provider).Store(*sc.IdPCreds, nil)
 		}
+	} else if c.iamKey != nil && sc.MFACreds != nil {
+		c.cfg.Credentials.(*creds.Provider).Store(*sc.MFACreds, nil)
 	}
 	c.proxy.Ident = sc.ProxyIdent
 	c.proxy.SessName = sc.ProxySessName
 	c.dir.Org = sc.DirOrg
 	c.newClients()
 	c.setCommonRole()
+	c.setSessionAttrs()
 
 	// Common role is not part of context signature because it does not affect
 	// what the user has access to in general, but it does change the current
@@ -784,6 +1187,17 @@ func (sc *SavedCtx) restore(c *Ctx) {
 	if c.CommonRole == sc.Ctx.CommonRole {
 		for i := range sc.Creds {
 			cr := &sc.Creds[i]
+			var owner string
+			ac := c.acs[cr.Account]
+			if ac != nil {
+				owner = ac.Ctl.Owner
+			}
+			if cr.Attrs != c.sessionSig(owner) {
+				continue // Issued with another owner tag
+			}
+			if ac != nil {
+				ac.owner = owner
+			}
 			c.CredsProvider(cr.Account).Store(cr.Creds, cr.Err)
 		}
 	}
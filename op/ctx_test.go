@@ -10,6 +10,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/mxk/go-cli"
 	"github.com/mxk/oktapus/account"
 	"github.com/mxk/oktapus/mock"
 	"github.com/stretchr/testify/assert"
@@ -24,6 +25,9 @@ func TestCtx(t *testing.T) {
 		assert.NoError(t, os.Remove(tmp.Name()))
 	}()
 	tmp.WriteString("aws 100000000000 external\n")
+	tmp.WriteString("aws 000000000001 legacy OrganizationAccountAccessRole ext-id\n")
+	tmp.WriteString("aws 000000000002 -\n")
+	tmp.WriteString("aws 000000000003 -\n")
 	require.NoError(t, tmp.Close())
 
 	ctx := NewCtx()
@@ -34,7 +38,87 @@ func TestCtx(t *testing.T) {
 	require.NoError(t, ctx.Refresh())
 
 	acs := ctx.Accounts()
+	require.Len(t, acs, 3)
+	assert.Equal(t, []string{"100000000000", "000000000000", "000000000001"},
+		[]string{acs[0].ID, acs[1].ID, acs[2].ID})
+
+	ac := acs[2]
+	assert.Equal(t, "OrganizationAccountAccessRole", ac.Role)
+	assert.Equal(t, "ext-id", ac.ExternalID)
+	cr, err := ac.CredsProvider().Retrieve()
+	require.NoError(t, err)
+	want := w.SessionToken("1", "OrganizationAccountAccessRole", "alice")
+	assert.Equal(t, want, cr.SessionToken)
+}
+
+func TestAggregateCtx(t *testing.T) {
+	ctx2 := mock.Ctx
+	ctx2.Account = "000000000100"
+	w1 := mock.NewAWS(mock.Ctx, mock.NewOrg(mock.Ctx, "master1", "test1"))
+	w2 := mock.NewAWS(ctx2, mock.NewOrg(ctx2, "master2", "test2"))
+	for _, w := range []*mock.AWS{w1, w2} {
+		for id := range w.Root().OrgRouter().Accounts {
+			*w.Account(id) = mock.ChainRouter{mock.RoleRouter{}}
+		}
+	}
+
+	peer := NewCtx()
+	peer.label = "sandbox"
+	require.NoError(t, peer.Init(&w2.Cfg))
+	ctx := NewCtx()
+	ctx.label = "prod"
+	ctx.peers = []*Ctx{peer}
+	require.NoError(t, ctx.Init(&w1.Cfg))
+
+	acs, err := ctx.Match("all")
+	require.NoError(t, err)
 	require.Len(t, acs, 4)
+	gw := make(map[string]string, len(acs))
+	for _, ac := range acs {
+		gw[ac.ID] = ac.Gateway
+	}
+	want := map[string]string{
+		"000000000000": "prod",
+		"000000000001": "prod",
+		"000000000100": "sandbox",
+		"000000000101": "sandbox",
+	}
+	assert.Equal(t, want, gw)
+
+	acs, err = ctx.Match("all,org=sandbox")
+	require.NoError(t, err)
+	require.Len(t, acs, 2)
+	assert.Equal(t, "master2", acs[0].Name)
+	assert.Equal(t, "test2", acs[1].Name)
+
+	cr, err := ctx.CredsProvider("000000000101").Retrieve()
+	require.NoError(t, err)
+	assert.Equal(t, w2.SessionToken("101", "alice", "alice"), cr.SessionToken)
+	assert.Equal(t, peer.CredsProvider("000000000101"), acs[1].CredsProvider())
+}
+
+func TestWebIdentityCtx(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "ctx_test.")
+	require.NoError(t, err)
+	defer func() {
+		tmp.Close()
+		assert.NoError(t, os.Remove(tmp.Name()))
+	}()
+	tmp.WriteString("eyJhbGciOiJSUzI1NiJ9.e30.c2ln\n")
+	require.NoError(t, tmp.Close())
+
+	ctx := NewCtx()
+	ctx.WebIdentityTokenFile = tmp.Name()
+	w := mock.NewAWS(mock.Ctx, mock.NewOrg(mock.Ctx, "master", "test1"))
+	assert.EqualError(t, ctx.Init(&w.Cfg), RoleARNEnv+" not set")
+
+	ctx = NewCtx()
+	ctx.WebIdentityTokenFile = tmp.Name()
+	ctx.WebIdentityRole = string(mock.Ctx.New("iam", "role/ci"))
+	require.NoError(t, ctx.Init(&w.Cfg))
+	assert.Equal(t, WebIdentity, ctx.AuthMode())
+	assert.Equal(t, w.SessionToken("", "ci", "oktapus"), string(ctx.Ident().ARN))
+	assert.Equal(t, IAMPath+"oktapus", ctx.CommonRole)
 }
 
 func TestMasterExternalID(t *testing.T) {
@@ -57,3 +141,90 @@ func TestSavedCtx(t *testing.T) {
 	var v SavedCtx
 	require.NoError(t, gob.NewDecoder(&b).Decode(&v))
 }
+
+func TestSessionAttrs(t *testing.T) {
+	c := NewCtx()
+	c.proxy.SessName = "alice"
+	c.setSessionAttrs()
+	assert.Empty(t, c.proxy.SourceIdentity)
+	assert.Nil(t, c.proxy.Tags)
+	assert.Nil(t, c.session("000000000001").Tags)
+
+	c.OktaHost = "example.okta.com"
+	c.OktaUser = "alice@example.com"
+	c.SessionTags = true
+	c.SourceIdentity = true
+	c.action = "creds"
+	c.setSessionAttrs()
+	assert.Equal(t, "alice@example.com", c.proxy.SourceIdentity)
+	assert.Equal(t, map[string]string{tagKeyLogin: "alice@example.com"},
+		c.proxy.Tags)
+
+	c.acs = map[string]*Account{"000000000001": {Ctl: Ctl{Owner: "bob (ops)"}}}
+	assert.Equal(t, map[string]string{tagKeyOwner: "bob _ops_"},
+		c.session("000000000001").Tags)
+	assert.Nil(t, c.session("000000000002").Tags)
+	assert.Equal(t, "bob (ops)", c.acs["000000000001"].owner)
+
+	sig := c.sessionSig("bob (ops)")
+	assert.NotEqual(t, sig, c.sessionSig(""))
+	c.action = "ls"
+	c.setSessionAttrs()
+	assert.Equal(t, sig, c.sessionSig("bob (ops)"))
+
+	assert.Equal(t, "a_b_c", sessionAttr("a/b c", "_", 64))
+	assert.Equal(t, "ab", sessionAttr("abc", "", 2))
+}
+
+type tagsCmd struct{ tags map[string]string }
+
+func (*tagsCmd) Info() *cli.Info          { return &cli.Info{Name: "tags|t"} }
+func (*tagsCmd) Main(args []string) error { return nil }
+
+func (cmd *tagsCmd) Run(ctx *Ctx) (interface{}, error) {
+	cmd.tags = ctx.proxy.Tags
+	return nil, nil
+}
+
+func TestRunSessionTags(t *testing.T) {
+	w := mock.NewAWS(mock.Ctx, mock.NewOrg(mock.Ctx, "master", "test1"))
+	ctx := NewCtx()
+	ctx.SessionTags = true
+	var cmd tagsCmd
+	_, err := run(ctx, &w.Cfg, &cmd)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{tagKeyLogin: "alice"}, cmd.tags)
+}
+
+func TestRestoreSessionCreds(t *testing.T) {
+	w := mock.NewAWS(mock.Ctx, mock.NewOrg(mock.Ctx, "master", "test1"))
+	const id = "000000000001"
+	save := func(owner string) *SavedCtx {
+		c := NewCtx()
+		c.SessionTags = true
+		c.action = "creds"
+		require.NoError(t, c.Init(&w.Cfg))
+		require.NoError(t, c.Refresh())
+		c.secret = "secret"
+		ac := c.acs[id]
+		ac.Flags.Set(CtlFlag)
+		ac.Ctl.Owner = "bob"
+		require.NoError(t, c.CredsProvider(id).Ensure(-1))
+		ac.Ctl.Owner, ac.ref.Owner = owner, owner
+		sc := c.Save()
+		require.NotNil(t, sc)
+		return sc
+	}
+	restore := func(sc *SavedCtx, action string) bool {
+		c := NewCtx()
+		c.SessionTags = true
+		c.action = action
+		require.NoError(t, c.Init(&w.Cfg))
+		sc.restore(c)
+		cr, _ := c.CredsProvider(id).Creds()
+		return cr.HasKeys()
+	}
+	assert.True(t, restore(save("bob"), "creds"))
+	assert.True(t, restore(save("bob"), "ls"))
+	assert.False(t, restore(save("carol"), "creds"))
+}
@@ -0,0 +1,318 @@
+package op
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/aws/external"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/mxk/go-fast"
+	"github.com/pkg/errors"
+)
+
+// sharedCredsSource is the credentials source prefix used by the external
+// package for keys loaded from shared config files.
+const sharedCredsSource = "SharedConfigCredentials: "
+
+// keyVerifyTimeout is the maximum time to wait for a new access key to become
+// usable.
+var keyVerifyTimeout = 30 * time.Second
+
+// KeyRotation describes a completed access key rotation.
+type KeyRotation struct {
+	User   string
+	File   string
+	OldKey string
+	NewKey string
+}
+
+// KeyAge returns the age of the gateway IAM user access key. It returns zero
+// if the context is not in IAM mode.
+func (c *Ctx) KeyAge() (time.Duration, error) {
+	c.requireInit()
+	if c.mode != IAM {
+		return 0, nil
+	}
+	cr, err := c.UserCreds().Retrieve()
+	if err != nil {
+		return 0, err
+	}
+	k, _, err := c.accessKey(iam.New(c.cfg), cr.AccessKeyID)
+	if err != nil {
+		return 0, err
+	}
+	return fast.Time().Sub(aws.TimeValue(k.CreateDate)), nil
+}
+
+// KeyAgeWarning returns a warning message if the gateway IAM user access key
+// is older than KeyMaxAge. It returns an empty string if KeyMaxAge is not set
+// or the context is not in IAM mode.
+func (c *Ctx) KeyAgeWarning() (string, error) {
+	if c.KeyMaxAge == "" || c.mode != IAM {
+		return "", nil
+	}
+	lim, err := time.ParseDuration(c.KeyMaxAge)
+	if err != nil || lim <= 0 {
+		return "", errors.Errorf("invalid %s: %q", KeyMaxAgeEnv, c.KeyMaxAge)
+	}
+	age, err := c.KeyAge()
+	if err != nil || age < lim {
+		return "", errors.Wrap(err, "failed to get access key age")
+	}
+	return fmt.Sprintf("access key of IAM user %q is %d days old "+
+		"(use 'rotate-key' to replace it)", c.Ident().Name(),
+		age/(24*time.Hour)), nil
+}
+
+// RotateKey replaces the gateway IAM user access key. A new key is created,
+// verified, and written to the shared credentials file that contained the old
+// key. The old key is then deactivated and deleted. The cached daemon context
+// for the old key is discarded.
+func (c *Ctx) RotateKey() (*KeyRotation, error) {
+	c.requireInit()
+	c.requireLocal()
+	if c.mode != IAM {
+		return nil, errors.New("gateway credentials are not an IAM user key")
+	}
+	cr, err := c.UserCreds().Retrieve()
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(cr.Source, sharedCredsSource) {
+		return nil, errors.Errorf("access key was not loaded from a shared "+
+			"credentials file (source: %s)", cr.Source)
+	}
+	r := &KeyRotation{
+		User:   c.Ident().Name(),
+		File:   strings.TrimPrefix(cr.Source, sharedCredsSource),
+		OldKey: cr.AccessKeyID,
+	}
+	profile := c.awsProfile()
+
+	// Make sure that the file can be updated before creating a new key
+	b, err := ioutil.ReadFile(r.File)
+	if err == nil {
+		_, err = setSharedCreds(b, profile, cr.AccessKeyID, cr)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read shared credentials")
+	}
+
+	// AWS allows at most two keys per user
+	c1 := iam.New(c.cfg)
+	if _, n, err := c.accessKey(c1, r.OldKey); err != nil {
+		return nil, err
+	} else if n > 1 {
+		return nil, errors.Errorf("IAM user %q already has %d access keys",
+			r.User, n)
+	}
+	out, err := c1.CreateAccessKeyRequest(&iam.CreateAccessKeyInput{
+		UserName: aws.String(r.User),
+	}).Send()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create access key")
+	}
+	newCr := aws.Credentials{
+		AccessKeyID:     aws.StringValue(out.AccessKey.AccessKeyId),
+		SecretAccessKey: aws.StringValue(out.AccessKey.SecretAccessKey),
+		Source:          cr.Source,
+	}
+	r.NewKey = newCr.AccessKeyID
+	delNew := func(err error) (*KeyRotation, error) {
+		c1.DeleteAccessKeyRequest(&iam.DeleteAccessKeyInput{
+			AccessKeyId: aws.String(r.NewKey),
+			UserName:    aws.String(r.User),
+		}).Send()
+		return nil, err
+	}
+	if err = c.verifyKey(newCr); err != nil {
+		return delNew(err)
+	}
+	if b, err = setSharedCreds(b, profile, r.OldKey, newCr); err == nil {
+		err = writeFile(r.File, b)
+	}
+	if err != nil {
+		return delNew(errors.Wrap(err, "failed to update shared credentials"))
+	}
+
+	// Without MFA, the old key can no longer be used once it is deactivated
+	c2 := c1
+	if c.iamKey == nil {
+		cfg := c.cfg.Copy()
+		cfg.Credentials = aws.StaticCredentialsProvider{Value: newCr}
+		c2 = iam.New(cfg)
+	}
+	_, err = c2.UpdateAccessKeyRequest(&iam.UpdateAccessKeyInput{
+		AccessKeyId: aws.String(r.OldKey),
+		Status:      iam.StatusTypeInactive,
+		UserName:    aws.String(r.User),
+	}).Send()
+	if err == nil {
+		_, err = c2.DeleteAccessKeyRequest(&iam.DeleteAccessKeyInput{
+			AccessKeyId: aws.String(r.OldKey),
+			UserName:    aws.String(r.User),
+		}).Send()
+	}
+	if err != nil {
+		return r, errors.Wrapf(err, "failed to delete old access key %s",
+			r.OldKey)
+	}
+	return r, c.forget()
+}
+
+// awsProfile returns the name of the shared config profile used to load
+// gateway credentials.
+func (c *Ctx) awsProfile() string {
+	if c.Profile != "" {
+		return c.Profile
+	} else if c.EnvCfg.SharedConfigProfile != "" {
+		return c.EnvCfg.SharedConfigProfile
+	}
+	return external.DefaultSharedConfigProfile
+}
+
+// accessKey returns metadata for the specified access key of the gateway IAM
+// user and the total number of keys that the user has.
+func (c *Ctx) accessKey(c1 *iam.IAM, id string) (*iam.AccessKeyMetadata, int, error) {
+	out, err := c1.ListAccessKeysRequest(&iam.ListAccessKeysInput{
+		UserName: aws.String(c.Ident().Name()),
+	}).Send()
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to list access keys")
+	}
+	keys := out.AccessKeyMetadata
+	for i := range keys {
+		if aws.StringValue(keys[i].AccessKeyId) == id {
+			return &keys[i], len(keys), nil
+		}
+	}
+	return nil, len(keys), errors.Errorf("access key %s not found", id)
+}
+
+// verifyKey ensures that cr belong to the gateway IAM user. New keys may take
+// a few seconds to become usable, so the call is retried until
+// keyVerifyTimeout.
+func (c *Ctx) verifyKey(cr aws.Credentials) error {
+	cfg := c.cfg.Copy()
+	cfg.Credentials = aws.StaticCredentialsProvider{Value: cr}
+	stsc := sts.New(cfg)
+	deadline := fast.Time().Add(keyVerifyTimeout)
+	for {
+		out, err := stsc.GetCallerIdentityRequest(&sts.GetCallerIdentityInput{}).Send()
+		if err == nil {
+			if id := aws.StringValue(out.Arn); id != string(c.Ident().ARN) {
+				return errors.Errorf("new access key identity mismatch (%s)",
+					id)
+			}
+			return nil
+		}
+		if e, ok := err.(awserr.Error); !ok ||
+			e.Code() != "InvalidClientTokenId" ||
+			!fast.Time().Before(deadline) {
+			return errors.Wrap(err, "failed to verify new access key")
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// setSharedCreds replaces the access key in the specified profile section of
+// a shared config or credentials file. The section must contain the access key
+// identified by oldID. Comments and other settings are preserved.
+func setSharedCreds(b []byte, profile, oldID string, cr aws.Credentials) ([]byte, error) {
+	lines := bytes.SplitAfter(b, []byte("\n"))
+	var id, secret int
+	for _, name := range []string{profile, "profile " + profile} {
+		id, secret = -1, -1
+		in := false
+		for i, ln := range lines {
+			s := strings.TrimSpace(string(ln))
+			if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+				in = strings.TrimSpace(s[1:len(s)-1]) == name
+				continue
+			}
+			if !in {
+				continue
+			}
+			switch k, v := iniKeyValue(s); k {
+			case "aws_access_key_id":
+				if v != oldID {
+					return nil, errors.Errorf("profile %q does not contain "+
+						"access key %s", profile, oldID)
+				}
+				id = i
+			case "aws_secret_access_key":
+				secret = i
+			}
+		}
+		if id >= 0 {
+			break
+		}
+	}
+	if id < 0 || secret < 0 {
+		return nil, errors.Errorf("access key for profile %q not found",
+			profile)
+	}
+	setIniValue(lines, id, cr.AccessKeyID)
+	setIniValue(lines, secret, cr.SecretAccessKey)
+	return bytes.Join(lines, nil), nil
+}
+
+// iniKeyValue splits an ini file line into a key and value.
+func iniKeyValue(s string) (k, v string) {
+	if i := strings.IndexByte(s, '='); i > 0 {
+		k, v = strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:])
+	}
+	return
+}
+
+// setIniValue replaces the value on line i, keeping original key formatting
+// and line ending.
+func setIniValue(lines [][]byte, i int, v string) {
+	ln := lines[i]
+	eq := bytes.IndexByte(ln, '=') + 1
+	for eq < len(ln) && (ln[eq] == ' ' || ln[eq] == '\t') {
+		eq++
+	}
+	end := ""
+	if bytes.HasSuffix(ln, []byte("\r\n")) {
+		end = "\r\n"
+	} else if bytes.HasSuffix(ln, []byte("\n")) {
+		end = "\n"
+	}
+	lines[i] = append(append(ln[:eq:eq], v...), end...)
+}
+
+// writeFile replaces the contents of an existing file, keeping its
+// permissions. The file is replaced atomically where possible.
+func writeFile(name string, b []byte) error {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name))
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err = f.Write(b); err == nil {
+		err = f.Chmod(fi.Mode().Perm())
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
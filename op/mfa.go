@@ -0,0 +1,76 @@
+package op
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/mxk/oktapus/creds"
+	"github.com/mxk/oktapus/saml"
+	"github.com/pkg/errors"
+)
+
+// MFAProviderName is the source name of MFA session credentials.
+const MFAProviderName = "MFASessionProvider"
+
+// mfaDevice is a virtual or hardware MFA device serial number.
+type mfaDevice string
+
+func (d mfaDevice) Key() string    { return string(d) }
+func (d mfaDevice) Value() string  { return string(d) }
+func (d mfaDevice) Prompt() string { return "MFA code for " + string(d) }
+
+// mfaCfg replaces IAM user credentials with an MFA-authenticated session
+// obtained via sts:GetSessionToken. The user is prompted for a new code when
+// the session expires. Long-term user credentials remain available via
+// UserCreds.
+func (c *Ctx) mfaCfg() {
+	c.iamKey = c.cfg.Credentials.(*creds.Provider)
+	stsc := creds.NewClient(&c.cfg)
+	c.cfg.Credentials = mfaProvider(stsc, mfaDevice(c.MFASerial),
+		func() saml.Authenticator {
+			if !c.local {
+				return nil
+			}
+			return newTermAuthn("AWS", "")
+		})
+}
+
+// mfaProvider returns a new Provider that calls GetSessionToken using an MFA
+// code from the Authenticator returned by authn. Renewal fails if authn
+// returns nil, which prevents the daemon from prompting the user.
+func mfaProvider(stsc creds.Client, dev mfaDevice, authn func() saml.Authenticator) *creds.Provider {
+	return creds.RenewableProvider(func() (cr aws.Credentials, err error) {
+		t := authn()
+		if t == nil {
+			err = errors.New("MFA session expired")
+			return
+		}
+		code, err := t.Input(dev)
+		if err != nil {
+			return
+		}
+		in := &sts.GetSessionTokenInput{
+			SerialNumber: aws.String(dev.Key()),
+			TokenCode:    aws.String(strings.TrimSpace(code)),
+		}
+		out, err := stsc.GetSessionTokenRequest(in).Send()
+		if err == nil {
+			cr = creds.FromSTS(out.Credentials)
+		} else {
+			err = errors.Wrap(err, "MFA authentication failed")
+		}
+		cr.Source = MFAProviderName
+		return
+	})
+}
+
+// UserCreds returns long-term IAM user credentials if the gateway credentials
+// are an MFA session. Otherwise, it returns the gateway credentials.
+func (c *Ctx) UserCreds() aws.CredentialsProvider {
+	c.requireInit()
+	if c.iamKey != nil {
+		return c.iamKey
+	}
+	return c.cfg.Credentials
+}
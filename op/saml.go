@@ -0,0 +1,319 @@
+package op
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/mxk/go-cloud/aws/region"
+	"github.com/mxk/go-fast"
+	"github.com/mxk/oktapus/account"
+	"github.com/mxk/oktapus/creds"
+	"github.com/mxk/oktapus/okta"
+	"github.com/mxk/oktapus/saml"
+	"github.com/pkg/errors"
+)
+
+// samlReuse is how long one SAML assertion is used for obtaining role
+// credentials. Okta assertions are valid for 5 minutes, which is also a common
+// default for other IdPs.
+const samlReuse = 4 * time.Minute
+
+// samlSkew is the allowed clock difference when validating SAML assertions.
+const samlSkew = 2 * time.Minute
+
+// samlAuth provides credentials for any role in the IdP SAML assertion. All
+// roles share one assertion, which is renewed once it is too old.
+type samlAuth struct {
+	mu     sync.Mutex
+	open   func() (*saml.AWSAuth, error)
+	verify func(saml.Assertion) error
+	sts    *sts.STS
+	region string
+	source string
+	dur    time.Duration
+	auth   *saml.AWSAuth
+	exp    time.Time
+}
+
+// get returns the current SAML authentication data.
+func (s *samlAuth) get() (*saml.AWSAuth, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.auth == nil || !fast.Time().Before(s.exp) {
+		auth, err := s.open()
+		if err != nil {
+			return nil, err
+		}
+		if s.verify != nil {
+			if err = s.verify(auth.Assertion); err != nil {
+				return nil, errors.Wrap(err, "SAML assertion rejected")
+			}
+		}
+		s.auth, s.exp = auth, fast.Time().Add(samlReuse)
+	}
+	return s.auth, nil
+}
+
+// provider returns a new Provider that calls AssumeRoleWithSAML for the
+// specified role. The first role in the assertion is used if role is empty.
+// Session duration is set by OktaAWSDuration, the session duration setting
+// returned by dur (if not nil), or the assertion, in that order. If it exceeds
+// the role's maximum, the role's MaxSessionDuration is used instead, and the
+// requested duration is tried again on the next renewal.
+func (s *samlAuth) provider(role arn.ARN, dur func() time.Duration) *creds.Provider {
+	return creds.RenewableProvider(func() (cr aws.Credentials, err error) {
+		auth, err := s.get()
+		if err != nil {
+			return
+		}
+		r, err := auth.Role(role)
+		if err != nil {
+			err = errors.Wrapf(err, "%s", role)
+			return
+		}
+		if part := r.Role.Partition(); part != region.Partition(s.region) {
+			err = errors.Errorf("invalid region %q for %q partition",
+				s.region, part)
+			return
+		}
+		in := sts.AssumeRoleWithSAMLInput{
+			PrincipalArn:  arn.String(r.Principal),
+			RoleArn:       arn.String(r.Role),
+			SAMLAssertion: aws.String(auth.Assertion.Encode()),
+		}
+		d := s.dur
+		if d == 0 && dur != nil {
+			d = dur()
+		}
+		if d == 0 {
+			d = auth.SessionDuration
+		}
+		if d != 0 {
+			in.DurationSeconds = aws.Int64(int64(d / time.Second))
+		}
+		out, err := s.sts.AssumeRoleWithSAMLRequest(&in).Send()
+		if in.DurationSeconds != nil && creds.IsDurationError(err) {
+			// Use default duration to find out the actual limit
+			in.DurationSeconds = nil
+			if out, err = s.sts.AssumeRoleWithSAMLRequest(&in).Send(); err == nil {
+				max, err := creds.RoleMaxSessionDuration(&s.sts.Config,
+					out.Credentials, r.Role)
+				if err == nil && max > time.Hour && max < d {
+					in.DurationSeconds = aws.Int64(int64(max / time.Second))
+					if o, err := s.sts.AssumeRoleWithSAMLRequest(&in).Send(); err == nil {
+						out = o
+					}
+				}
+			}
+		}
+		if err == nil {
+			cr = creds.FromSTS(out.Credentials)
+			cr.Source = s.source
+		}
+		return
+	})
+}
+
+// idpCfg creates the SAML IdP client and configures client config credentials
+// for the selected role, or the first role in the assertion. Okta is used if
+// OktaHost is set, otherwise SAMLAppURL specifies a generic form-based IdP. If
+// SAMLDirect is set, all roles in the assertion are used without a gateway.
+func (c *Ctx) idpCfg() error {
+	var app, role, source string
+	if c.OktaHost != "" {
+		if c.OktaUser == "" {
+			return errors.New(OktaUserEnv + " not set")
+		}
+		if c.OktaAWSApp == "" {
+			return errors.New(OktaAWSAppEnv + " not set")
+		}
+		c.idp = okta.NewClient(c.OktaHost)
+		app, role, source = c.OktaAWSApp, c.OktaAWSRole, "Okta"
+	} else {
+		c.idp = saml.NewFormIdP(c.SAMLAppURL)
+		app, role, source = c.SAMLAppURL, c.SAMLRole, "SAML"
+	}
+	var dur time.Duration
+	if c.OktaAWSDuration != "" {
+		sec, err := strconv.ParseUint(c.OktaAWSDuration, 10, 32)
+		if err != nil || sec == 0 {
+			return errors.Errorf("invalid %s: %q", OktaAWSDurationEnv,
+				c.OktaAWSDuration)
+		}
+		dur = time.Duration(sec) * time.Second
+	}
+	stsc := sts.New(c.cfg)
+	creds.Set(stsc.Client, aws.AnonymousCredentials)
+	c.sso = &samlAuth{
+		verify: c.samlVerifier(),
+		sts:    stsc,
+		region: c.cfg.Region,
+		source: source,
+		dur:    dur,
+	}
+	if c.SAMLDirect {
+		c.sso.open = func() (*saml.AWSAuth, error) {
+			return c.idp.OpenAWS(app, "")
+		}
+		c.mode = SAML
+	} else {
+		c.sso.open = func() (*saml.AWSAuth, error) {
+			return c.idp.OpenAWS(app, arn.ARN(role))
+		}
+		c.mode = Okta
+	}
+	c.cfg.Credentials = c.sso.provider(arn.ARN(role), nil)
+	return nil
+}
+
+// samlVerifier returns a function that validates SAML assertions. IdP signing
+// certificates are loaded from SAMLCert and SAMLMetadata on first use. If
+// neither is set, assertions from generic IdPs are rejected. Okta assertions
+// are obtained through an authenticated API session, so their signature is not
+// verified, but a warning is printed.
+func (c *Ctx) samlVerifier() func(saml.Assertion) error {
+	file, md := c.SAMLCert, c.SAMLMetadata
+	if file == "" && md == "" {
+		if c.OktaHost == "" {
+			return func(saml.Assertion) error {
+				return errors.Errorf("%s or %s must be set to verify "+
+					"SAML signatures", SAMLCertEnv, SAMLMetadataEnv)
+			}
+		}
+		var warn sync.Once
+		v := &saml.Verifier{Skew: samlSkew}
+		return func(sa saml.Assertion) error {
+			warn.Do(func() {
+				fmt.Fprintf(os.Stderr, "warning: SAML signature not verified "+
+					"(set %s or %s)\n", SAMLCertEnv, SAMLMetadataEnv)
+			})
+			return v.Verify(sa)
+		}
+	}
+	var v *saml.Verifier
+	return func(sa saml.Assertion) error {
+		if v == nil {
+			certs, err := loadSAMLCerts(file, md)
+			if err != nil {
+				return err
+			}
+			v = &saml.Verifier{Certs: certs, Skew: samlSkew}
+		}
+		return v.Verify(sa)
+	}
+}
+
+// samlMetadataClient is the HTTP client for fetching SAML metadata.
+var samlMetadataClient = &http.Client{Timeout: 30 * time.Second}
+
+// loadSAMLCerts loads IdP signing certificates from a PEM file and/or SAML
+// metadata, which may be an https URL or a local file.
+func loadSAMLCerts(file, metadata string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	if file != "" {
+		b, err := ioutil.ReadFile(file)
+		if err == nil {
+			certs, err = saml.PEMCerts(b)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load SAML certificate")
+		}
+	}
+	if metadata != "" {
+		var b []byte
+		var err error
+		if strings.HasPrefix(metadata, "http://") {
+			// Certificates fetched over plain HTTP could be replaced in transit
+			err = errors.New("SAML metadata URL must use https")
+		} else if strings.HasPrefix(metadata, "https://") {
+			var rsp *http.Response
+			if rsp, err = samlMetadataClient.Get(metadata); err == nil {
+				b, err = ioutil.ReadAll(io.LimitReader(rsp.Body, 1024*1024))
+				rsp.Body.Close()
+				if err == nil && rsp.StatusCode != http.StatusOK {
+					err = errors.Errorf("http status %q", rsp.Status)
+				}
+			}
+		} else {
+			b, err = ioutil.ReadFile(metadata)
+		}
+		var mc []*x509.Certificate
+		if err == nil {
+			mc, err = saml.MetadataCerts(b)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load SAML metadata")
+		}
+		certs = append(certs, mc...)
+	}
+	return certs, nil
+}
+
+// idpAuth performs IdP authentication. For Okta, it also validates AWS app
+// selection.
+func (c *Ctx) idpAuth() error {
+	c.requireLocal()
+	oc, ok := c.idp.(*okta.Client)
+	if !ok {
+		err := c.idp.Authenticate(newTermAuthn("SAML", c.SAMLUser))
+		return errors.Wrap(err, "SAML authentication failed")
+	}
+	if err := oc.Authenticate(newTermAuthn("Okta", c.OktaUser)); err != nil {
+		return errors.Wrap(err, "Okta authentication failed")
+	}
+	apps, err := oc.AppLinks()
+	if err != nil {
+		return errors.Wrap(err, "failed to get Okta apps")
+	}
+	for _, app := range apps {
+		if app.LinkURL == c.OktaAWSApp && app.AppName == "amazon_aws" {
+			return nil
+		}
+	}
+	return errors.Errorf("AWS app not found: %s", c.OktaAWSApp)
+}
+
+// refreshSAML registers one account for each role in the SAML assertion. If
+// the assertion contains multiple roles in the same account, the alias file
+// role is used, or the first role if there is no override.
+func (c *Ctx) refreshSAML(m map[string]account.Alias) error {
+	auth, err := c.sso.get()
+	if err != nil {
+		return errors.Wrap(err, "failed to get SAML assertion")
+	}
+	idx := make(map[string]int, len(auth.Roles))
+	acs := make([]Account, 0, len(auth.Roles))
+	for _, r := range auth.Roles {
+		id := r.Role.Account()
+		a := m[id]
+		if a.Hidden() {
+			continue
+		}
+		role := strings.TrimPrefix(r.Role.PathName(), "/")
+		if i, dup := idx[id]; dup {
+			if a.Role != "" && c.proxy.Role(id, a.Role) == r.Role {
+				acs[i].Role = role
+			}
+			continue
+		}
+		name := a.Name
+		if name == "" {
+			name = id
+		}
+		idx[id] = len(acs)
+		acs = append(acs, Account{ID: id, Name: name, Role: role})
+	}
+	c.Register(initAccounts(acs))
+	return nil
+}
@@ -0,0 +1,132 @@
+package op
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/mxk/oktapus/account"
+	"github.com/mxk/oktapus/mock"
+	"github.com/mxk/oktapus/saml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSAMLCtx(t *testing.T) {
+	now := time.Now().UTC()
+	auth := &saml.AWSAuth{
+		Assertion: []byte(`<Assertion xmlns="urn:oasis:names:tc:SAML:2.0:assertion">
+<Conditions NotBefore="` + now.Format(time.RFC3339) + `" NotOnOrAfter="` +
+			now.Add(5*time.Minute).Format(time.RFC3339) + `">
+<AudienceRestriction><Audience>urn:amazon:webservices</Audience></AudienceRestriction>
+</Conditions></Assertion>`),
+		Roles: []saml.AWSRole{{
+			Principal: "arn:aws:iam::000000000001:saml-provider/Okta",
+			Role:      "arn:aws:iam::000000000001:role/Admin",
+		}, {
+			Principal: "arn:aws:iam::000000000001:saml-provider/Okta",
+			Role:      "arn:aws:iam::000000000001:role/path/ReadOnly",
+		}, {
+			Principal: "arn:aws:iam::000000000002:saml-provider/Okta",
+			Role:      "arn:aws:iam::000000000002:role/Admin",
+		}, {
+			Principal: "arn:aws:iam::000000000003:saml-provider/Okta",
+			Role:      "arn:aws:iam::000000000003:role/Admin",
+		}},
+	}
+	opened := 0
+	w := mock.NewAWS(mock.Ctx)
+	ctx := NewCtx()
+	ctx.OktaHost = "example.okta.com"
+	ctx.OktaUser = "alice"
+	ctx.OktaAWSApp = "https://example.okta.com/home/amazon_aws/x/272"
+	ctx.SAMLDirect = true
+	require.NoError(t, ctx.resolveCfg(&w.Cfg))
+	require.Equal(t, SAML, ctx.AuthMode())
+	ctx.sso.open = func() (*saml.AWSAuth, error) {
+		opened++
+		return auth, nil
+	}
+
+	ctx.newClients()
+	require.NoError(t, ctx.proxy.Init())
+	ctx.setCommonRole()
+	assert.Equal(t, "000000000001", ctx.Ident().Account)
+	assert.Equal(t, "alice", ctx.proxy.SessName)
+
+	m := map[string]account.Alias{
+		"000000000001": {Name: "prod", Role: "path/ReadOnly"},
+		"000000000003": {Name: account.Hidden},
+	}
+	require.NoError(t, ctx.refreshSAML(m))
+	acs := ctx.Accounts()
+	require.Len(t, acs, 2)
+	assert.Equal(t, []string{"000000000002", "prod"},
+		[]string{acs[0].Name, acs[1].Name})
+	assert.Equal(t, "Admin", acs[0].Role)
+	assert.Equal(t, "path/ReadOnly", acs[1].Role)
+
+	for i, role := range []string{"Admin", "ReadOnly"} {
+		cr, err := acs[i].CredsProvider().Retrieve()
+		require.NoError(t, err)
+		want := w.SessionToken(acs[i].ID, role, "alice")
+		assert.Equal(t, want, cr.SessionToken)
+	}
+	assert.Equal(t, 1, opened)
+
+	// Session duration
+	auth.SessionDuration = 12 * time.Hour
+	role := auth.Roles[0].Role
+	r := &mock.Role{}
+	w.Account("1").RoleRouter()[role.Name()] = r
+	cr, err := ctx.sso.provider(role, nil).Retrieve()
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(mock.MaxSessionDuration),
+		cr.Expires, time.Minute)
+	r.MaxSessionDuration = aws.Int64(4 * 3600)
+	cr, err = ctx.sso.provider(role, nil).Retrieve()
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(4*time.Hour), cr.Expires,
+		time.Minute)
+	cr, err = ctx.sso.provider(role, func() time.Duration {
+		return 2 * time.Hour
+	}).Retrieve()
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), cr.Expires,
+		time.Minute)
+	ctx.sso.dur = 30 * time.Minute
+	cr, err = ctx.sso.provider(role, nil).Retrieve()
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(30*time.Minute), cr.Expires,
+		time.Minute)
+
+	_, err = ctx.CredsProvider("000000000004").Retrieve()
+	assert.EqualError(t, err, "arn:aws:iam::000000000004:role/oktapus/alice: "+
+		saml.ErrInvalidAWSRole.Error())
+
+	ctx.OktaAWSDuration = "12h"
+	assert.EqualError(t, ctx.idpCfg(),
+		`invalid OKTA_AWS_SESSION_DURATION: "12h"`)
+
+	ctx.sso.auth = nil
+	auth.Assertion = []byte(`<Assertion xmlns="urn:oasis:names:tc:SAML:2.0:assertion"/>`)
+	_, err = ctx.sso.get()
+	assert.EqualError(t, err,
+		"SAML assertion rejected: saml: assertion conditions not found")
+}
+
+func TestSAMLVerifier(t *testing.T) {
+	ctx := NewCtx()
+	ctx.SAMLAppURL = "https://idp.example.com/sso"
+	assert.EqualError(t, ctx.samlVerifier()(nil), "OKTAPUS_SAML_CERT or "+
+		"OKTAPUS_SAML_METADATA must be set to verify SAML signatures")
+}
+
+func TestLoadSAMLCerts(t *testing.T) {
+	_, err := loadSAMLCerts("", "http://idp.example.com/metadata")
+	assert.EqualError(t, err,
+		"failed to load SAML metadata: SAML metadata URL must use https")
+	certs, err := loadSAMLCerts("", "../saml/testdata/onelogin_metadata.xml")
+	require.NoError(t, err)
+	assert.Len(t, certs, 1)
+}
@@ -31,14 +31,17 @@ type AccountSpec struct {
 	spec    []string        // Original spec split by commas
 	idx     map[string]uint // Map of non-special names to spec indices
 	owner   map[string]bool // Map of owner names to match criteria
+	team    map[string]bool // Map of owner team names to match criteria
+	org     map[string]bool // Map of gateway labels to match criteria
 	tagMask uint64          // Tag matching mask
 	typ     specType        // Static (ids/names) or dynamic (tags) spec type
 	flags   specFlags       // Account selection flags
 }
 
 // ParseAccountSpec parses the account spec string. User argument determines the
-// meaning of "owner=me" specification.
-func ParseAccountSpec(spec, user string) *AccountSpec {
+// meaning of "owner=me" specification, which also matches accounts owned by any
+// of the user's teams.
+func ParseAccountSpec(spec, user string, teams ...string) *AccountSpec {
 	s := new(AccountSpec)
 	if spec == "" {
 		s.typ = stTags
@@ -48,7 +51,8 @@ func ParseAccountSpec(spec, user string) *AccountSpec {
 	s.spec = strings.Split(spec, ",")
 	s.idx = make(map[string]uint, len(s.spec))
 	for i, e := range s.spec {
-		if name, val, neg := parseSpec(e); isSpecial(name) {
+		name, val, neg := parseSpec(e)
+		if isSpecial(name) || (name == tagOrg && strings.IndexByte(e, '=') >= 0) {
 			switch name {
 			case tagAll:
 				if neg {
@@ -65,6 +69,14 @@ func ParseAccountSpec(spec, user string) *AccountSpec {
 						s.flags = s.flags&^sfAny | sfAlloc
 					}
 				case "me":
+					if user != "" && len(teams) > 0 {
+						if s.team == nil {
+							s.team = make(map[string]bool, len(teams))
+						}
+						for _, team := range teams {
+							s.team[team] = !neg
+						}
+					}
 					val = user
 					fallthrough
 				default:
@@ -73,6 +85,11 @@ func ParseAccountSpec(spec, user string) *AccountSpec {
 					}
 					s.owner[val] = !neg
 				}
+			case tagOrg:
+				if s.org == nil {
+					s.org = make(map[string]bool, 2)
+				}
+				s.org[val] = !neg
 			}
 		} else {
 			if s.idx[name] = uint(i); !neg {
@@ -118,7 +135,11 @@ func (s *AccountSpec) IsStatic(acs Accounts) bool {
 
 // Filter returns only those accounts that match the spec.
 func (s *AccountSpec) Filter(acs Accounts) (Accounts, error) {
-	if s.IsStatic(acs) {
+	static := s.IsStatic(acs)
+	if s.org != nil {
+		acs = s.filterOrg(acs)
+	}
+	if static {
 		return s.filterStatic(acs)
 	}
 	return s.filterDynamic(acs)
@@ -160,6 +181,26 @@ func (s *AccountSpec) filterStatic(acs Accounts) (Accounts, error) {
 	return result, nil
 }
 
+// filterOrg filters accounts by gateway label. If the spec contains any
+// non-negated labels, one of them must match.
+func (s *AccountSpec) filterOrg(acs Accounts) Accounts {
+	def := true
+	for _, want := range s.org {
+		if want {
+			def = false
+			break
+		}
+	}
+	var result Accounts
+	for _, ac := range acs {
+		want, ok := s.org[ac.Gateway]
+		if (ok && want) || (!ok && def) {
+			result = append(result, ac)
+		}
+	}
+	return result
+}
+
 // filterDynamic filters accounts by tags.
 func (s *AccountSpec) filterDynamic(acs Accounts) (Accounts, error) {
 	var result Accounts
@@ -174,7 +215,7 @@ func (s *AccountSpec) filterDynamic(acs Accounts) (Accounts, error) {
 			if s.flags&sfFree == 0 {
 				continue
 			}
-		} else if want, ok := s.owner[ac.Ctl.Owner]; ok {
+		} else if want, ok := s.matchOwner(&ac.Ctl); ok {
 			if !want {
 				continue
 			}
@@ -194,6 +235,15 @@ func (s *AccountSpec) filterDynamic(acs Accounts) (Accounts, error) {
 	return result, nil
 }
 
+// matchOwner returns the owner match criteria for the specified account. The
+// owner name takes precedence over the team.
+func (s *AccountSpec) matchOwner(ctl *Ctl) (want, ok bool) {
+	if want, ok = s.owner[ctl.Owner]; !ok && ctl.Team != "" {
+		want, ok = s.team[ctl.Team]
+	}
+	return
+}
+
 // parseSpec splits an account spec entry into its components. The general
 // format is: "[!...]name[[!]=value]". If value is a boolean, it determines the
 // initial negation state instead of being returned as a string.
@@ -188,7 +188,87 @@ func TestOwner(t *testing.T) {
 	assert.Equal(t, all, match)
 }
 
-type accounts []*struct{ id, name, owner, tags, err string }
+func TestOwnerTeam(t *testing.T) {
+	all := accounts{
+		{id: "1", owner: ""},
+		{id: "2", owner: "a"},
+		{id: "3", owner: "b"},
+		{id: "4", owner: "c"},
+		{id: "5", owner: "d"},
+	}.get()
+	all[2].Ctl.Team = "x"
+	all[3].Ctl.Team = "y"
+	all[4].Ctl.Team = "z"
+	tests := []*struct{ spec, want string }{{
+		spec: "owner=me",
+		want: "2,3,4",
+	}, {
+		spec: "owner!=me",
+		want: "1,5",
+	}, {
+		spec: "owner=b",
+		want: "3",
+	}, {
+		spec: "owner=me,owner!=c",
+		want: "1,2,3,5",
+	}, {
+		spec: "owner",
+		want: "2,3,4,5",
+	}}
+	for _, test := range tests {
+		match, err := ParseAccountSpec(test.spec, "a", "x", "y").Filter(all)
+		require.NoError(t, err)
+		assert.Equal(t, test.want, getIDs(match), "spec=%q", test.spec)
+	}
+
+	match, err := ParseAccountSpec("owner=me", "", "x").Filter(all)
+	require.NoError(t, err)
+	assert.Empty(t, match)
+}
+
+func TestOrg(t *testing.T) {
+	all := accounts{
+		{id: "1", name: "a", org: "x"},
+		{id: "2", name: "b", org: "y", tags: "org"},
+		{id: "3", name: "c", org: "z"},
+		{id: "4", name: "d"},
+	}.get()
+	tests := []*struct{ spec, want string }{{
+		spec: "org=x",
+		want: "1",
+	}, {
+		spec: "org=x,org=y",
+		want: "1,2",
+	}, {
+		spec: "org!=x",
+		want: "2,3,4",
+	}, {
+		spec: "org=x,org!=x",
+		want: "2,3,4",
+	}, {
+		spec: "org=,org=z",
+		want: "3,4",
+	}, {
+		spec: "b,c,org!=x",
+		want: "2,3",
+	}, {
+		spec: "org",
+		want: "2",
+	}, {
+		spec: "org,org=y",
+		want: "2",
+	}}
+	for _, test := range tests {
+		match, err := ParseAccountSpec(test.spec, "").Filter(all)
+		require.NoError(t, err)
+		assert.Equal(t, test.want, getIDs(match), "spec=%q", test.spec)
+	}
+
+	_, err := ParseAccountSpec("a,org=y", "").Filter(all)
+	assert.EqualError(t, err, `account name "a" not found`)
+}
+
+type accounts []*struct{ id, name, owner, tags, org, err string }
 
 func (acs accounts) get() Accounts {
 	all := make(Accounts, len(acs))
@@ -198,6 +278,7 @@ func (acs accounts) get() Accounts {
 			panic(err)
 		}
 		n := NewAccount(mock.AccountID(ac.id), ac.name)
+		n.Gateway = ac.org
 		if ac.err == "" {
 			n.Ctl = Ctl{Owner: ac.owner, Tags: tags}
 		} else {
@@ -0,0 +1,95 @@
+package op
+
+import (
+	"time"
+
+	"github.com/mxk/go-fast"
+	"github.com/mxk/oktapus/creds"
+	"github.com/mxk/oktapus/okta"
+	"github.com/mxk/oktapus/saml"
+)
+
+// Status summarizes the state of one gateway context for diagnostic purposes.
+type Status struct {
+	Gateway    string
+	AuthMode   AuthMode
+	Identity   string
+	Account    string
+	SessName   string
+	CommonRole string
+
+	OrgID            string
+	OrgMaster        string
+	MasterRole       string
+	MasterExternalID string
+
+	IdPSessionExpires time.Time
+	FromDaemon        bool
+
+	Accounts   int
+	ValidCreds int
+	ValidCtl   int
+	Errors     int // Accounts with a credentials or control info error
+}
+
+// Status returns the status of the current context followed by the status of
+// all additional gateways. Account counts reflect cached state only; no API
+// calls are made.
+func (c *Ctx) Status() []*Status {
+	c.requireInit()
+	all := c.group()
+	out := make([]*Status, len(all))
+	for i, g := range all {
+		out[i] = g.status()
+	}
+	return out
+}
+
+// status returns the status of context c.
+func (c *Ctx) status() *Status {
+	s := &Status{
+		AuthMode:   c.mode,
+		Identity:   string(c.proxy.Ident.ARN),
+		Account:    c.proxy.Ident.Account,
+		SessName:   c.proxy.SessName,
+		CommonRole: string(c.role),
+		OrgID:      c.dir.Org.ID,
+		OrgMaster:  c.dir.Org.MasterID,
+		FromDaemon: c.cached,
+		Accounts:   len(c.acs),
+	}
+	if len(c.peers) > 0 || c.label != DefaultProfile {
+		s.Gateway = c.label
+	}
+	if m := s.OrgMaster; m != "" && m != s.Account && c.MasterRole != "" {
+		s.MasterRole = string(c.proxy.Role(m, c.MasterRole))
+		if id := c.MasterExternalID(); id != nil {
+			s.MasterExternalID = *id
+		}
+	}
+	switch idp := c.idp.(type) {
+	case *okta.Client:
+		s.IdPSessionExpires = idp.Sess.ExpiresAt
+	case *saml.FormIdP:
+		s.IdPSessionExpires = idp.Sess.ExpiresAt
+	}
+	now := fast.Time()
+	for _, ac := range c.acs {
+		if ac.CtlValid() {
+			s.ValidCtl++
+		}
+		err := ac.Err
+		if cp := c.creds[ac.ID]; cp != nil {
+			cr, credsErr := cp.Creds()
+			if credsErr != nil {
+				err = credsErr
+			} else if creds.ValidUntil(&cr, now) {
+				s.ValidCreds++
+			}
+		}
+		if err != nil {
+			s.Errors++
+		}
+	}
+	return s
+}
@@ -0,0 +1,49 @@
+package op
+
+import (
+	"testing"
+
+	"github.com/mxk/oktapus/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatus(t *testing.T) {
+	w := mock.NewAWS(mock.Ctx, mock.NewOrg(mock.Ctx, "master", "test1"))
+	for id := range w.Root().OrgRouter().Accounts {
+		*w.Account(id) = mock.ChainRouter{mock.RoleRouter{}}
+	}
+	ctx := NewCtx()
+	require.NoError(t, ctx.Init(&w.Cfg))
+	s := ctx.Status()
+	require.Len(t, s, 1)
+	assert.Equal(t, &Status{
+		AuthMode:   IAM,
+		Identity:   "arn:aws:iam::000000000000:user/alice",
+		Account:    "000000000000",
+		SessName:   "alice",
+		CommonRole: "arn:aws:iam:::role/oktapus/alice",
+		OrgID:      "o-master",
+		OrgMaster:  "000000000000",
+	}, s[0])
+
+	_, err := ctx.Match("all")
+	require.NoError(t, err)
+	s = ctx.Status()
+	assert.Equal(t, 2, s[0].Accounts)
+	assert.Equal(t, 2, s[0].ValidCreds)
+	assert.Equal(t, 0, s[0].ValidCtl)
+	assert.Equal(t, 2, s[0].Errors) // ErrNoCtl
+
+	ctx.acs["000000000001"].Err = nil
+	assert.Equal(t, 1, ctx.Status()[0].Errors)
+}
+
+func TestAuthModeString(t *testing.T) {
+	assert.Equal(t, "Unknown", Unknown.String())
+	assert.Equal(t, "WebIdentity", WebIdentity.String())
+	assert.Equal(t, "AuthMode(99)", AuthMode(99).String())
+	b, err := SAML.MarshalText()
+	assert.NoError(t, err)
+	assert.Equal(t, "SAML", string(b))
+}
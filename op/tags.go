@@ -6,9 +6,11 @@ import (
 	"strings"
 )
 
-// Tags that require special handling.
+// Tags that require special handling. The org name is only special in account
+// specs when followed by "=", so "org" remains available as a regular tag.
 const (
 	tagAll   = "all"
+	tagOrg   = "org"
 	tagOwner = "owner"
 )
 
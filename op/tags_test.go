@@ -31,6 +31,10 @@ func TestParseTags(t *testing.T) {
 		tags: "!d,c,!b,a",
 		set:  "a,c",
 		clr:  "b,d",
+	}, {
+		tags: tagOrg,
+		set:  tagOrg,
+		clr:  "",
 	}}
 	for _, test := range tests {
 		set, clr, err := ParseTags(test.tags)
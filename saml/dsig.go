@@ -0,0 +1,450 @@
+package saml
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// XML namespaces and algorithm identifiers used by SAML signatures.
+const (
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsDSig      = "http://www.w3.org/2000/09/xmldsig#"
+	nsXML       = "http://www.w3.org/XML/1998/namespace"
+
+	algExcC14N     = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algEnveloped   = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algSHA1        = "http://www.w3.org/2000/09/xmldsig#sha1"
+	algSHA256      = "http://www.w3.org/2001/04/xmlenc#sha256"
+	algRSASHA1     = "http://www.w3.org/2000/09/xmldsig#rsa-sha1"
+	algRSASHA256   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algECDSASHA256 = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256"
+)
+
+// Possible signature verification errors.
+var (
+	ErrNoSignature      = errors.New("saml: assertion is not signed")
+	ErrInvalidSignature = errors.New("saml: invalid assertion signature")
+	ErrInvalidDigest    = errors.New("saml: assertion digest mismatch")
+)
+
+// node is an element of a parsed XML document. Names are not resolved, so
+// prefix contains the namespace prefix as it appears in the document.
+type node struct {
+	parent   *node
+	prefix   string
+	local    string
+	ns       map[string]string // Namespace declarations (prefix -> URI)
+	attrs    []xml.Attr        // Other attributes (Name.Space is the prefix)
+	children []interface{}     // *node or xml.CharData
+}
+
+// parseDoc parses XML document b and returns its root element.
+func parseDoc(b []byte) (*node, error) {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	var root, cur *node
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &node{parent: cur, prefix: t.Name.Space, local: t.Name.Local}
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" || (a.Name.Space == "" &&
+					a.Name.Local == "xmlns") {
+					if n.ns == nil {
+						n.ns = make(map[string]string)
+					}
+					p := a.Name.Local
+					if a.Name.Space == "" {
+						p = ""
+					}
+					n.ns[p] = a.Value
+				} else {
+					n.attrs = append(n.attrs, a)
+				}
+			}
+			if cur != nil {
+				cur.children = append(cur.children, n)
+			} else if root != nil {
+				return nil, errors.New("saml: multiple root elements")
+			} else {
+				root = n
+			}
+			cur = n
+		case xml.EndElement:
+			if cur == nil || t.Name.Space != cur.prefix ||
+				t.Name.Local != cur.local {
+				return nil, errors.New("saml: mismatched end element")
+			}
+			cur = cur.parent
+		case xml.CharData:
+			if cur != nil {
+				cur.children = append(cur.children, t.Copy())
+			}
+		}
+	}
+	if root == nil || cur != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return root, nil
+}
+
+// lookupNS returns the namespace URI for the specified prefix.
+func (n *node) lookupNS(prefix string) string {
+	if prefix == "xml" {
+		return nsXML
+	}
+	for ; n != nil; n = n.parent {
+		if uri, ok := n.ns[prefix]; ok {
+			return uri
+		}
+	}
+	return ""
+}
+
+// attrNS returns the namespace URI for an attribute prefix. Unqualified
+// attributes do not have a namespace.
+func (n *node) attrNS(prefix string) string {
+	if prefix == "" {
+		return ""
+	}
+	return n.lookupNS(prefix)
+}
+
+// is returns true if n has the specified namespace and local name.
+func (n *node) is(space, local string) bool {
+	return n.local == local && n.lookupNS(n.prefix) == space
+}
+
+// attr returns the value of an unqualified attribute.
+func (n *node) attr(name string) string {
+	for _, a := range n.attrs {
+		if a.Name.Space == "" && a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// child returns the first child element with the specified name.
+func (n *node) child(space, local string) *node {
+	for _, c := range n.children {
+		if c, ok := c.(*node); ok && c.is(space, local) {
+			return c
+		}
+	}
+	return nil
+}
+
+// all returns all child elements with the specified name.
+func (n *node) all(space, local string) []*node {
+	var all []*node
+	for _, c := range n.children {
+		if c, ok := c.(*node); ok && c.is(space, local) {
+			all = append(all, c)
+		}
+	}
+	return all
+}
+
+// text returns the concatenated character data of n.
+func (n *node) text() string {
+	var b strings.Builder
+	for _, c := range n.children {
+		if c, ok := c.(xml.CharData); ok {
+			b.Write(c)
+		}
+	}
+	return b.String()
+}
+
+// walk calls fn for n and all of its descendants.
+func (n *node) walk(fn func(n *node)) {
+	fn(n)
+	for _, c := range n.children {
+		if c, ok := c.(*node); ok {
+			c.walk(fn)
+		}
+	}
+}
+
+// excC14N returns the exclusive canonical form (without comments) of the
+// subtree rooted at n, omitting the skip element. Prefixes in incl are treated
+// as specified by the InclusiveNamespaces PrefixList.
+func excC14N(n, skip *node, incl []string) []byte {
+	c := c14n{skip: skip}
+	if len(incl) > 0 {
+		c.incl = make(map[string]bool, len(incl))
+		for _, p := range incl {
+			if p == "#default" {
+				p = ""
+			}
+			c.incl[p] = true
+		}
+	}
+	c.elem(n, nil)
+	return c.buf.Bytes()
+}
+
+// c14n maintains canonicalization state.
+type c14n struct {
+	buf  bytes.Buffer
+	skip *node
+	incl map[string]bool
+}
+
+// elem writes element n. rendered contains namespace declarations that were
+// output by ancestors of n.
+func (c *c14n) elem(n *node, rendered map[string]string) {
+	used := map[string]bool{n.prefix: true}
+	for _, a := range n.attrs {
+		if a.Name.Space != "" {
+			used[a.Name.Space] = true
+		}
+	}
+	for p := range c.incl {
+		used[p] = true
+	}
+	var decl []string
+	for p := range used {
+		if p == "xml" {
+			continue
+		}
+		uri := n.lookupNS(p)
+		if old, ok := rendered[p]; ok && old == uri || !ok && uri == "" {
+			continue
+		}
+		decl = append(decl, p)
+	}
+	if len(decl) > 0 {
+		sort.Strings(decl)
+		next := make(map[string]string, len(rendered)+len(decl))
+		for p, uri := range rendered {
+			next[p] = uri
+		}
+		for _, p := range decl {
+			next[p] = n.lookupNS(p)
+		}
+		rendered = next
+	}
+	attrs := make([]xml.Attr, len(n.attrs))
+	copy(attrs, n.attrs)
+	sort.Slice(attrs, func(i, j int) bool {
+		a, b := &attrs[i].Name, &attrs[j].Name
+		if a.Space != b.Space {
+			return n.attrNS(a.Space) < n.attrNS(b.Space)
+		}
+		return a.Local < b.Local
+	})
+
+	c.buf.WriteByte('<')
+	c.name(n.prefix, n.local)
+	for _, p := range decl {
+		c.buf.WriteString(" xmlns")
+		if p != "" {
+			c.buf.WriteByte(':')
+			c.buf.WriteString(p)
+		}
+		c.buf.WriteString(`="`)
+		escape(&c.buf, rendered[p], true)
+		c.buf.WriteByte('"')
+	}
+	for _, a := range attrs {
+		c.buf.WriteByte(' ')
+		c.name(a.Name.Space, a.Name.Local)
+		c.buf.WriteString(`="`)
+		escape(&c.buf, a.Value, true)
+		c.buf.WriteByte('"')
+	}
+	c.buf.WriteByte('>')
+	for _, ch := range n.children {
+		switch ch := ch.(type) {
+		case *node:
+			if ch != c.skip {
+				c.elem(ch, rendered)
+			}
+		case xml.CharData:
+			escape(&c.buf, string(ch), false)
+		}
+	}
+	c.buf.WriteString("</")
+	c.name(n.prefix, n.local)
+	c.buf.WriteByte('>')
+}
+
+// name writes a qualified name.
+func (c *c14n) name(prefix, local string) {
+	if prefix != "" {
+		c.buf.WriteString(prefix)
+		c.buf.WriteByte(':')
+	}
+	c.buf.WriteString(local)
+}
+
+// escape writes s to b, escaping special characters as required for text or
+// attribute values.
+func escape(b *bytes.Buffer, s string, attr bool) {
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case ch == '&':
+			b.WriteString("&amp;")
+		case ch == '<':
+			b.WriteString("&lt;")
+		case ch == '>' && !attr:
+			b.WriteString("&gt;")
+		case ch == '"' && attr:
+			b.WriteString("&quot;")
+		case ch == '\t' && attr:
+			b.WriteString("&#x9;")
+		case ch == '\n' && attr:
+			b.WriteString("&#xA;")
+		case ch == '\r':
+			b.WriteString("&#xD;")
+		default:
+			b.WriteByte(ch)
+		}
+	}
+}
+
+// verifySig verifies the enveloped signature of element n using one of the
+// trusted certificates.
+func verifySig(n *node, certs []*x509.Certificate) error {
+	sig := n.child(nsDSig, "Signature")
+	if sig == nil {
+		return ErrNoSignature
+	}
+	si := sig.child(nsDSig, "SignedInfo")
+	if si == nil {
+		return ErrInvalidSignature
+	}
+	cm := si.child(nsDSig, "CanonicalizationMethod")
+	if cm == nil || cm.attr("Algorithm") != algExcC14N {
+		return errAlg("canonicalization", cm)
+	}
+	var algo x509.SignatureAlgorithm
+	switch sm := si.child(nsDSig, "SignatureMethod"); attrOf(sm, "Algorithm") {
+	case algRSASHA256:
+		algo = x509.SHA256WithRSA
+	case algRSASHA1:
+		algo = x509.SHA1WithRSA
+	case algECDSASHA256:
+		algo = x509.ECDSAWithSHA256
+	default:
+		return errAlg("signature", sm)
+	}
+
+	// Verify reference digest
+	refs := si.all(nsDSig, "Reference")
+	if len(refs) != 1 {
+		return ErrInvalidSignature
+	}
+	ref := refs[0]
+	if id := n.attr("ID"); id == "" || ref.attr("URI") != "#"+id {
+		return ErrInvalidSignature
+	}
+	var enveloped bool
+	var incl []string
+	if ts := ref.child(nsDSig, "Transforms"); ts != nil {
+		for _, t := range ts.all(nsDSig, "Transform") {
+			switch t.attr("Algorithm") {
+			case algEnveloped:
+				enveloped = true
+			case algExcC14N:
+				incl = prefixList(t)
+			default:
+				return errAlg("transform", t)
+			}
+		}
+	}
+	if !enveloped {
+		return ErrInvalidSignature
+	}
+	var h crypto.Hash
+	switch dm := ref.child(nsDSig, "DigestMethod"); attrOf(dm, "Algorithm") {
+	case algSHA256:
+		h = crypto.SHA256
+	case algSHA1:
+		h = crypto.SHA1
+	default:
+		return errAlg("digest", dm)
+	}
+	dv := ref.child(nsDSig, "DigestValue")
+	if dv == nil {
+		return ErrInvalidSignature
+	}
+	want, err := decodeB64(dv.text())
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	d := h.New()
+	d.Write(excC14N(n, sig, incl))
+	if !bytes.Equal(d.Sum(nil), want) {
+		return ErrInvalidDigest
+	}
+
+	// Verify SignedInfo signature
+	sv := sig.child(nsDSig, "SignatureValue")
+	if sv == nil {
+		return ErrInvalidSignature
+	}
+	val, err := decodeB64(sv.text())
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	signed := excC14N(si, nil, prefixList(cm))
+	for _, cert := range certs {
+		if cert.CheckSignature(algo, signed, val) == nil {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// prefixList returns the InclusiveNamespaces PrefixList of an exc-c14n
+// transform.
+func prefixList(t *node) []string {
+	for _, c := range t.children {
+		if c, ok := c.(*node); ok && c.is(algExcC14N, "InclusiveNamespaces") {
+			return strings.Fields(c.attr("PrefixList"))
+		}
+	}
+	return nil
+}
+
+// attrOf returns the value of an unqualified attribute of n, which may be nil.
+func attrOf(n *node, name string) string {
+	if n == nil {
+		return ""
+	}
+	return n.attr(name)
+}
+
+// errAlg returns an unsupported algorithm error.
+func errAlg(typ string, n *node) error {
+	return fmt.Errorf("saml: unsupported %s algorithm %q", typ,
+		attrOf(n, "Algorithm"))
+}
+
+// decodeB64 decodes base64 string s, ignoring any whitespace.
+func decodeB64(s string) ([]byte, error) {
+	s = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, s)
+	return base64.StdEncoding.DecodeString(s)
+}
@@ -0,0 +1,246 @@
+package saml
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mxk/go-cloud/aws/arn"
+	"github.com/mxk/go-fast"
+	"golang.org/x/net/html"
+)
+
+// Possible errors returned by FormIdP.
+var (
+	ErrNoLoginForm    = errors.New("saml: login form not found")
+	ErrAuthFailed     = errors.New("saml: authentication failed")
+	ErrSessionExpired = errors.New("saml: session expired")
+)
+
+// FormSessionTTL is the assumed lifetime of a FormIdP session. The actual
+// lifetime is controlled by the IdP and cannot be determined from cookies.
+var FormSessionTTL = time.Hour
+
+// FormIdP is a generic SAML IdP that authenticates the user by submitting an
+// HTML login form, such as the ones presented by Keycloak or ADFS for
+// IdP-initiated sign-on. LoginURL is requested to get the login form, and it is
+// usually the same as the AWS app URL. The session is maintained with cookies.
+type FormIdP struct {
+	LoginURL string
+	Client   *http.Client
+	Sess     FormSession
+}
+
+// FormSession contains session cookies for LoginURL.
+type FormSession struct {
+	Cookies   []*http.Cookie
+	ExpiresAt time.Time
+}
+
+// NewFormIdP returns a new form-based IdP client.
+func NewFormIdP(loginURL string) *FormIdP {
+	jar, _ := cookiejar.New(nil)
+	return &FormIdP{LoginURL: loginURL, Client: &http.Client{Jar: jar}}
+}
+
+// Authenticate submits user credentials to the IdP login form.
+func (f *FormIdP) Authenticate(authn Authenticator) error {
+	f.Sess = FormSession{}
+	u, err := url.Parse(f.LoginURL)
+	if err != nil {
+		return err
+	}
+	page, err := f.get(f.LoginURL)
+	if err != nil {
+		return err
+	}
+	login := page.loginForm()
+	if login == nil {
+		if page.saml == nil {
+			return ErrNoLoginForm
+		}
+	} else {
+		user, err := authn.Username()
+		if err != nil {
+			return err
+		}
+		pass, err := authn.Password()
+		if err != nil {
+			return err
+		}
+		login.vals.Set(login.user, user)
+		login.vals.Set(login.pass, pass)
+		rsp, err := f.Client.PostForm(login.action, login.vals)
+		if err != nil {
+			return err
+		}
+		if page, err = readPage(rsp); err != nil {
+			return err
+		}
+		if page.loginForm() != nil {
+			return ErrAuthFailed
+		}
+	}
+	f.Sess = FormSession{
+		Cookies:   f.Client.Jar.Cookies(u),
+		ExpiresAt: fast.Time().Add(FormSessionTTL),
+	}
+	return nil
+}
+
+// ValidSession returns true if the client has unexpired session cookies.
+func (f *FormIdP) ValidSession() bool {
+	return len(f.Sess.Cookies) > 0 && f.Sess.ExpiresAt.After(
+		fast.Time().Add(time.Minute))
+}
+
+// SetSession restores session s.
+func (f *FormIdP) SetSession(s FormSession) {
+	f.Sess = s
+	u, err := url.Parse(f.LoginURL)
+	if err != nil || f.Client.Jar == nil {
+		return
+	}
+	cookies := make([]*http.Cookie, len(s.Cookies))
+	for i, c := range s.Cookies {
+		cookies[i] = &http.Cookie{Name: c.Name, Value: c.Value, Path: "/"}
+	}
+	f.Client.Jar.SetCookies(u, cookies)
+}
+
+// OpenAWS returns SAML authentication data for the AWS app specified by
+// appLink. If role is specified, the matching AWS role is pre-selected.
+func (f *FormIdP) OpenAWS(appLink string, role arn.ARN) (*AWSAuth, error) {
+	page, err := f.get(appLink)
+	if err != nil {
+		return nil, err
+	}
+	if page.saml == nil {
+		if page.loginForm() != nil {
+			f.Sess = FormSession{}
+			return nil, ErrSessionExpired
+		}
+		return nil, ErrNoSAMLResponse
+	}
+	return NewAWSAuth(page.saml, role)
+}
+
+// get returns the page at the specified URL.
+func (f *FormIdP) get(u string) (*page, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html")
+	rsp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return readPage(rsp)
+}
+
+// page contains the relevant parts of an HTML page returned by the IdP.
+type page struct {
+	forms []*form
+	saml  Assertion
+}
+
+// form is an HTML form.
+type form struct {
+	action     string
+	vals       url.Values
+	user, pass string
+}
+
+// readPage parses the HTTP response body and closes it. Response size is
+// limited to 1 MB.
+func readPage(rsp *http.Response) (*page, error) {
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("saml: IdP error (%s)", rsp.Status)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(rsp.Body, 1024*1024))
+	if err != nil {
+		return nil, err
+	}
+	p := new(page)
+	if p.saml, err = FromHTML(bytes.NewReader(b)); err != nil {
+		if err != ErrNoSAMLResponse {
+			return nil, err
+		}
+		p.forms = parseForms(bytes.NewReader(b), rsp.Request.URL)
+	}
+	return p, nil
+}
+
+// loginForm returns the first form with a password input.
+func (p *page) loginForm() *form {
+	for _, f := range p.forms {
+		if f.pass != "" {
+			return f
+		}
+	}
+	return nil
+}
+
+// parseForms returns all forms in an HTML document. Form actions are resolved
+// relative to base. The first text or email input of each form is assumed to
+// be the username.
+func parseForms(r io.Reader, base *url.URL) []*form {
+	var all []*form
+	var cur *form
+	z := html.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return all
+		case html.EndTagToken:
+			if tag, _ := z.TagName(); string(tag) == "form" {
+				cur = nil
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tag, more := z.TagName()
+			attr := make(map[string]string)
+			for more {
+				var k, v []byte
+				k, v, more = z.TagAttr()
+				attr[string(k)] = string(v)
+			}
+			switch string(tag) {
+			case "form":
+				action := base
+				if u, err := base.Parse(attr["action"]); err == nil {
+					action = u
+				}
+				cur = &form{action: action.String(), vals: make(url.Values)}
+				all = append(all, cur)
+			case "input":
+				name := attr["name"]
+				if cur == nil || name == "" {
+					continue
+				}
+				switch strings.ToLower(attr["type"]) {
+				case "password":
+					if cur.pass == "" {
+						cur.pass = name
+					}
+				case "", "text", "email":
+					if cur.user == "" {
+						cur.user = name
+					}
+				case "hidden":
+				default:
+					continue
+				}
+				cur.vals.Set(name, attr["value"])
+			}
+		}
+	}
+}
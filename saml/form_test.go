@@ -0,0 +1,94 @@
+package saml
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/mxk/oktapus/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormIdP(t *testing.T) {
+	const app = "/auth/realms/test/protocol/saml/clients/amazon-aws"
+	f, s := newFormServer(app)
+	loginPage := func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("sess"); err == nil && c.Value == "ok" {
+			w.Write(samlResponse(assertion).Bytes())
+			return
+		}
+		w.Write([]byte(`<html><body>
+<form id="search" action="/search"><input name="q"></form>
+<form id="login" method="post" action="login-actions/authenticate?x=1">
+	<input type="text" name="username">
+	<input type="password" name="password">
+	<input type="hidden" name="csrf" value="token">
+	<input type="checkbox" name="rememberMe">
+	<input type="submit" value="Log In">
+</form>
+</body></html>`))
+	}
+	s.Response[app] = loginPage
+	s.Response["/auth/realms/test/protocol/saml/clients/login-actions/authenticate"] = func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "1", r.Form.Get("x"))
+		assert.Equal(t, "token", r.Form.Get("csrf"))
+		assert.Equal(t, "", r.Form.Get("q"))
+		if r.Form.Get("username") == "alice" && r.Form.Get("password") == "pass" {
+			http.SetCookie(w, &http.Cookie{Name: "sess", Value: "ok", Path: "/"})
+			w.Write(samlResponse(assertion).Bytes())
+			return
+		}
+		loginPage(w, r)
+	}
+
+	assert.False(t, f.ValidSession())
+	_, err := f.OpenAWS(f.LoginURL, "")
+	assert.Equal(t, ErrSessionExpired, err)
+
+	assert.Equal(t, ErrAuthFailed, f.Authenticate(&formAuthn{"alice", "bad"}))
+	assert.False(t, f.ValidSession())
+
+	require.NoError(t, f.Authenticate(&formAuthn{"alice", "pass"}))
+	assert.True(t, f.ValidSession())
+	auth, err := f.OpenAWS(f.LoginURL, "")
+	require.NoError(t, err)
+	assert.Equal(t, assertion, auth.Assertion)
+	assert.Len(t, auth.Roles, 1)
+
+	// Restore session into a new client
+	f2, s2 := newFormServer(app)
+	s2.Response = s.Response
+	f2.SetSession(f.Sess)
+	assert.True(t, f2.ValidSession())
+	auth, err = f2.OpenAWS(f.LoginURL, "")
+	require.NoError(t, err)
+	assert.Equal(t, assertion, auth.Assertion)
+
+	// Existing session
+	require.NoError(t, f.Authenticate(nil))
+	assert.True(t, f.ValidSession())
+
+	s.Response[app] = "{}"
+	assert.Equal(t, ErrNoLoginForm, f.Authenticate(nil))
+	_, err = f.OpenAWS(f.LoginURL, "")
+	assert.Equal(t, ErrNoSAMLResponse, err)
+}
+
+func newFormServer(path string) (*FormIdP, *mock.Server) {
+	f := NewFormIdP("https://localhost" + path)
+	c, s := mock.ClientServer()
+	f.Client.Transport = c.Transport
+	return f, s
+}
+
+var errNotImpl = errors.New("not implemented")
+
+type formAuthn struct{ user, pass string }
+
+func (a *formAuthn) Username() (string, error)              { return a.user, nil }
+func (a *formAuthn) Password() (string, error)              { return a.pass, nil }
+func (a *formAuthn) Select(c []Choice) (Choice, error)      { return nil, errNotImpl }
+func (a *formAuthn) Input(c Choice) (string, error)         { return "", errNotImpl }
+func (a *formAuthn) Notify(format string, v ...interface{}) {}
@@ -0,0 +1,33 @@
+package saml
+
+import "github.com/mxk/go-cloud/aws/arn"
+
+// IdP is a SAML identity provider that grants access to AWS.
+type IdP interface {
+	// Authenticate performs user authentication and creates a new session.
+	Authenticate(authn Authenticator) error
+
+	// ValidSession returns true if the client has a valid IdP session.
+	ValidSession() bool
+
+	// OpenAWS returns SAML authentication data for the AWS app specified by
+	// appLink. If role is specified, the matching AWS role is pre-selected.
+	OpenAWS(appLink string, role arn.ARN) (*AWSAuth, error)
+}
+
+// Authenticator implements the user interface for IdP authentication, including
+// multi-factor authentication.
+type Authenticator interface {
+	Username() (string, error)
+	Password() (string, error)
+	Select(c []Choice) (Choice, error)
+	Input(c Choice) (string, error)
+	Notify(format string, a ...interface{})
+}
+
+// Choice is a user-selectable item.
+type Choice interface {
+	Key() string
+	Value() string
+	Prompt() string
+}
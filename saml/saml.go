@@ -1,4 +1,6 @@
-package okta
+// Package saml implements SAML authentication to AWS that is independent of the
+// identity provider.
+package saml
 
 import (
 	"encoding/base64"
@@ -7,7 +9,9 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mxk/go-cloud/aws/arn"
 	"golang.org/x/net/html"
@@ -15,29 +19,38 @@ import (
 
 // Possible errors returned when parsing AWS SAML assertion.
 var (
-	ErrNoSAMLResponse = errors.New("okta: SAMLResponse form input not found")
-	ErrNoAWSRoles     = errors.New("okta: no AWS roles in SAML assertion")
-	ErrInvalidAWSRole = errors.New("okta: specified role is not available")
+	ErrNoSAMLResponse = errors.New("saml: SAMLResponse form input not found")
+	ErrNoAWSRoles     = errors.New("saml: no AWS roles in SAML assertion")
+	ErrInvalidAWSRole = errors.New("saml: specified role is not available")
 )
 
 // AWSAuth contains authentication data for AWS.
 type AWSAuth struct {
-	Assertion samlAssertion
-	Roles     []awsRole
+	Assertion Assertion
+	Roles     []AWSRole
+
+	// Requested role session duration from the SessionDuration attribute or
+	// zero if the attribute is not present.
+	SessionDuration time.Duration
 }
 
-// newAWSAuth returns a SAML-based AWS authenticator. If role is specified,
+// NewAWSAuth returns a SAML-based AWS authenticator. If role is specified,
 // Roles will only contain the matching role. If the role is not found, all
 // roles are returned with ErrInvalidAWSRole.
-func newAWSAuth(sa samlAssertion, role arn.ARN) (*AWSAuth, error) {
+func NewAWSAuth(sa Assertion, role arn.ARN) (*AWSAuth, error) {
 	attrs, err := sa.attrs()
 	if err != nil {
 		return nil, err
 	}
 	auth := &AWSAuth{Assertion: sa}
 	for _, at := range attrs {
-		if at.Name == "https://aws.amazon.com/SAML/Attributes/Role" {
+		switch at.Name {
+		case "https://aws.amazon.com/SAML/Attributes/Role":
 			auth.Roles, err = getRoles(at.Values, role)
+		case "https://aws.amazon.com/SAML/Attributes/SessionDuration":
+			auth.SessionDuration, err = getDuration(at.Values)
+		}
+		if err != nil {
 			break
 		}
 	}
@@ -51,19 +64,36 @@ func newAWSAuth(sa samlAssertion, role arn.ARN) (*AWSAuth, error) {
 	return auth, err
 }
 
-// awsRole represents one IdP/role ARN pair in the "Role" attribute.
-type awsRole struct{ Principal, Role arn.ARN }
+// AWSRole represents one IdP/role ARN pair in the "Role" attribute.
+type AWSRole struct{ Principal, Role arn.ARN }
+
+// Role returns the IdP/role pair for the specified role ARN. The first role is
+// returned if role is empty.
+func (a *AWSAuth) Role(role arn.ARN) (AWSRole, error) {
+	if role == "" && len(a.Roles) > 0 {
+		return a.Roles[0], nil
+	}
+	for _, r := range a.Roles {
+		if r.Role == role {
+			return r, nil
+		}
+	}
+	if len(a.Roles) == 0 {
+		return AWSRole{}, ErrNoAWSRoles
+	}
+	return AWSRole{}, ErrInvalidAWSRole
+}
 
 // getRoles extracts AWS roles from SAML attribute values.
-func getRoles(vals []string, match arn.ARN) ([]awsRole, error) {
-	roles := make([]awsRole, len(vals))
+func getRoles(vals []string, match arn.ARN) ([]AWSRole, error) {
+	roles := make([]AWSRole, len(vals))
 	for i, v := range vals {
 		r := &roles[i]
 		if j := strings.IndexByte(v, ','); j > 0 {
 			r.Principal, r.Role = arn.ARN(v[:j]), arn.ARN(v[j+1:])
 		}
 		if !r.Principal.Valid() || !r.Role.Valid() {
-			return nil, fmt.Errorf("okta: invalid AWS role in SAML (%s)", v)
+			return nil, fmt.Errorf("saml: invalid AWS role in SAML (%s)", v)
 		}
 		if r.Role.Type() == "saml-provider" {
 			r.Principal, r.Role = r.Role, r.Principal
@@ -75,13 +105,27 @@ func getRoles(vals []string, match arn.ARN) ([]awsRole, error) {
 	return roles, nil
 }
 
-// samlAssertion is a SAML assertion in its decoded XML form.
-type samlAssertion []byte
+// getDuration extracts session duration from SAML attribute values.
+func getDuration(vals []string) (time.Duration, error) {
+	if len(vals) != 1 {
+		return 0, fmt.Errorf("saml: invalid AWS session duration in SAML (%s)",
+			strings.Join(vals, ", "))
+	}
+	sec, err := strconv.ParseUint(strings.TrimSpace(vals[0]), 10, 32)
+	if err != nil || sec == 0 {
+		return 0, fmt.Errorf("saml: invalid AWS session duration in SAML (%s)",
+			vals[0])
+	}
+	return time.Duration(sec) * time.Second, nil
+}
+
+// Assertion is a SAML assertion in its decoded XML form.
+type Assertion []byte
 
-// samlAssertionFromHTML returns the decoded SAMLResponse form input from Okta's
-// SSO response. This is apparently the official and only way of getting a SAML
+// FromHTML returns the decoded SAMLResponse form input from an IdP's SSO
+// response. This is apparently the official and only way of getting a SAML
 // assertion from Okta (as used by their okta-aws-cli-assume-role tool).
-func samlAssertionFromHTML(r io.Reader) (samlAssertion, error) {
+func FromHTML(r io.Reader) (Assertion, error) {
 	// Response size is limited to 1 MB. The reader is fully drained at the end
 	// because the tokenizer stops scanning once SAMLResponse is found.
 	if _, ok := r.(*io.LimitedReader); !ok {
@@ -130,7 +174,7 @@ func samlAssertionFromHTML(r io.Reader) (samlAssertion, error) {
 }
 
 // Encode returns the base64 encoding of SAML assertion sa.
-func (sa samlAssertion) Encode() string {
+func (sa Assertion) Encode() string {
 	return base64.StdEncoding.EncodeToString(sa)
 }
 
@@ -141,7 +185,7 @@ type samlAttr struct {
 }
 
 // attrs returns all attributes from SAML assertion sa.
-func (sa samlAssertion) attrs() ([]*samlAttr, error) {
+func (sa Assertion) attrs() ([]*samlAttr, error) {
 	var assert struct {
 		Attrs []*samlAttr `xml:"Assertion>AttributeStatement>Attribute"`
 	}
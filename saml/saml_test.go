@@ -1,28 +1,41 @@
-package okta
+package saml
 
 import (
 	"bytes"
 	"encoding/base64"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestNewAWSAuth(t *testing.T) {
-	auth, err := newAWSAuth(samlAssertion(assertion), "")
+	auth, err := NewAWSAuth(Assertion(assertion), "")
 	require.NoError(t, err)
 	want := &AWSAuth{
 		Assertion: assertion,
-		Roles: []awsRole{{
+		Roles: []AWSRole{{
 			Principal: "arn:aws:iam::000000000000:saml-provider/Okta",
 			Role:      "arn:aws:iam::000000000000:role/OktapusGateway",
 		}},
+		SessionDuration: 12 * time.Hour,
 	}
 	assert.Equal(t, want, auth)
 
-	_, err = newAWSAuth(samlAssertion(assertion), "InvalidRole")
+	_, err = NewAWSAuth(Assertion(assertion), "InvalidRole")
 	assert.Equal(t, ErrInvalidAWSRole, err)
+
+	r, err := auth.Role("")
+	require.NoError(t, err)
+	assert.Equal(t, want.Roles[0], r)
+	r, err = auth.Role(want.Roles[0].Role)
+	require.NoError(t, err)
+	assert.Equal(t, want.Roles[0], r)
+	_, err = auth.Role("arn:aws:iam::000000000000:role/Other")
+	assert.Equal(t, ErrInvalidAWSRole, err)
+	_, err = new(AWSAuth).Role("")
+	assert.Equal(t, ErrNoAWSRoles, err)
 }
 
 func TestGetRoles(t *testing.T) {
@@ -32,7 +45,7 @@ func TestGetRoles(t *testing.T) {
 	}
 	r, err := getRoles(in, "")
 	require.NoError(t, err)
-	want := []awsRole{{
+	want := []AWSRole{{
 		Principal: "arn:aws:iam::000000000000:saml-provider/Okta",
 		Role:      "arn:aws:iam::000000000000:role/Role1",
 	}, {
@@ -46,8 +59,18 @@ func TestGetRoles(t *testing.T) {
 	assert.Equal(t, want[1:], r)
 }
 
+func TestGetDuration(t *testing.T) {
+	d, err := getDuration([]string{" 3600\n"})
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, d)
+	for _, v := range [][]string{nil, {"1h"}, {"0"}, {"-1"}, {"900", "3600"}} {
+		_, err = getDuration(v)
+		assert.Error(t, err, "%q", v)
+	}
+}
+
 func TestSAMLParser(t *testing.T) {
-	sa, err := samlAssertionFromHTML(samlResponse(assertion))
+	sa, err := FromHTML(samlResponse(assertion))
 	require.NoError(t, err)
 	require.Equal(t, assertion, sa)
 	attrs, err := sa.attrs()
@@ -66,13 +89,13 @@ func TestSAMLParser(t *testing.T) {
 }
 
 func TestSAMLParserError(t *testing.T) {
-	_, err := samlAssertionFromHTML(bytes.NewReader(nil))
+	_, err := FromHTML(bytes.NewReader(nil))
 	require.Equal(t, ErrNoSAMLResponse, err)
-	_, err = samlAssertionFromHTML(samlResponse(nil))
+	_, err = FromHTML(samlResponse(nil))
 	require.Equal(t, ErrNoSAMLResponse, err)
 }
 
-var assertion = samlAssertion(`<?xml version="1.0" encoding="UTF-8"?>
+var assertion = Assertion(`<?xml version="1.0" encoding="UTF-8"?>
 <Response>
 <Assertion>
 <AttributeStatement>
@@ -89,7 +112,7 @@ var assertion = samlAssertion(`<?xml version="1.0" encoding="UTF-8"?>
 </Assertion>
 </Response>`)
 
-func samlResponse(assertion samlAssertion) *bytes.Buffer {
+func samlResponse(assertion Assertion) *bytes.Buffer {
 	var buf bytes.Buffer
 	buf.WriteString("<!DOCTYPE html><html><head></head><body><form>" +
 		`<input name="SAMLResponse" type="hidden" value="`)
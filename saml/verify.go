@@ -0,0 +1,210 @@
+package saml
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mxk/go-fast"
+)
+
+// AWSAudience is the SAML audience of the AWS service provider.
+const AWSAudience = "urn:amazon:webservices"
+
+// Possible assertion validation errors.
+var (
+	ErrNoAssertion        = errors.New("saml: assertion not found")
+	ErrMultipleAssertions = errors.New("saml: multiple assertions in response")
+	ErrEncryptedAssertion = errors.New("saml: encrypted assertions are not supported")
+)
+
+// Verifier checks SAML assertions before they are sent to AWS.
+type Verifier struct {
+	// Trusted IdP signing certificates. The signature is not verified if this
+	// is empty.
+	Certs []*x509.Certificate
+
+	// Required audience. AWSAudience is used if this is empty.
+	Audience string
+
+	// Maximum allowed difference between local and IdP clocks.
+	Skew time.Duration
+}
+
+// Verify validates assertion signature, audience, and validity window. The
+// signature may cover either the entire response or just the assertion.
+func (v *Verifier) Verify(sa Assertion) error {
+	root, err := parseDoc(sa)
+	if err != nil {
+		return fmt.Errorf("saml: invalid assertion xml (%v)", err)
+	}
+	a := root
+	if root.is(nsProtocol, "Response") {
+		// Attributes are extracted by local name, so any other element named
+		// "Assertion" is rejected.
+		var all []*node
+		for _, c := range root.children {
+			if c, ok := c.(*node); ok && c.local == "Assertion" {
+				all = append(all, c)
+			}
+		}
+		if len(all) == 0 {
+			if root.child(nsAssertion, "EncryptedAssertion") != nil {
+				return ErrEncryptedAssertion
+			}
+			return ErrNoAssertion
+		} else if len(all) > 1 {
+			return ErrMultipleAssertions
+		} else if a = all[0]; !a.is(nsAssertion, "Assertion") {
+			return ErrNoAssertion
+		}
+	} else if !root.is(nsAssertion, "Assertion") {
+		return ErrNoAssertion
+	}
+	if len(v.Certs) > 0 {
+		if err = v.verifySig(root, a); err != nil {
+			return err
+		}
+	}
+	return v.verifyConditions(a)
+}
+
+// verifySig verifies the response or assertion signature.
+func (v *Verifier) verifySig(root, a *node) error {
+	ids := make(map[string]int)
+	root.walk(func(n *node) {
+		if id := n.attr("ID"); id != "" {
+			ids[id]++
+		}
+	})
+	for id, n := range ids {
+		if n > 1 {
+			return fmt.Errorf("saml: duplicate element ID %q", id)
+		}
+	}
+	err := ErrNoSignature
+	if root != a {
+		if err = verifySig(root, v.Certs); err == nil {
+			return nil
+		}
+	}
+	if err == ErrNoSignature {
+		err = verifySig(a, v.Certs)
+	}
+	return err
+}
+
+// verifyConditions checks assertion audience and validity window.
+func (v *Verifier) verifyConditions(a *node) error {
+	c := a.child(nsAssertion, "Conditions")
+	if c == nil {
+		return errors.New("saml: assertion conditions not found")
+	}
+	now := fast.Time()
+	if t, err := parseTime(c.attr("NotBefore")); err != nil {
+		return err
+	} else if !t.IsZero() && now.Add(v.Skew).Before(t) {
+		return fmt.Errorf("saml: assertion not valid until %s, "+
+			"check for clock skew (local time is %s)", t.Format(time.RFC3339),
+			now.Format(time.RFC3339))
+	}
+	if t, err := parseTime(c.attr("NotOnOrAfter")); err != nil {
+		return err
+	} else if !t.IsZero() && !now.Add(-v.Skew).Before(t) {
+		return fmt.Errorf("saml: assertion expired at %s (local time is %s)",
+			t.Format(time.RFC3339), now.Format(time.RFC3339))
+	}
+	aud := v.Audience
+	if aud == "" {
+		aud = AWSAudience
+	}
+	ars := c.all(nsAssertion, "AudienceRestriction")
+	if len(ars) == 0 {
+		return errors.New("saml: assertion audience not specified")
+	}
+	for _, ar := range ars {
+		ok := false
+		for _, n := range ar.all(nsAssertion, "Audience") {
+			if ok = n.text() == aud; ok {
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("saml: assertion audience is not %s", aud)
+		}
+	}
+	return nil
+}
+
+// parseTime parses an xs:dateTime attribute value, which may be empty.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		err = fmt.Errorf("saml: invalid time %q", s)
+	}
+	return t, err
+}
+
+// PEMCerts returns all certificates in PEM-encoded data b.
+func PEMCerts(b []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var blk *pem.Block
+		if blk, b = pem.Decode(b); blk == nil {
+			break
+		}
+		if blk.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(blk.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("saml: no certificates found")
+	}
+	return certs, nil
+}
+
+// MetadataCerts returns IdP signing certificates from SAML metadata b.
+func MetadataCerts(b []byte) ([]*x509.Certificate, error) {
+	const nsMD = "urn:oasis:names:tc:SAML:2.0:metadata"
+	root, err := parseDoc(b)
+	if err != nil {
+		return nil, fmt.Errorf("saml: invalid metadata xml (%v)", err)
+	}
+	var certs []*x509.Certificate
+	root.walk(func(n *node) {
+		if err != nil || !n.is(nsMD, "IDPSSODescriptor") {
+			return
+		}
+		for _, kd := range n.all(nsMD, "KeyDescriptor") {
+			if use := kd.attr("use"); use != "" && use != "signing" {
+				continue
+			}
+			kd.walk(func(n *node) {
+				if err != nil || !n.is(nsDSig, "X509Certificate") {
+					return
+				}
+				var der []byte
+				var cert *x509.Certificate
+				if der, err = decodeB64(n.text()); err == nil {
+					if cert, err = x509.ParseCertificate(der); err == nil {
+						certs = append(certs, cert)
+					}
+				}
+			})
+		}
+	})
+	if err == nil && len(certs) == 0 {
+		err = errors.New("saml: no signing certificates in metadata")
+	}
+	return certs, err
+}
@@ -0,0 +1,268 @@
+package saml
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mxk/go-fast"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExcC14N(t *testing.T) {
+	doc := `<?xml version="1.0"?>
+<a:r xmlns:a="urn:a" xmlns:b="urn:b" xmlns="urn:d" xmlns:x="urn:x"><!-- c -->
+<a:x b:y="1" z="2&#9;"><c xmlns="urn:d">t&amp;&lt;&gt;"</c><e xmlns=""/><x:f/></a:x></a:r>`
+	root, err := parseDoc([]byte(doc))
+	require.NoError(t, err)
+	x := root.children[1].(*node)
+	want := `<a:x xmlns:a="urn:a" xmlns:b="urn:b" z="2&#x9;" b:y="1">` +
+		`<c xmlns="urn:d">t&amp;&lt;&gt;"</c><e></e>` +
+		`<x:f xmlns:x="urn:x"></x:f></a:x>`
+	assert.Equal(t, want, string(excC14N(x, nil, nil)))
+
+	want = `<a:x xmlns="urn:d" xmlns:a="urn:a" xmlns:b="urn:b" xmlns:x="urn:x" ` +
+		`z="2&#x9;" b:y="1"><c>t&amp;&lt;&gt;"</c><e xmlns=""></e>` +
+		`<x:f></x:f></a:x>`
+	assert.Equal(t, want, string(excC14N(x, nil, []string{"#default", "x"})))
+
+	f := x.children[2].(*node)
+	want = `<a:x xmlns:a="urn:a" xmlns:b="urn:b" z="2&#x9;" b:y="1">` +
+		`<c xmlns="urn:d">t&amp;&lt;&gt;"</c><e></e></a:x>`
+	assert.Equal(t, want, string(excC14N(x, f, nil)))
+}
+
+func TestVerify(t *testing.T) {
+	key, cert := newCert(t)
+	now := time.Now().UTC()
+	doc := testResponse(now.Add(-time.Minute), now.Add(5*time.Minute),
+		AWSAudience)
+
+	// Unsigned
+	var v Verifier
+	assert.NoError(t, v.Verify(Assertion(doc)))
+	v.Certs = []*x509.Certificate{cert}
+	assert.Equal(t, ErrNoSignature, v.Verify(Assertion(doc)))
+
+	// Signed assertion
+	signed := sign(t, doc, "assertion", key)
+	assert.NoError(t, v.Verify(signed))
+	auth, err := NewAWSAuth(signed, "")
+	require.NoError(t, err)
+	assert.Len(t, auth.Roles, 1)
+
+	// Signed response
+	assert.NoError(t, v.Verify(sign(t, doc, "response", key)))
+
+	// Modified assertion
+	bad := strings.Replace(string(signed), "Role1", "Role2", 1)
+	assert.Equal(t, ErrInvalidDigest, v.Verify(Assertion(bad)))
+
+	// Wrong certificate
+	_, other := newCert(t)
+	v.Certs = []*x509.Certificate{other}
+	assert.Equal(t, ErrInvalidSignature, v.Verify(signed))
+	v.Certs = []*x509.Certificate{other, cert}
+	assert.NoError(t, v.Verify(signed))
+
+	// Signature wrapping
+	wrapped := strings.Replace(string(signed), "</samlp:Response>",
+		`<Assertion xmlns="urn:evil"/></samlp:Response>`, 1)
+	assert.Equal(t, ErrMultipleAssertions, v.Verify(Assertion(wrapped)))
+	dup := strings.Replace(string(signed), `<saml:Subject>`,
+		`<saml:Subject ID="assertion">`, 1)
+	assert.EqualError(t, v.Verify(Assertion(dup)),
+		`saml: duplicate element ID "assertion"`)
+
+	// Conditions
+	v.Certs = nil
+	err = v.Verify(Assertion(testResponse(now.Add(-10*time.Minute),
+		now.Add(-5*time.Minute), AWSAudience)))
+	assert.Contains(t, err.Error(), "saml: assertion expired at ")
+	err = v.Verify(Assertion(testResponse(now.Add(5*time.Minute),
+		now.Add(10*time.Minute), AWSAudience)))
+	assert.Contains(t, err.Error(), "check for clock skew")
+	v.Skew = 10 * time.Minute
+	assert.NoError(t, v.Verify(Assertion(testResponse(now.Add(5*time.Minute),
+		now.Add(10*time.Minute), AWSAudience))))
+	err = v.Verify(Assertion(testResponse(now, now.Add(time.Minute),
+		"urn:other")))
+	assert.EqualError(t, err,
+		"saml: assertion audience is not urn:amazon:webservices")
+}
+
+func TestVerifyDSig(t *testing.T) {
+	key, cert := newCert(t)
+	now := time.Now().UTC()
+	doc := testResponse(now.Add(-time.Minute), now.Add(5*time.Minute),
+		AWSAudience)
+	signed := string(sign(t, doc, "assertion", key))
+	v := Verifier{Certs: []*x509.Certificate{cert}}
+	require.NoError(t, v.Verify(Assertion(signed)))
+
+	// Reference URI must match the element that contains the signature
+	bad := strings.Replace(signed, `URI="#assertion"`, `URI="#response"`, 1)
+	assert.Equal(t, ErrInvalidSignature, v.Verify(Assertion(bad)))
+
+	// Signed assertion moved out of the way of a forged one that carries a
+	// copy of its signature
+	i := strings.Index(signed, "<saml:Assertion")
+	j := strings.Index(signed, "</saml:Assertion>") + len("</saml:Assertion>")
+	orig := signed[i:j]
+	forged := strings.Replace(orig, `ID="assertion"`, `ID="evil"`, 1)
+	forged = strings.Replace(forged, "Role1", "Role2", 1)
+	bad = signed[:i] + forged + "<samlp:Extensions>" + orig +
+		"</samlp:Extensions>" + signed[j:]
+	assert.Equal(t, ErrInvalidSignature, v.Verify(Assertion(bad)))
+
+	// Comments are not part of the digest, but they must not truncate values
+	bad = strings.Replace(signed, "role/Role1", "role/Ro<!-- x -->le1", 1)
+	require.NoError(t, v.Verify(Assertion(bad)))
+	auth, err := NewAWSAuth(Assertion(bad), "")
+	require.NoError(t, err)
+	assert.Equal(t, "arn:aws:iam::000000000000:role/Role1",
+		string(auth.Roles[0].Role))
+
+	// Whitespace within tags is normalized, but not in character data
+	bad = strings.Replace(signed, `Version="2.0">`, `Version = "2.0" >`, -1)
+	assert.NoError(t, v.Verify(Assertion(bad)))
+	bad = strings.Replace(signed, "<saml:NameID>", "<saml:NameID> ", 1)
+	assert.Equal(t, ErrInvalidDigest, v.Verify(Assertion(bad)))
+}
+
+// TestVerifyOneLogin verifies an actual response from OneLogin, which checks
+// c14n and signature validation against an independent implementation.
+func TestVerifyOneLogin(t *testing.T) {
+	b64, err := ioutil.ReadFile("testdata/onelogin_response.b64")
+	require.NoError(t, err)
+	doc, err := base64.StdEncoding.DecodeString(string(b64))
+	require.NoError(t, err)
+	md, err := ioutil.ReadFile("testdata/onelogin_metadata.xml")
+	require.NoError(t, err)
+	certs, err := MetadataCerts(md)
+	require.NoError(t, err)
+
+	fast.MockTime(time.Date(2016, 1, 5, 17, 53, 12, 0, time.UTC))
+	defer fast.MockTime(time.Time{})
+	v := Verifier{
+		Certs:    certs,
+		Audience: "https://29ee6d2e.ngrok.io/saml/metadata",
+	}
+	assert.NoError(t, v.Verify(Assertion(doc)))
+
+	bad := strings.Replace(string(doc), "ross@kndr.org", "evil@kndr.org", 1)
+	assert.Equal(t, ErrInvalidDigest, v.Verify(Assertion(bad)))
+
+	_, other := newCert(t)
+	v.Certs = []*x509.Certificate{other}
+	assert.Equal(t, ErrInvalidSignature, v.Verify(Assertion(doc)))
+}
+
+func TestCerts(t *testing.T) {
+	_, cert := newCert(t)
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	certs, err := PEMCerts(b)
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{cert}, certs)
+	_, err = PEMCerts(nil)
+	assert.Error(t, err)
+
+	md := `<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="idp">
+<md:IDPSSODescriptor>
+<md:KeyDescriptor use="encryption"><ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:X509Data><ds:X509Certificate>invalid</ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor>
+<md:KeyDescriptor use="signing"><ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:X509Data><ds:X509Certificate>
+` + base64.StdEncoding.EncodeToString(cert.Raw) + `
+</ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor>
+</md:IDPSSODescriptor>
+</md:EntityDescriptor>`
+	certs, err = MetadataCerts([]byte(md))
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{cert}, certs)
+}
+
+func testResponse(notBefore, notOnOrAfter time.Time, aud string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="response" Version="2.0">{sig:response}
+<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" xmlns:xs="http://www.w3.org/2001/XMLSchema" ID="assertion" Version="2.0">{sig:assertion}
+<saml:Subject><saml:NameID>user@example.com</saml:NameID></saml:Subject>
+<saml:Conditions NotBefore="` + notBefore.Format(time.RFC3339) + `" NotOnOrAfter="` + notOnOrAfter.Format(time.RFC3339Nano) + `">
+<saml:AudienceRestriction><saml:Audience>` + aud + `</saml:Audience></saml:AudienceRestriction>
+</saml:Conditions>
+<saml:AttributeStatement>
+<saml:Attribute Name="https://aws.amazon.com/SAML/Attributes/Role">
+<saml:AttributeValue xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="xs:string">arn:aws:iam::000000000000:saml-provider/IdP,arn:aws:iam::000000000000:role/Role1</saml:AttributeValue>
+</saml:Attribute>
+</saml:AttributeStatement>
+</saml:Assertion>
+</samlp:Response>`
+}
+
+// sign creates an enveloped signature for the element with the specified ID.
+// The signature is inserted in place of the "{sig:<id>}" marker.
+func sign(t *testing.T, doc, id string, key *rsa.PrivateKey) Assertion {
+	unsigned := doc
+	for _, m := range []string{"{sig:response}", "{sig:assertion}"} {
+		unsigned = strings.Replace(unsigned, m, "", 1)
+	}
+	root, err := parseDoc([]byte(unsigned))
+	require.NoError(t, err)
+	var n *node
+	root.walk(func(e *node) {
+		if e.attr("ID") == id {
+			n = e
+		}
+	})
+	require.NotNil(t, n)
+	digest := sha256.Sum256(excC14N(n, nil, []string{"xs"}))
+	si := `<ds:SignedInfo>` +
+		`<ds:CanonicalizationMethod Algorithm="` + algExcC14N + `"/>` +
+		`<ds:SignatureMethod Algorithm="` + algRSASHA256 + `"/>` +
+		`<ds:Reference URI="#` + id + `"><ds:Transforms>` +
+		`<ds:Transform Algorithm="` + algEnveloped + `"/>` +
+		`<ds:Transform Algorithm="` + algExcC14N + `">` +
+		`<ec:InclusiveNamespaces xmlns:ec="` + algExcC14N + `" PrefixList="xs"/>` +
+		`</ds:Transform></ds:Transforms>` +
+		`<ds:DigestMethod Algorithm="` + algSHA256 + `"/>` +
+		`<ds:DigestValue>` + base64.StdEncoding.EncodeToString(digest[:]) +
+		`</ds:DigestValue></ds:Reference></ds:SignedInfo>`
+	sig, err := parseDoc([]byte(`<ds:Signature xmlns:ds="` + nsDSig + `">` +
+		si + `</ds:Signature>`))
+	require.NoError(t, err)
+	h := sha256.Sum256(excC14N(sig.children[0].(*node), nil, nil))
+	val, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h[:])
+	require.NoError(t, err)
+	s := `<ds:Signature xmlns:ds="` + nsDSig + `">` + si + `<ds:SignatureValue>` +
+		base64.StdEncoding.EncodeToString(val) + `</ds:SignatureValue></ds:Signature>`
+	doc = strings.Replace(doc, "{sig:"+id+"}", s, 1)
+	for _, m := range []string{"{sig:response}", "{sig:assertion}"} {
+		doc = strings.Replace(doc, m, "", 1)
+	}
+	return Assertion(doc)
+}
+
+func newCert(t *testing.T) (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return key, cert
+}
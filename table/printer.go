@@ -34,6 +34,7 @@ type Col struct {
 	Name       string
 	Width      int
 	FixedWidth bool
+	OmitEmpty  bool
 }
 
 // NewPrinter creates a table layout printer for v. The only currently supported
@@ -197,6 +198,9 @@ func (c *Col) parseTags(tags string) bool {
 			}
 		} else if next == "last" {
 			last = true
+		} else if next == "omitempty" {
+			c.OmitEmpty = true
+			c.Width = 0
 		} else if w := strings.TrimPrefix(next, "width="); w != next {
 			if i, _ := strconv.Atoi(w); i <= 0 || c.Width < i {
 				c.Width = i
@@ -207,12 +211,16 @@ func (c *Col) parseTags(tags string) bool {
 	return last
 }
 
-// calcWidths is a PrintRowFunc that calculates column widths.
+// calcWidths is a PrintRowFunc that calculates column widths. Columns with the
+// omitempty option keep zero width until a non-empty value is found.
 func calcWidths(p *Printer, row interface{}) {
 	v := reflect.ValueOf(row).Elem()
 	for i := range p.Cols {
 		if c := &p.Cols[i]; !c.FixedWidth {
 			if n := len(valStr(v.Field(i))); c.Width < n {
+				if c.Width == 0 && n < len(c.Name) {
+					n = len(c.Name)
+				}
 				c.Width = n
 			}
 		}
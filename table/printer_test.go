@@ -184,6 +184,34 @@ func TestPrinter(t *testing.T) {
 				.  123
 				d  4567
 			`),
+		}, {
+			in: []*struct {
+				A string
+				B string `printer:",omitempty"`
+				C string
+			}{
+				{"a", "", "c"},
+			},
+			out: table(`
+				A  C
+				-  -
+				a  c
+			`),
+		}, {
+			in: []*struct {
+				A   string
+				BCD string `printer:",omitempty"`
+				E   string
+			}{
+				{"a", "", "e"},
+				{"a", "b", "e"},
+			},
+			out: table(`
+				A  BCD  E
+				-  ---  -
+				a       e
+				a  b    e
+			`),
 		},
 	}
 	var buf bytes.Buffer
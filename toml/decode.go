@@ -0,0 +1,179 @@
+package toml
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Decode stores table values in the struct pointed to by v. Struct fields are
+// matched to keys using "toml" field tags. Embedded structs are decoded using
+// the same table. Unknown keys are reported as errors. Duration values are
+// specified as strings (e.g. "1h30m").
+func (t Table) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		panic("toml: decode target must be a struct pointer")
+	}
+	return decodeStruct("", t, rv.Elem())
+}
+
+// decodeStruct decodes table t into struct value v.
+func decodeStruct(path string, t Table, v reflect.Value) error {
+	known := make(map[string]bool, len(t))
+	if err := decodeFields(path, t, v, known); err != nil {
+		return err
+	}
+	for k := range t {
+		if !known[k] {
+			return fmt.Errorf("toml: unknown key %q", join(path, k))
+		}
+	}
+	return nil
+}
+
+// decodeFields decodes all tagged fields of struct v, recording matched keys.
+func decodeFields(path string, t Table, v reflect.Value, known map[string]bool) error {
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		key := f.Tag.Get("toml")
+		if key == "" {
+			if f.Anonymous && f.Type.Kind() == reflect.Struct {
+				err := decodeFields(path, t, v.Field(i), known)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if key == "-" {
+			continue
+		}
+		known[key] = true
+		if val, ok := t[key]; ok {
+			if err := decodeValue(join(path, key), val, v.Field(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// decodeValue stores val in v.
+func decodeValue(path string, val interface{}, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.String:
+		if s, ok := val.(string); ok {
+			v.SetString(s)
+			return nil
+		}
+	case reflect.Bool:
+		if b, ok := val.(bool); ok {
+			v.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == durationType {
+			s, ok := val.(string)
+			if !ok {
+				break
+			}
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return fmt.Errorf("toml: invalid duration for %q", path)
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		if i, ok := val.(int64); ok {
+			if v.OverflowInt(i) {
+				return fmt.Errorf("toml: value out of range for %q", path)
+			}
+			v.SetInt(i)
+			return nil
+		}
+	case reflect.Slice:
+		rv := reflect.ValueOf(val)
+		if rv.Kind() != reflect.Slice {
+			break
+		}
+		s := reflect.MakeSlice(v.Type(), rv.Len(), rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			if err := decodeValue(p, rv.Index(i).Interface(), s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	case reflect.Map:
+		t, ok := val.(Table)
+		if !ok || v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for k, val := range t {
+			mk := reflect.ValueOf(k).Convert(v.Type().Key())
+			e := reflect.New(v.Type().Elem()).Elem()
+			if old := v.MapIndex(mk); old.IsValid() {
+				e.Set(old)
+			}
+			if err := decodeValue(join(path, k), val, e); err != nil {
+				return err
+			}
+			v.SetMapIndex(mk, e)
+		}
+		return nil
+	case reflect.Struct:
+		if t, ok := val.(Table); ok {
+			return decodeStruct(path, t, v)
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeValue(path, val, v.Elem())
+	case reflect.Interface:
+		if v.NumMethod() == 0 {
+			v.Set(reflect.ValueOf(val))
+			return nil
+		}
+	}
+	return fmt.Errorf("toml: invalid %s value for %q", typeName(val), path)
+}
+
+// typeName returns the TOML type name of val.
+func typeName(val interface{}) string {
+	switch val.(type) {
+	case string:
+		return "string"
+	case int64:
+		return "integer"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case Table:
+		return "table"
+	case []Table:
+		return "table array"
+	}
+	return reflect.TypeOf(val).String()
+}
+
+// join returns a dotted key path.
+func join(path, key string) string {
+	if strings.ContainsAny(key, ". ") {
+		key = fmt.Sprintf("%q", key)
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,443 @@
+// Package toml implements the subset of TOML v0.5 that is needed for oktapus
+// config files. Supported values are strings, decimal integers, booleans,
+// arrays, and tables (standard, inline, and arrays of tables). Floats, dates,
+// hex/octal/binary integers, and multi-line strings are not supported.
+package toml
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Table is a collection of key/value pairs. Values have one of the following
+// types: string, int64, bool, []interface{}, Table, or []Table.
+type Table map[string]interface{}
+
+// Load parses the specified file.
+func Load(file string) (Table, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	t, err := Parse(b)
+	if err != nil {
+		err = fmt.Errorf("%v (%s)", err, file)
+	}
+	return t, err
+}
+
+// Parse parses TOML document b.
+func Parse(b []byte) (Table, error) {
+	p := parser{b: b, ln: 1, defined: make(map[uintptr]bool)}
+	root := make(Table)
+	cur := root
+	for p.skipSpace(true); p.i < len(p.b); p.skipSpace(true) {
+		var err error
+		if p.peek() == '[' {
+			cur, err = p.header(root)
+		} else {
+			err = p.keyVal(cur)
+		}
+		if err == nil {
+			err = p.endLine()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return root, nil
+}
+
+// Table returns the sub-table with the specified key or nil if the key does not
+// exist or refers to a value of a different type.
+func (t Table) Table(key string) Table {
+	v, _ := t[key].(Table)
+	return v
+}
+
+// parser maintains document parsing state.
+type parser struct {
+	b  []byte
+	i  int
+	ln int
+
+	// Tables defined by a header or an inline table. Tables that were only
+	// created implicitly as parents of other tables may still be defined once.
+	defined map[uintptr]bool
+}
+
+// define marks table t as defined and returns false if it already was.
+func (p *parser) define(t Table) bool {
+	id := reflect.ValueOf(t).Pointer()
+	if p.defined[id] {
+		return false
+	}
+	p.defined[id] = true
+	return true
+}
+
+// errorf returns a new error annotated with the current line number.
+func (p *parser) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("toml: line %d: %s", p.ln, fmt.Sprintf(format, a...))
+}
+
+// peek returns the next byte without consuming it or 0 at the end of input.
+func (p *parser) peek() byte {
+	if p.i < len(p.b) {
+		return p.b[p.i]
+	}
+	return 0
+}
+
+// skipSpace skips whitespace and comments. Newlines are skipped only if nl is
+// true.
+func (p *parser) skipSpace(nl bool) {
+	for p.i < len(p.b) {
+		switch p.b[p.i] {
+		case ' ', '\t', '\r':
+		case '\n':
+			if !nl {
+				return
+			}
+			p.ln++
+		case '#':
+			for p.i < len(p.b) && p.b[p.i] != '\n' {
+				p.i++
+			}
+			continue
+		default:
+			return
+		}
+		p.i++
+	}
+}
+
+// endLine ensures that there is nothing else on the current line.
+func (p *parser) endLine() error {
+	if p.skipSpace(false); p.i < len(p.b) && p.b[p.i] != '\n' {
+		return p.errorf("unexpected %q", p.b[p.i])
+	}
+	return nil
+}
+
+// header parses a table header and returns the new current table.
+func (p *parser) header(root Table) (Table, error) {
+	p.i++
+	array := p.peek() == '['
+	if array {
+		p.i++
+	}
+	keys, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != ']' {
+		return nil, p.errorf("expected ']'")
+	}
+	if p.i++; array {
+		if p.peek() != ']' {
+			return nil, p.errorf("expected ']]'")
+		}
+		p.i++
+	}
+	t, err := p.subTable(root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := keys[len(keys)-1]
+	switch v := t[last].(type) {
+	case nil:
+		sub := make(Table)
+		p.define(sub)
+		if !array {
+			t[last] = sub
+			return sub, nil
+		}
+		t[last] = []Table{sub}
+		return sub, nil
+	case Table:
+		if !array && p.define(v) {
+			return v, nil
+		}
+	case []Table:
+		if array {
+			sub := make(Table)
+			p.define(sub)
+			t[last] = append(v, sub)
+			return sub, nil
+		}
+	}
+	return nil, p.errorf("key %q redefined", strings.Join(keys, "."))
+}
+
+// subTable returns the table identified by dotted keys, creating it if needed.
+// If an intermediate key refers to an array of tables, its last element is
+// used.
+func (p *parser) subTable(t Table, keys []string) (Table, error) {
+	for i, k := range keys {
+		switch v := t[k].(type) {
+		case nil:
+			sub := make(Table)
+			t[k], t = sub, sub
+		case Table:
+			t = v
+		case []Table:
+			t = v[len(v)-1]
+		default:
+			return nil, p.errorf("key %q is not a table",
+				strings.Join(keys[:i+1], "."))
+		}
+	}
+	return t, nil
+}
+
+// keyVal parses a key/value pair into table t.
+func (p *parser) keyVal(t Table) error {
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	if p.peek() != '=' {
+		return p.errorf("expected '=' after key")
+	}
+	p.i++
+	p.skipSpace(false)
+	v, err := p.value()
+	if err != nil {
+		return err
+	}
+	if t, err = p.subTable(t, keys[:len(keys)-1]); err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, dup := t[last]; dup {
+		return p.errorf("key %q redefined", strings.Join(keys, "."))
+	}
+	t[last] = v
+	return nil
+}
+
+// key parses a bare, quoted, or dotted key.
+func (p *parser) key() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace(false)
+		var k string
+		switch c := p.peek(); {
+		case c == '"' || c == '\'':
+			var err error
+			if k, err = p.str(); err != nil {
+				return nil, err
+			}
+		case isBare(c):
+			j := p.i
+			for p.i < len(p.b) && isBare(p.b[p.i]) {
+				p.i++
+			}
+			k = string(p.b[j:p.i])
+		default:
+			return nil, p.errorf("invalid key")
+		}
+		keys = append(keys, k)
+		if p.skipSpace(false); p.peek() != '.' {
+			return keys, nil
+		}
+		p.i++
+	}
+}
+
+// value parses a value.
+func (p *parser) value() (interface{}, error) {
+	switch c := p.peek(); {
+	case c == '"' || c == '\'':
+		return p.str()
+	case c == '[':
+		return p.array()
+	case c == '{':
+		return p.inlineTable()
+	case c == 't' || c == 'f':
+		j := p.i
+		for p.i < len(p.b) && 'a' <= p.b[p.i] && p.b[p.i] <= 'z' {
+			p.i++
+		}
+		switch string(p.b[j:p.i]) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	case c == '+' || c == '-' || ('0' <= c && c <= '9'):
+		j := p.i
+		for p.i++; p.i < len(p.b) && (isBare(p.b[p.i]) || p.b[p.i] == '.'); p.i++ {
+		}
+		if v, ok := parseInt(string(p.b[j:p.i])); ok {
+			return v, nil
+		}
+		return nil, p.errorf("unsupported value %q", p.b[j:p.i])
+	}
+	return nil, p.errorf("invalid value")
+}
+
+// str parses a basic or literal string.
+func (p *parser) str() (string, error) {
+	q := p.b[p.i]
+	j := p.i
+	for p.i++; p.i < len(p.b); p.i++ {
+		switch p.b[p.i] {
+		case '\\':
+			if q == '"' {
+				p.i++
+			}
+			continue
+		case '\n':
+			return "", p.errorf("unterminated string")
+		case q:
+		default:
+			continue
+		}
+		p.i++
+		if q == '\'' {
+			return string(p.b[j+1 : p.i-1]), nil
+		}
+		s, ok := unescape(string(p.b[j+1 : p.i-1]))
+		if !ok {
+			return "", p.errorf("invalid string %s", p.b[j:p.i])
+		}
+		return s, nil
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// parseInt parses a decimal integer with an optional sign. Underscores are
+// allowed between digits. Leading zeros are not allowed.
+func parseInt(s string) (int64, bool) {
+	d := s
+	if d != "" && (d[0] == '+' || d[0] == '-') {
+		d = d[1:]
+	}
+	if d == "" || (d[0] == '0' && len(d) > 1) {
+		return 0, false
+	}
+	for i := 0; i < len(d); i++ {
+		if c := d[i]; c == '_' {
+			if i == 0 || i == len(d)-1 || d[i+1] == '_' {
+				return 0, false
+			}
+		} else if c < '0' || '9' < c {
+			return 0, false
+		}
+	}
+	v, err := strconv.ParseInt(strings.Replace(s, "_", "", -1), 10, 64)
+	return v, err == nil
+}
+
+// unescape decodes escape sequences in the contents of a basic string.
+func unescape(s string) (string, bool) {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s, true
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		if i++; i == len(s) {
+			return "", false
+		}
+		switch c = s[i]; c {
+		case 'b':
+			b.WriteByte('\b')
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'f':
+			b.WriteByte('\f')
+		case 'r':
+			b.WriteByte('\r')
+		case '"', '\\':
+			b.WriteByte(c)
+		case 'u', 'U':
+			n := 4
+			if c == 'U' {
+				n = 8
+			}
+			if i+n >= len(s) {
+				return "", false
+			}
+			r, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(r)) {
+				return "", false
+			}
+			b.WriteRune(rune(r))
+			i += n
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
+
+// array parses an array, which may span multiple lines.
+func (p *parser) array() (interface{}, error) {
+	var tabs []Table
+	var vals []interface{}
+	for p.i++; ; p.i++ {
+		if p.skipSpace(true); p.peek() == ']' {
+			break
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := v.(Table); ok && len(vals) == len(tabs) {
+			tabs = append(tabs, t)
+		}
+		vals = append(vals, v)
+		if p.skipSpace(true); p.peek() != ',' {
+			break
+		}
+	}
+	if p.peek() != ']' {
+		return nil, p.errorf("expected ']'")
+	}
+	p.i++
+	if len(tabs) > 0 && len(tabs) == len(vals) {
+		return tabs, nil
+	}
+	return vals, nil
+}
+
+// inlineTable parses an inline table.
+func (p *parser) inlineTable() (Table, error) {
+	t := make(Table)
+	for p.i++; ; p.i++ {
+		if p.skipSpace(false); p.peek() == '}' && len(t) == 0 {
+			break
+		}
+		if err := p.keyVal(t); err != nil {
+			return nil, err
+		}
+		if p.skipSpace(false); p.peek() != ',' {
+			break
+		}
+	}
+	if p.peek() != '}' {
+		return nil, p.errorf("expected '}'")
+	}
+	p.i++
+	p.define(t)
+	return t, nil
+}
+
+// isBare returns true if c may be used in a bare key.
+func isBare(c byte) bool {
+	return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' ||
+		'0' <= c && c <= '9' || c == '_' || c == '-'
+}
@@ -0,0 +1,174 @@
+package toml
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	doc := `
+# Comment
+str = "a\tb" # Trailing comment
+lit = 'C:\path'
+int = -1_000
+esc = "\"\\\u00e9\U0001F600"
+yes = true
+no = false
+arr = [
+	"x", "y", # Comment
+	"z",
+]
+empty = []
+inline = {a = 1, b.c = "d"}
+"quoted key" = 1
+
+[tab.sub]
+k = "v"
+
+[tab]
+dotted.key = 2
+
+[[arr_tab]]
+n = 1
+[[arr_tab]]
+n = 2
+[arr_tab.sub]
+x = 3
+`
+	want := Table{
+		"str":        "a\tb",
+		"lit":        `C:\path`,
+		"int":        int64(-1000),
+		"esc":        "\"\\\u00e9\U0001F600",
+		"yes":        true,
+		"no":         false,
+		"arr":        []interface{}{"x", "y", "z"},
+		"empty":      []interface{}(nil),
+		"inline":     Table{"a": int64(1), "b": Table{"c": "d"}},
+		"quoted key": int64(1),
+		"tab": Table{
+			"sub":    Table{"k": "v"},
+			"dotted": Table{"key": int64(2)},
+		},
+		"arr_tab": []Table{
+			{"n": int64(1)},
+			{"n": int64(2), "sub": Table{"x": int64(3)}},
+		},
+	}
+	have, err := Parse([]byte(doc))
+	require.NoError(t, err)
+	assert.Equal(t, want, have)
+	assert.Equal(t, want["tab"], have.Table("tab"))
+	assert.Nil(t, have.Table("str"))
+
+	// Implicit parent tables may be defined later
+	_, err = Parse([]byte("[a.b]\n[a]\n[[c]]\n[c.d]\n[[c]]\n[c.d]"))
+	assert.NoError(t, err)
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []*struct{ doc, err string }{
+		{"a", "toml: line 1: expected '=' after key"},
+		{"a = ", "toml: line 1: invalid value"},
+		{"a = 1 b", "toml: line 1: unexpected 'b'"},
+		{"a = 1\na = 2", `toml: line 2: key "a" redefined`},
+		{"a = 1\n[a]", `toml: line 2: key "a" redefined`},
+		{"a = 1\n[a.b]", `toml: line 2: key "a" is not a table`},
+		{"[a]\n[[a]]", `toml: line 2: key "a" redefined`},
+		{"[a]\nb = 1\n[c]\n[a]", `toml: line 4: key "a" redefined`},
+		{"[a.b]\n[a.b]", `toml: line 2: key "a.b" redefined`},
+		{"a = {b = 1}\n[a]", `toml: line 2: key "a" redefined`},
+		{"[a", "toml: line 1: expected ']'"},
+		{`a = "x`, "toml: line 1: unterminated string"},
+		{`a = "\q"`, `toml: line 1: invalid string "\q"`},
+		{`a = "\x41"`, `toml: line 1: invalid string "\x41"`},
+		{`a = "\u00"`, `toml: line 1: invalid string "\u00"`},
+		{`a = "\ud800"`, `toml: line 1: invalid string "\ud800"`},
+		{"a = 1.5", `toml: line 1: unsupported value "1.5"`},
+		{"a = 010", `toml: line 1: unsupported value "010"`},
+		{"a = 0xff", `toml: line 1: unsupported value "0xff"`},
+		{"a = 1__0", `toml: line 1: unsupported value "1__0"`},
+		{"a = _1", "toml: line 1: invalid value"},
+		{"a = 1_", `toml: line 1: unsupported value "1_"`},
+		{"a = +", `toml: line 1: unsupported value "+"`},
+		{"a = tru", "toml: line 1: invalid value"},
+		{"a = [1\n2]", "toml: line 2: expected ']'"},
+		{"a = {b = 1", "toml: line 1: expected '}'"},
+	}
+	for _, tc := range tests {
+		_, err := Parse([]byte(tc.doc))
+		assert.EqualError(t, err, tc.err, "%q", tc.doc)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	type Sub struct {
+		N int `toml:"n"`
+	}
+	type Embed struct {
+		E string `toml:"e"`
+	}
+	type Name string
+	var v struct {
+		Embed
+		S    string            `toml:"s"`
+		B    bool              `toml:"b"`
+		I    int               `toml:"i"`
+		D    time.Duration     `toml:"d"`
+		Arr  []string          `toml:"arr"`
+		Map  map[Name]string   `toml:"map"`
+		Subs []Sub             `toml:"subs"`
+		Ptr  *Sub              `toml:"ptr"`
+		Tabs map[string][]*Sub `toml:"tabs"`
+		Any  interface{}       `toml:"any"`
+		Skip string            `toml:"-"`
+		None string
+	}
+	doc := `
+e = "embed"
+s = "str"
+b = true
+i = 42
+d = "1h30m"
+arr = ["a", "b"]
+map = {x = "y"}
+subs = [{n = 1}, {n = 2}]
+any = 1
+[ptr]
+n = 3
+[[tabs.t]]
+n = 4
+`
+	tab, err := Parse([]byte(doc))
+	require.NoError(t, err)
+	require.NoError(t, tab.Decode(&v))
+	assert.Equal(t, "embed", v.E)
+	assert.Equal(t, "str", v.S)
+	assert.True(t, v.B)
+	assert.Equal(t, 42, v.I)
+	assert.Equal(t, 90*time.Minute, v.D)
+	assert.Equal(t, []string{"a", "b"}, v.Arr)
+	assert.Equal(t, map[Name]string{"x": "y"}, v.Map)
+	assert.Equal(t, []Sub{{1}, {2}}, v.Subs)
+	assert.Equal(t, &Sub{3}, v.Ptr)
+	assert.Equal(t, map[string][]*Sub{"t": {{4}}}, v.Tabs)
+	assert.Equal(t, int64(1), v.Any)
+
+	tests := []*struct{ doc, err string }{
+		{"x = 1", `toml: unknown key "x"`},
+		{"s = 1", `toml: invalid integer value for "s"`},
+		{"d = 1", `toml: invalid integer value for "d"`},
+		{`d = "1x"`, `toml: invalid duration for "d"`},
+		{`arr = [1]`, `toml: invalid integer value for "arr[0]"`},
+		{"[ptr]\nm = 1", `toml: unknown key "ptr.m"`},
+		{"skip = 'x'", `toml: unknown key "skip"`},
+	}
+	for _, tc := range tests {
+		tab, err := Parse([]byte(tc.doc))
+		require.NoError(t, err)
+		assert.EqualError(t, tab.Decode(&v), tc.err, "%q", tc.doc)
+	}
+}